@@ -8,6 +8,8 @@ import (
 	"net/rpc"
 	"strconv"
 	"sync"
+
+	"uk.ac.bris.cs/gameoflife/rules"
 )
 
 const (
@@ -25,12 +27,15 @@ type StartGolExecutionRequest struct {
 	ImageHeight int
 	ImageWidth int
 	Threads int
+	Rule string
+	Topology int
 	ContinuePreviousWorld bool
 }
 
 type StartGolExecutionResponse struct {
 	GolWorld [][]uint8
 	Turns int
+	Statistics []TurnCounts
 }
 
 type GetBoardStateResponse struct {
@@ -38,6 +43,22 @@ type GetBoardStateResponse struct {
 	Turns int
 }
 
+type GetTurnStatisticsResponse struct {
+	Statistics []TurnCounts
+}
+
+// TurnCounts holds how many cells were born and died on a turn, and how many were alive after it.
+type TurnCounts struct {
+	CompletedTurns int
+	Births int
+	Deaths int
+	Population int
+}
+
+// statisticsLimit is how many turns of statistics the broker holds for a controller to collect.
+// If no controller collects them, the oldest are dropped.
+const statisticsLimit = 1 << 20
+
 type EngineStateRequest struct {
 	State int
 }
@@ -48,16 +69,21 @@ type EmptyRpcResponse struct {}
 
 // GOL_ENGINE REQ/RES STRUCTS
 
+// StartEngineRequest holds one strip of the world, rows StartHeight to EndHeight, in GolWorld.
+// The strip is surrounded by a halo of as many cells as the radius of the rule on every side.
 type StartEngineRequest struct {
 	GolWorld [][]uint8
 	ImageHeight int
 	ImageWidth int
 	StartHeight int
 	EndHeight int
+	Rule string
 }
 
 type StartEngineResponse struct {
 	GolWorld [][]uint8
+	Births int
+	Deaths int
 }
 
 type BrokerOperations struct {
@@ -67,6 +93,10 @@ type BrokerOperations struct {
 	imageWidth int
 	totalTurns int
 	turn int
+	rule string
+	topology rules.Topology
+	population int
+	statistics []TurnCounts
 	lock sync.Mutex
 	killingChannel chan bool
 	wg sync.WaitGroup
@@ -85,6 +115,25 @@ func (g *BrokerOperations) getGolWorld() [][]uint8 {
 	return g.golWorld
 }
 
+// addStatistics records the counts of a turn until a controller collects them.
+func (g *BrokerOperations) addStatistics(counts TurnCounts) {
+	g.lock.Lock()
+	if len(g.statistics) == statisticsLimit {
+		g.statistics = g.statistics[1:]
+	}
+	g.statistics = append(g.statistics, counts)
+	g.lock.Unlock()
+}
+
+// takeStatistics returns the counts of the turns since a controller last collected them.
+func (g *BrokerOperations) takeStatistics() []TurnCounts {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	statistics := g.statistics
+	g.statistics = nil
+	return statistics
+}
+
 func (g *BrokerOperations) killBroker() {
 	g.killingChannel <- true
 }
@@ -93,6 +142,14 @@ func (g *BrokerOperations) killBroker() {
 func (g *BrokerOperations) StartGolExecution(req StartGolExecutionRequest, res *StartGolExecutionResponse) (err error) {
 	fmt.Println("BrokerOperations.StartGolExecution called on " + strconv.Itoa(req.Turns) + " turns")
 
+	//Reject invalid rules before any turn runs
+	if _, err = rules.ParseRule(req.Rule); err != nil {
+		return err
+	}
+	if !rules.Topology(req.Topology).Valid() {
+		return fmt.Errorf("invalid topology %d", req.Topology)
+	}
+
 	if req.Turns == 0 {
 		res.Turns = 0
 		res.GolWorld = req.GolWorld
@@ -104,6 +161,8 @@ func (g *BrokerOperations) StartGolExecution(req StartGolExecutionRequest, res *
 	imageHeight := req.ImageHeight
 	firstTurn := 0
 	newGolWorld := req.GolWorld
+	rule := req.Rule
+	topology := rules.Topology(req.Topology)
 
 	//If a previous world was quit and the new controller would like to continue processing that world...
 	if g.state == Quiting && req.ContinuePreviousWorld {
@@ -113,14 +172,29 @@ func (g *BrokerOperations) StartGolExecution(req StartGolExecutionRequest, res *
 		imageWidth = g.imageWidth
 		imageHeight = g.imageHeight
 		firstTurn = g.turn
+		rule = g.rule
+		topology = g.topology
 		newGolWorld = g.getGolWorld()
 	} else {
 		//Otherwise set some values in the structure, so that other functions can access them
 		g.totalTurns = req.Turns
 		g.imageWidth = req.ImageWidth
 		g.imageHeight = req.ImageHeight
+		g.rule = req.Rule
+		g.topology = topology
 		g.turn = 0
 		g.updateGolWorld(req.GolWorld)
+
+		//Count the alive cells once, then keep the count up to date from the births and deaths the engines report
+		g.population = 0
+		for _, row := range req.GolWorld {
+			for _, cell := range row {
+				if cell == 255 {
+					g.population++
+				}
+			}
+		}
+		g.takeStatistics()
 	}
 
 	g.state = Running
@@ -148,10 +222,15 @@ func (g *BrokerOperations) StartGolExecution(req StartGolExecutionRequest, res *
 	defer engines[3].Close()
 
 	//Set Up For Iterations
+	//The halo sent around each strip must be as wide as the neighbourhood radius of the rule
+	parsedRule, err := rules.ParseRule(rule)
+	if err != nil {
+		return err
+	}
 	cuttingHeight := imageHeight/4
-	var channels []chan [][]uint8
+	var channels []chan *StartEngineResponse
 	for i := 0; i < 4; i++ {
-		newChan := make(chan [][]uint8)
+		newChan := make(chan *StartEngineResponse)
 		channels = append(channels, newChan)
 	}
 
@@ -180,25 +259,36 @@ func (g *BrokerOperations) StartGolExecution(req StartGolExecutionRequest, res *
 			go func(index int) {
 				startHeight := index * cuttingHeight
 				endHeight := (index + 1) * cuttingHeight
+				if index == 3 {
+					endHeight = imageHeight
+				}
 
 				request := StartEngineRequest{
-					GolWorld:    newGolWorld,
+					GolWorld:    haloStrip(newGolWorld, startHeight, endHeight, parsedRule.Radius, topology, imageHeight, imageWidth),
 					ImageHeight: imageHeight,
 					ImageWidth:  imageWidth,
 					StartHeight: startHeight,
 					EndHeight:   endHeight,
+					Rule:        rule,
 				}
 				response := new(StartEngineResponse)
 				engines[index].Call("GoLOperations.RunEngine", request, response)
-				channels[index] <- response.GolWorld
+				channels[index] <- response
 			}(i)
 		}
 
 
-		//Put the world back together and then repeat
+		//Put the world back together, adding up the births and deaths of every strip, and then repeat
+		counts := TurnCounts{CompletedTurns: t + 1}
 		for i := 0; i < 4; i++ {
-			processedGolWorld = append(processedGolWorld, <-channels[i]...)
+			response := <-channels[i]
+			processedGolWorld = append(processedGolWorld, response.GolWorld...)
+			counts.Births += response.Births
+			counts.Deaths += response.Deaths
 		}
+		g.population += counts.Births - counts.Deaths
+		counts.Population = g.population
+		g.addStatistics(counts)
 
 		newGolWorld = processedGolWorld
 		g.updateGolWorld(processedGolWorld)
@@ -207,6 +297,7 @@ func (g *BrokerOperations) StartGolExecution(req StartGolExecutionRequest, res *
 	//Once all iterations done, return the final gol world
 	res.GolWorld = g.getGolWorld()
 	res.Turns = g.turn
+	res.Statistics = g.takeStatistics()
 	fmt.Println("Finished Running StartGolExecution")
 
 	//If killing selected, send request to kill all the gol worker engines
@@ -233,6 +324,12 @@ func (g *BrokerOperations) GetBoardState(req EmptyRpcRequest, res *GetBoardState
 	return
 }
 
+// GetTurnStatistics hands over the counts of every turn since they were last collected.
+func (g *BrokerOperations) GetTurnStatistics(req EmptyRpcRequest, res *GetTurnStatisticsResponse) (err error) {
+	res.Statistics = g.takeStatistics()
+	return
+}
+
 func (g *BrokerOperations) SetGolEngineState(req EngineStateRequest, res *GetBoardStateResponse) (err error) {
 	fmt.Println("BrokerOperations.SetGolEngineState called")
 	g.state = req.State
@@ -0,0 +1,20 @@
+package main
+
+import "uk.ac.bris.cs/gameoflife/rules"
+
+// haloStrip copies rows startY to endY of the world together with a halo of radius cells on every side,
+// so that an engine can count the whole neighbourhood of every cell in the strip without seeing the rest of the world.
+// Halo cells are found through the topology of the world, and are dead beyond the edges of a plane;
+// radii wider than the world wrap more than once.
+func haloStrip(world [][]uint8, startY, endY, radius int, topology rules.Topology, imageHeight, imageWidth int) [][]uint8 {
+	strip := make([][]uint8, endY-startY+2*radius)
+	for i := range strip {
+		strip[i] = make([]uint8, imageWidth+2*radius)
+		for j := range strip[i] {
+			if y, x, ok := topology.Locate(startY-radius+i, j-radius, imageHeight, imageWidth); ok {
+				strip[i][j] = world[y][x]
+			}
+		}
+	}
+	return strip
+}
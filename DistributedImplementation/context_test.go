@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// contextResult is what gol.RunContext returned.
+type contextResult struct {
+	turns int
+	err   error
+}
+
+// TestRunContextCancel checks that cancelling the context of a run quits the broker, closing events once after
+// a Quitting StateChange, and returns the turn the broker reached with every goroutine ended.
+// Cancelling straight away, before the broker has started the run, must stop it too.
+func TestRunContextCancel(t *testing.T) {
+	for _, wait := range []bool{true, false} {
+		p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 1000000000, Threads: 4}
+		before := runtime.NumGoroutine()
+		ctx, cancel := context.WithCancel(context.Background())
+		events := make(chan gol.Event)
+		result := make(chan contextResult)
+		go func() {
+			turns, err := gol.RunContext(ctx, p, events, nil)
+			result <- contextResult{turns, err}
+		}()
+
+		polled, quitting := 0, -1
+		for event := range events {
+			switch e := event.(type) {
+			case gol.TurnComplete:
+				//The first TurnComplete is for the starting world, the rest are polled from the broker
+				polled = e.CompletedTurns
+				if polled > 0 || !wait {
+					cancel()
+				}
+			case gol.StateChange:
+				if e.NewState == gol.Quitting {
+					quitting = e.CompletedTurns
+				}
+			case gol.FinalTurnComplete:
+				t.Error("FinalTurnComplete sent after cancelling")
+			}
+		}
+		cancel()
+		r := <-result
+		if r.err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", r.err)
+		}
+		if r.turns < polled || r.turns != quitting {
+			t.Errorf("expected at least %d completed turns to be returned and reported quitting, got %d and %d", polled, r.turns, quitting)
+		}
+		assertGoroutinesEnded(t, before)
+	}
+}
+
+// assertGoroutinesEnded waits up to a second for the number of goroutines to fall back to what it was before a run.
+func assertGoroutinesEnded(t *testing.T, before int) {
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Errorf("%d goroutines are still running, %d were before the run", runtime.NumGoroutine(), before)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
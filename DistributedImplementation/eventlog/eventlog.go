@@ -0,0 +1,290 @@
+// Package eventlog writes the events of a run of the Game of Life to a log, one JSON object to a line,
+// and replays a log into the SDL window at the speed it was written or faster or slower.
+package eventlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// Version is the version of the log format, written in the header of every log.
+const Version = 1
+
+// header is the first line of a log, giving the parameters of the run it was written from.
+type header struct {
+	Version int
+	Params  gol.Params
+}
+
+// line is every line of a log after the header: an event, the name of its type, and when it was sent.
+type line struct {
+	Time  time.Duration // how long after the log was started the event was written
+	Type  string
+	Event json.RawMessage
+}
+
+// eventTypes are the events that can be logged, by the name of their type.
+var eventTypes = make(map[string]reflect.Type)
+
+func init() {
+	for _, event := range []gol.Event{
+		gol.AliveCellsCount{},
+		gol.ImageOutputComplete{},
+		gol.IOError{},
+		gol.StateChange{},
+		gol.CellFlipped{},
+		gol.CellsFlipped{},
+		gol.CellStateChanged{},
+		gol.CellStatesChanged{},
+		gol.TurnStatistics{},
+		gol.TurnComplete{},
+		gol.FinalTurnComplete{},
+	} {
+		t := reflect.TypeOf(event)
+		eventTypes[t.Name()] = t
+	}
+}
+
+// ioError is how an IOError is logged, with its error kept as the message it gives.
+type ioError struct {
+	CompletedTurns int
+	Operation      string
+	Filename       string
+	Err            string
+}
+
+// Writer writes the events of a run to a log.
+type Writer struct {
+	out     *bufio.Writer
+	file    io.Closer // the file written to, when the log was opened with Create
+	started time.Time
+	closed  bool
+	err     error
+}
+
+// NewWriter starts a log of a run with the given parameters on w.
+func NewWriter(w io.Writer, p gol.Params) (*Writer, error) {
+	l := &Writer{out: bufio.NewWriter(w), started: time.Now()}
+	if err := l.writeLine(header{Version: Version, Params: p}); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Create starts a log of a run with the given parameters in the file at path, replacing any file already there.
+func Create(path string, p gol.Params) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	l, err := NewWriter(file, p)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	l.file = file
+	return l, nil
+}
+
+// Write logs an event along with how long after the log was started it came. Once writing has failed
+// every event is ignored, and the first error is returned again.
+func (l *Writer) Write(event gol.Event) error {
+	if l.err != nil {
+		return l.err
+	}
+	if l.closed {
+		return errors.New("event log already closed")
+	}
+	elapsed := time.Since(l.started)
+	name := reflect.TypeOf(event).Name()
+	if eventTypes[name] == nil {
+		l.err = fmt.Errorf("cannot log events of type %T", event)
+		return l.err
+	}
+	var logged interface{} = event
+	if e, ok := event.(gol.IOError); ok {
+		logged = ioError{CompletedTurns: e.CompletedTurns, Operation: e.Operation, Filename: e.Filename, Err: e.Err.Error()}
+	}
+	encoded, err := json.Marshal(logged)
+	if err == nil {
+		err = l.writeLine(line{Time: elapsed, Type: name, Event: encoded})
+	}
+	l.err = err
+	return err
+}
+
+// writeLine writes a value as one line of JSON.
+func (l *Writer) writeLine(v interface{}) error {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := l.out.Write(append(encoded, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Close flushes the log, closing its file if it was opened with Create.
+func (l *Writer) Close() error {
+	if l.closed {
+		return l.err
+	}
+	l.closed = true
+	if err := l.out.Flush(); err != nil && l.err == nil {
+		l.err = err
+	}
+	if l.file != nil {
+		if err := l.file.Close(); err != nil && l.err == nil {
+			l.err = err
+		}
+	}
+	return l.err
+}
+
+// Relay logs every event from in and passes it on to out, closing the log and then out once in is closed.
+// The log is flushed before FinalTurnComplete is passed on, so that it is complete when the run is.
+func (l *Writer) Relay(in <-chan gol.Event, out chan<- gol.Event) {
+	for event := range in {
+		l.Write(event)
+		if _, final := event.(gol.FinalTurnComplete); final && l.err == nil {
+			l.err = l.out.Flush()
+		}
+		out <- event
+	}
+	l.Close()
+	close(out)
+}
+
+// Err returns the first error met while logging, if any.
+func (l *Writer) Err() error {
+	return l.err
+}
+
+// Entry is an event read from a log, with how long after the log was started it was written.
+type Entry struct {
+	Time  time.Duration
+	Event gol.Event
+}
+
+// Reader reads the events of a log in the order they were written.
+type Reader struct {
+	decoder *json.Decoder
+	params  gol.Params
+}
+
+// NewReader reads the header of a log from r, ready to read its events.
+func NewReader(r io.Reader) (*Reader, error) {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	var h header
+	if err := decoder.Decode(&h); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("invalid event log header: %v", err)
+	}
+	if h.Version != Version {
+		return nil, fmt.Errorf("unsupported event log version %d: expected %d", h.Version, Version)
+	}
+	return &Reader{decoder: decoder, params: h.Params}, nil
+}
+
+// Params returns the parameters of the run the log was written from.
+func (r *Reader) Params() gol.Params {
+	return r.params
+}
+
+// Next returns the next event of the log, or io.EOF once every event has been read.
+func (r *Reader) Next() (Entry, error) {
+	var l line
+	if err := r.decoder.Decode(&l); err != nil {
+		return Entry{}, err
+	}
+	if l.Type == "IOError" {
+		var e ioError
+		if err := json.Unmarshal(l.Event, &e); err != nil {
+			return Entry{}, fmt.Errorf("invalid IOError at %v: %v", l.Time, err)
+		}
+		event := gol.IOError{CompletedTurns: e.CompletedTurns, Operation: e.Operation, Filename: e.Filename, Err: errors.New(e.Err)}
+		return Entry{Time: l.Time, Event: event}, nil
+	}
+	t := eventTypes[l.Type]
+	if t == nil {
+		return Entry{}, fmt.Errorf("unknown event type %q at %v", l.Type, l.Time)
+	}
+	event := reflect.New(t)
+	if err := json.Unmarshal(l.Event, event.Interface()); err != nil {
+		return Entry{}, fmt.Errorf("invalid %v at %v: %v", l.Type, l.Time, err)
+	}
+	return Entry{Time: l.Time, Event: event.Elem().Interface().(gol.Event)}, nil
+}
+
+// Replay sends every event of a log to events, closing it once the log has been read or 'q' is pressed.
+// Each event is sent as long after the first as it was written, divided by speed, so that a speed of 2 replays the
+// run twice as fast; a speed of 0 sends every event straight away. Pressing 'p' pauses and resumes the replay.
+func Replay(r *Reader, speed float64, events chan<- gol.Event, keyPresses <-chan rune) error {
+	defer close(events)
+	var started, pausedAt time.Time
+	paused := false
+	for first := true; ; first = false {
+		entry, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if first {
+			//Replaying starts from the first event rather than from when the log was started
+			started = time.Now().Add(-scale(entry.Time, speed))
+		}
+		for {
+			var due <-chan time.Time
+			var timer *time.Timer
+			if !paused {
+				wait := time.Until(started.Add(scale(entry.Time, speed)))
+				if wait <= 0 {
+					break
+				}
+				timer = time.NewTimer(wait)
+				due = timer.C
+			}
+			select {
+			case <-due:
+			case key := <-keyPresses:
+				if timer != nil {
+					timer.Stop()
+				}
+				switch key {
+				case 'p':
+					if paused {
+						//The time spent paused is skipped over
+						started = started.Add(time.Since(pausedAt))
+					} else {
+						pausedAt = time.Now()
+					}
+					paused = !paused
+				case 'q':
+					return nil
+				}
+			}
+		}
+		events <- entry.Event
+	}
+}
+
+// scale returns how long after the first event an event written at t is replayed at the given speed.
+func scale(t time.Duration, speed float64) time.Duration {
+	if speed == 0 {
+		return 0
+	}
+	return time.Duration(float64(t) / speed)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/eventlog"
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestEventLog checks that a run logged through the event log is replayed as the same events in the same order,
+// along with the parameters it was run with.
+func TestEventLog(t *testing.T) {
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 100, Threads: 4}
+	var log bytes.Buffer
+	logger, err := eventlog.NewWriter(&log, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan gol.Event)
+	logged := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	go logger.Relay(events, logged)
+	var sent []gol.Event
+	for event := range logged {
+		sent = append(sent, event)
+	}
+	if err := logger.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := eventlog.NewReader(&log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reader.Params(), p) {
+		t.Errorf("expected the parameters %+v, got %+v", p, reader.Params())
+	}
+	replayed := make(chan gol.Event)
+	result := make(chan error, 1)
+	go func() {
+		result <- eventlog.Replay(reader, 0, replayed, nil)
+	}()
+	i := 0
+	for event := range replayed {
+		if i < len(sent) && !reflect.DeepEqual(event, sent[i]) {
+			t.Fatalf("event %d: expected %#v, replayed %#v", i, sent[i], event)
+		}
+		i++
+	}
+	if i != len(sent) {
+		t.Errorf("expected %d events to be replayed, got %d", len(sent), i)
+	}
+	if err := <-result; err != nil {
+		t.Error(err)
+	}
+}
+
+// TestEventLogEvents checks that every kind of event, including an IOError with its message, is read back as it was
+// written, and that a log cut off part way through a line is an error.
+func TestEventLogEvents(t *testing.T) {
+	written := []gol.Event{
+		gol.CellFlipped{CompletedTurns: 0, Cell: util.Cell{X: 1, Y: 2}},
+		gol.CellsFlipped{CompletedTurns: 1, Cells: []util.Cell{{X: 3, Y: 4}, {X: 5, Y: 6}}},
+		gol.CellStateChanged{CompletedTurns: 1, Cell: util.Cell{X: 7, Y: 8}, State: 127},
+		gol.CellStatesChanged{CompletedTurns: 1, Cells: []util.Cell{{X: 9, Y: 10}, {X: 11, Y: 12}}, States: []uint8{255, 63}},
+		gol.TurnComplete{CompletedTurns: 1},
+		gol.StateChange{CompletedTurns: 1, NewState: gol.Paused},
+		gol.ImageOutputComplete{CompletedTurns: 1, Filename: "16x16x1"},
+		gol.IOError{CompletedTurns: 1, Operation: "write", Filename: "16x16x1", Err: errors.New("disk full")},
+		gol.TurnStatistics{CompletedTurns: 1, Births: 2, Deaths: 3, Population: 4, Density: 0.25},
+		gol.FinalTurnComplete{CompletedTurns: 1, Alive: []util.Cell{{X: 3, Y: 4}}},
+	}
+	var log bytes.Buffer
+	logger, err := eventlog.NewWriter(&log, gol.Params{ImageWidth: 16, ImageHeight: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range written {
+		if err := logger.Write(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	complete := log.String()
+
+	reader, err := eventlog.NewReader(strings.NewReader(complete))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range written {
+		entry, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e, ok := event.(gol.IOError); ok {
+			read, isIOError := entry.Event.(gol.IOError)
+			if !isIOError || read.Error() != e.Error() {
+				t.Errorf("expected %v, read %v", e, entry.Event)
+			}
+		} else if !reflect.DeepEqual(entry.Event, event) {
+			t.Errorf("expected %#v, read %#v", event, entry.Event)
+		}
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF after the last event, got %v", err)
+	}
+
+	reader, err = eventlog.NewReader(strings.NewReader(complete[:len(complete)-10]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for err == nil {
+		_, err = reader.Next()
+	}
+	if err == io.EOF {
+		t.Error("expected a log cut off part way through a line to be an error")
+	}
+}
+
+// TestEventLogSpeed checks that events are replayed as far apart as they were logged, divided by the speed,
+// and that pausing holds the replay back.
+func TestEventLogSpeed(t *testing.T) {
+	var log bytes.Buffer
+	logger, err := eventlog.NewWriter(&log, gol.Params{ImageWidth: 16, ImageHeight: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Write(gol.TurnComplete{CompletedTurns: 1})
+	time.Sleep(200 * time.Millisecond)
+	logger.Write(gol.TurnComplete{CompletedTurns: 2})
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replay := func(speed float64, pause time.Duration) time.Duration {
+		reader, err := eventlog.NewReader(bytes.NewReader(log.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		events := make(chan gol.Event)
+		keyPresses := make(chan rune, 10)
+		go eventlog.Replay(reader, speed, events, keyPresses)
+		<-events
+		started := time.Now()
+		if pause > 0 {
+			keyPresses <- 'p'
+			time.Sleep(pause)
+			keyPresses <- 'p'
+		}
+		<-events
+		return time.Since(started)
+	}
+	if took := replay(1, 0); took < 150*time.Millisecond {
+		t.Errorf("expected events logged 200ms apart to be replayed at least 150ms apart, took %v", took)
+	}
+	if took := replay(4, 0); took > 150*time.Millisecond {
+		t.Errorf("expected events logged 200ms apart to be replayed about 50ms apart at 4 times the speed, took %v", took)
+	}
+	if took := replay(4, 200*time.Millisecond); took < 240*time.Millisecond {
+		t.Errorf("expected pausing for 200ms to hold back an event due 50ms later, took %v", took)
+	}
+}
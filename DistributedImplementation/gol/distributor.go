@@ -1,10 +1,14 @@
 package gol
 
 import (
+	"context"
 	"fmt"
 	"net/rpc"
 	"strconv"
+	"sync"
 	"time"
+
+	"uk.ac.bris.cs/gameoflife/pattern"
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
@@ -17,12 +21,16 @@ const (
 )
 
 type distributorChannels struct {
-	events     chan<- Event
-	ioCommand  chan<- ioCommand
-	ioIdle     <-chan bool
-	ioFilename chan<- string
-	ioOutput   chan<- uint8
-	ioInput    <-chan uint8
+	events       chan<- Event
+	ioCommand    chan<- ioCommand
+	ioIdle       <-chan error
+	ioLoaded     <-chan error
+	ioFilename   chan<- string
+	ioTurn       chan<- int
+	ioOutput     chan<- uint8
+	ioInput      <-chan uint8
+	ioPattern    chan pattern.Pattern
+	ioStatistics chan<- []TurnCounts
 }
 
 // BROKER RPC STRUCTURES BELOW
@@ -33,12 +41,15 @@ type StartGolExecutionRequest struct {
 	ImageHeight int
 	ImageWidth int
 	Threads int
+	Rule string
+	Topology int
 	ContinuePreviousWorld bool
 }
 
 type StartGolExecutionResponse struct {
 	GolWorld [][]uint8
 	Turns int
+	Statistics []TurnCounts
 }
 
 type GetBoardStateResponse struct {
@@ -46,6 +57,18 @@ type GetBoardStateResponse struct {
 	Turns int
 }
 
+type GetTurnStatisticsResponse struct {
+	Statistics []TurnCounts
+}
+
+// TurnCounts holds how many cells were born and died on a turn, and how many were alive after it.
+type TurnCounts struct {
+	CompletedTurns int
+	Births int
+	Deaths int
+	Population int
+}
+
 type EngineStateRequest struct {
 	State int
 }
@@ -56,14 +79,43 @@ type EmptyRpcResponse struct {}
 
 
 // distributor divides the work between workers and interacts with other goroutines.
-func distributor(p Params, c distributorChannels, keyPresses <-chan rune) {
-	//Send command to IO, asking to run readPgmImage function
-	c.ioCommand <- 1
+// It returns the last completed turn, with an error if the broker rejects the execution request,
+// or the first IOError if a file could not be read or written.
+// Cancelling ctx quits the broker as 'q' does, and returns ctx.Err() once it has stopped, without saving the world.
+func distributor(ctx context.Context, p Params, rule Rule, c distributorChannels, keyPresses <-chan rune) (int, error) {
+	//Make a random soup, or receive the starting world from IO, one pixel at a time from a PGM image, or as the cells of a pattern
+	var pixel func(y, x int) uint8
+	if p.Soup.Density != 0 {
+		//Draw a random soup onto the board, without reading anything
+		pixel = makeImmutableMatrix(soupBoard(p))
+	} else if _, err := pattern.FormatOf(p.Input); err == nil {
+		//Send command to IO, asking to read the pattern, and draw it onto the board
+		c.ioCommand <- ioInputPattern
+		c.ioFilename <- p.Input
+		if err := <-c.ioLoaded; err != nil {
+			close(c.ioCommand)
+			close(c.events)
+			return 0, err
+		}
+		pixel = makeImmutableMatrix(patternBoard(p, <-c.ioPattern))
+	} else {
+		//Send command to IO, asking to run readPgmImage function
+		c.ioCommand <- 1
+
+		//Send the path of the image to IO, allowing readPgmImage function to process input of image
+		c.ioFilename <- imagePath(p)
+		if err := <-c.ioLoaded; err != nil {
+			close(c.ioCommand)
+			close(c.events)
+			return 0, err
+		}
+		pixel = func(y, x int) uint8 {
+			return <-c.ioInput
+		}
+	}
 
-	//Construct filename from image height and width
-	//Send filename to IO, allowing readPgmImage function to process input of image
+	//Construct filename of the output from image height and width
 	filename := strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight)
-	c.ioFilename <- filename
 
 	//Create a 2D slice to store the world.
 	golWorld := make([][]uint8, p.ImageHeight)
@@ -74,15 +126,14 @@ func distributor(p Params, c distributorChannels, keyPresses <-chan rune) {
 	//Loop through 2d slice initializing each cell
 	for y := 0; y < p.ImageHeight; y++ {
 		for x := 0; x < p.ImageWidth; x++ {
-			//Receive data from channel and assign to 2d slice
-			b := <- c.ioInput
-			golWorld[y][x] = b
-			if b == 255 {
-				//Let the event component know which cells start alive
-				c.events <- CellFlipped{CompletedTurns: 0, Cell: util.Cell{X: x, Y: y}}
-			}
+			//Receive data from channel and assign to 2d slice, snapping grey levels to the states of the rule
+			golWorld[y][x] = rule.Quantise(pixel(y, x))
 		}
 	}
+	if !p.NoFlips {
+		//Let the event component know which cells start alive (or decaying)
+		checkForCellFlips(func(y, x int) uint8 { return 0 }, makeImmutableMatrix(golWorld), 0, p, rule, c)
+	}
 	c.events <- TurnComplete{CompletedTurns: 0}
 
 	//Take input of server:port
@@ -105,50 +156,74 @@ func distributor(p Params, c distributorChannels, keyPresses <-chan rune) {
 		ImageHeight: p.ImageHeight,
 		ImageWidth: p.ImageWidth,
 		Threads:     p.Threads,
+		Rule:        p.Rule,
+		Topology:    int(p.Topology),
 		//Change this variable to control if the local controller takes over a previous controllers processing on the remote engine
 		ContinuePreviousWorld: false,
 	}
 	response := new(StartGolExecutionResponse)
 
 	//call broker (blocking call) in goroutine with channel to indicate once done
-	golWorldProcessed := make(chan bool)
+	golWorldProcessed := make(chan error)
 	go func() {
-		broker.Call("BrokerOperations.StartGolExecution", request, response)
-		golWorldProcessed <- true
+		golWorldProcessed <- broker.Call("BrokerOperations.StartGolExecution", request, response)
 	}()
 
 	//Running go routine to be flagging for updates every 2 seconds
 	finish := make(chan bool)
-	go timer(broker, golWorld, p, c, finish)
-	go handleKeyPress(broker, p, c, keyPresses, finish)
+	var background sync.WaitGroup
+	background.Add(2)
+	go func() {
+		defer background.Done()
+		timer(broker, golWorld, p, rule, c, finish)
+	}()
+	go func() {
+		defer background.Done()
+		handleKeyPress(ctx, broker, p, c, keyPresses, finish)
+	}()
 
-	//Waiting for the world to be finished processing, then stopping the keypresses and timer cgo routines
-	<- golWorldProcessed
-	finish <- true
-	finish <- true
+	//Waiting for the world to be finished processing, then stopping the keypresses and timer go routines before the broker is closed
+	err = <- golWorldProcessed
+	close(finish)
+	background.Wait()
+	if err != nil {
+		fmt.Println("Error:", err)
+		close(c.ioCommand)
+		close(c.events)
+		return 0, err
+	}
 
 	//Get broker response once gol world done processing on broker
 	newGolWorld := response.GolWorld
 	turn := response.Turns
+	reportStatistics(p, c, response.Statistics)
 
 	// FINISHING UP
-	immutableData := makeImmutableMatrix(newGolWorld)
+	//A cancelled run is left as it is, without saving the world
+	if ctx.Err() == nil {
+		immutableData := makeImmutableMatrix(newGolWorld)
 
-	//Output a PGM image of the final board state
-	outputImage(filename + "x" + strconv.Itoa(turn), turn, immutableData, p, c)
+		//Output a PGM image of the final board state
+		outputImage(filename + "x" + strconv.Itoa(turn), turn, immutableData, p, c)
 
-	//Report the final state using FinalTurnCompleteEvent.
-	aliveCells := calculateAliveCells(p, immutableData)
-	c.events <- FinalTurnComplete{CompletedTurns: turn, Alive: aliveCells}
+		//Report the final state using FinalTurnCompleteEvent.
+		aliveCells := calculateAliveCells(p, immutableData)
+		c.events <- FinalTurnComplete{CompletedTurns: turn, Alive: aliveCells}
+	}
 
-	// Make sure that the Io has finished any output before exiting.
+	// Make sure that the Io has finished any output before exiting, then end it.
 	c.ioCommand <- ioCheckIdle
-	<-c.ioIdle
+	err = <-c.ioIdle
+	close(c.ioCommand)
 	c.events <- StateChange{turn, Quitting}
 
 	
 	// Close the channel to stop the SDL goroutine gracefully. Removing may cause deadlock.
 	close(c.events)
+	if ctx.Err() != nil {
+		return turn, ctx.Err()
+	}
+	return turn, err
 }
 
 
@@ -160,7 +235,7 @@ func makeImmutableMatrix(matrix [][]uint8) func(y, x int) uint8 {
 }
 
 //Go routine used to send a notification every time 2 seconds has passed
-func timer(broker *rpc.Client, latestGolWorld [][]uint8, p Params, c distributorChannels, finish chan bool) {
+func timer(broker *rpc.Client, latestGolWorld [][]uint8, p Params, rule Rule, c distributorChannels, finish chan bool) {
 	ticker := time.Tick(2 * time.Second)
 
 	for {
@@ -169,6 +244,13 @@ func timer(broker *rpc.Client, latestGolWorld [][]uint8, p Params, c distributor
 			return // Exit the function if finish channel is closed
 		case <-ticker:
 			emptyRpcRequest := EmptyRpcRequest{}
+			statisticsResponse := new(GetTurnStatisticsResponse)
+			if err := broker.Call("BrokerOperations.GetTurnStatistics", emptyRpcRequest, statisticsResponse); err != nil {
+				fmt.Println("Error: collecting the turn statistics:", err)
+			} else {
+				reportStatistics(p, c, statisticsResponse.Statistics)
+			}
+
 			boardStateResponse := new(GetBoardStateResponse)
 			broker.Call("BrokerOperations.GetBoardState", emptyRpcRequest, boardStateResponse)
 			immutableData := makeImmutableMatrix(boardStateResponse.GolWorld)
@@ -178,7 +260,9 @@ func timer(broker *rpc.Client, latestGolWorld [][]uint8, p Params, c distributor
 				c.events <- AliveCellsCount{CompletedTurns: boardStateResponse.Turns, CellsCount: len(calculateAliveCells(p, immutableData))}
 
 				//Visualise gol on sdl window
-				checkForCellFlips(makeImmutableMatrix(latestGolWorld), makeImmutableMatrix(boardStateResponse.GolWorld), boardStateResponse.Turns, p, c)
+				if !p.NoFlips {
+					checkForCellFlips(makeImmutableMatrix(latestGolWorld), immutableData, boardStateResponse.Turns, p, rule, c)
+				}
 				c.events <- TurnComplete{CompletedTurns: boardStateResponse.Turns}
 				latestGolWorld = boardStateResponse.GolWorld
 			}
@@ -188,22 +272,69 @@ func timer(broker *rpc.Client, latestGolWorld [][]uint8, p Params, c distributor
 
 
 
-func checkForCellFlips(oldGolWorld func(y, x int) uint8, newWorld func(y, x int) uint8, turn int, p Params, c distributorChannels) {
+//Input: p of type Params containing data about the world
+//Input: statistics, the counts of the turns the broker computed since they were last collected
+//No return, instead sends a TurnStatistics event for every turn, and with PopulationCSV their rows to IO
+func reportStatistics(p Params, c distributorChannels, statistics []TurnCounts) {
+	if p.PopulationCSV && len(statistics) > 0 {
+		c.ioCommand <- ioOutputStatistics
+		c.ioFilename <- strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight) + "x" + strconv.Itoa(p.Turns)
+		c.ioStatistics <- statistics
+	}
+	for _, counts := range statistics {
+		c.events <- TurnStatistics{
+			CompletedTurns: counts.CompletedTurns,
+			Births:         counts.Births,
+			Deaths:         counts.Deaths,
+			Population:     counts.Population,
+			Density:        float64(counts.Population) / float64(p.ImageWidth*p.ImageHeight),
+		}
+	}
+}
+
+//Input: oldGolWorld and newWorld, the board before and after turn
+//No return, instead sends the cells that flipped in one CellsFlipped event, or under Generations rules the cells that
+//changed in one CellStatesChanged event
+func checkForCellFlips(oldGolWorld func(y, x int) uint8, newWorld func(y, x int) uint8, turn int, p Params, rule Rule, c distributorChannels) {
+	var flipped, changed []util.Cell
+	var states []uint8
 	for i := 0; i < p.ImageHeight; i++ {
 		for j := 0; j < p.ImageWidth; j++ {
-			//If cell values do not match, send cell flipped event
+			//If cell values do not match, send cell flipped (or state changed) event
 			if oldGolWorld(i, j) != newWorld(i, j) {
-				c.events <- CellFlipped{CompletedTurns: turn, Cell: util.Cell{X: j, Y: i}}
+				if rule.States > 2 {
+					changed = append(changed, util.Cell{X: j, Y: i})
+					states = append(states, newWorld(i, j))
+				} else {
+					flipped = append(flipped, util.Cell{X: j, Y: i})
+				}
 			}
 		}
 	}
+	if len(flipped) > 0 {
+		c.events <- CellsFlipped{CompletedTurns: turn, Cells: flipped}
+	}
+	if len(changed) > 0 {
+		c.events <- CellStatesChanged{CompletedTurns: turn, Cells: changed, States: states}
+	}
 }
 
-func handleKeyPress(broker *rpc.Client, p Params, c distributorChannels, keyPresses <-chan rune, finish chan bool) {
+// handleKeyPress acts on the keys pressed until finish is closed, quitting the broker if ctx is cancelled first.
+func handleKeyPress(ctx context.Context, broker *rpc.Client, p Params, c distributorChannels, keyPresses <-chan rune, finish chan bool) {
+	cancelled := ctx.Done()
+	var quitting <-chan time.Time
 	for {
 		select {
 			case <-finish:
-				break
+				return
+			case <-cancelled:
+				//Quitting the broker as 'q' does, so that it returns the world it has reached
+				cancelled = nil
+				quitting = time.Tick(500 * time.Millisecond)
+				quitBroker(broker)
+			case <-quitting:
+				//The broker may not have started the run when first asked to quit, so it is asked again until it returns
+				quitBroker(broker)
 			case key := <- keyPresses:
 				switch key {
 				case 's':
@@ -214,7 +345,11 @@ func handleKeyPress(broker *rpc.Client, p Params, c distributorChannels, keyPres
 					broker.Call("BrokerOperations.GetBoardState", emptyRpcRequest, boardStateResponse)
 					immutableData := makeImmutableMatrix(boardStateResponse.GolWorld)
 					filename := strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight) + "x" + strconv.Itoa(boardStateResponse.Turns)
-					outputImage(filename, boardStateResponse.Turns, immutableData, p, c)
+					if p.SnapshotFormat == "" || p.SnapshotFormat == "pgm" {
+						outputImage(filename, boardStateResponse.Turns, immutableData, p, c)
+					} else {
+						outputPattern(filename, boardStateResponse.Turns, immutableData, p, c)
+					}
 				case 'q':
 					fmt.Println("q pressed.")
 					//Close the controller client program without causing an error on the gol engine broker.
@@ -245,7 +380,20 @@ func handleKeyPress(broker *rpc.Client, p Params, c distributorChannels, keyPres
 
 					unpaused := false
 					for !unpaused {
-						switch <-keyPresses {
+						var key rune
+						select {
+						case <-finish:
+							return
+						case <-cancelled:
+							//Quitting the broker instead of resuming it
+							cancelled = nil
+							quitting = time.Tick(500 * time.Millisecond)
+							quitBroker(broker)
+							unpaused = true
+							continue
+						case key = <-keyPresses:
+						}
+						switch key {
 						case 'p':
 							unpaused = true
 							engineStateRequest := EngineStateRequest{State: Running}
@@ -265,6 +413,13 @@ func handleKeyPress(broker *rpc.Client, p Params, c distributorChannels, keyPres
 	}
 }
 
+//Asks the broker to stop the run and return the world it has reached, leaving the engines running
+func quitBroker(broker *rpc.Client) {
+	engineStateRequest := EngineStateRequest{State: Quiting}
+	boardStateResponse := new(GetBoardStateResponse)
+	broker.Call("BrokerOperations.SetGolEngineState", engineStateRequest, boardStateResponse)
+}
+
 //Input: p of type Params containing data about the world
 //Input: world of type [][]uint8 containing the gol world data
 //Returns: slice containing elements of type util.Cell, of all alive cells
@@ -295,10 +450,20 @@ func calculateAliveCells(p Params, data func(y, x int) uint8) []util.Cell {
 func outputImage(filename string, t int, data func(y, x int) uint8, p Params, c distributorChannels) {
 	c.ioCommand <- 0
 	c.ioFilename <- filename
+	c.ioTurn <- t
 	for y := 0; y < p.ImageHeight; y++ {
 		for x := 0; x < p.ImageWidth; x++ {
 			c.ioOutput <- data(y, x)
 		}
 	}
 	c.events <- ImageOutputComplete{CompletedTurns: t, Filename: filename}
-}
\ No newline at end of file
+}
+
+//Sends the alive cells of the world to IO to be written to a pattern file in the snapshot format
+func outputPattern(filename string, t int, data func(y, x int) uint8, p Params, c distributorChannels) {
+	c.ioCommand <- ioOutputPattern
+	c.ioFilename <- filename
+	c.ioTurn <- t
+	c.ioPattern <- boardPattern(p, t, data)
+	c.events <- ImageOutputComplete{CompletedTurns: t, Filename: filename}
+}
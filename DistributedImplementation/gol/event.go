@@ -23,11 +23,23 @@ type AliveCellsCount struct { // implements Event
 
 // ImageOutputComplete is an Event notifying the user about the completion of output.
 // This Event should be sent every time an image has been saved.
+// It is sent once the world has been handed to the io goroutine, so an IOError may still follow if writing fails.
 type ImageOutputComplete struct { // implements Event
 	CompletedTurns int
 	Filename       string
 }
 
+// IOError is an Event notifying the user that a file could not be read or written, instead of the whole program
+// panicking. Operation says what was being done, such as "read image" or "write pattern".
+// A failure to read the starting world ends the run before the first turn, with gol.Run returning the IOError;
+// a failure to write carries on with the run, and gol.Run returns the first such IOError once it has finished.
+type IOError struct { // implements Event and error
+	CompletedTurns int
+	Operation      string
+	Filename       string
+	Err            error
+}
+
 // State represents a change in the state of execution.
 type State int
 
@@ -45,16 +57,56 @@ type StateChange struct { // implements Event
 }
 
 // CellFlipped is an Event notifying the GUI about a change of state of a single cell.
-// This even should be sent every time a cell changes state.
-// Make sure to send this event for all cells that are alive when the image is loaded in.
+// The cells changed by a turn, and those alive when the image is loaded in, are sent in CellsFlipped batches instead.
 type CellFlipped struct { // implements Event
 	CompletedTurns int
 	Cell           util.Cell
 }
 
+// CellsFlipped is an Event notifying the GUI about a batch of cells that changed state on the same turn, sent instead
+// of a CellFlipped for each of them. A batch is sent for the cells alive when the image is loaded in, and then for
+// each part of the world computed on a turn, so a turn's flips may come in several batches.
+// The Cells slice belongs to the receiver and is not changed after being sent.
+type CellsFlipped struct { // implements Event
+	CompletedTurns int
+	Cells          []util.Cell
+}
+
+// CellStateChanged is an Event notifying the GUI about a cell of a multi-state (Generations) rule taking a new state.
+// It is sent instead of CellFlipped when the rule has more than 2 states, as decaying cells are neither alive nor dead.
+// State is the new pixel value of the cell: 255 when alive, 0 when dead and a grey level while decaying.
+// The cells changed by a turn, and those not dead when the image is loaded in, are sent in CellStatesChanged batches
+// instead.
+type CellStateChanged struct { // implements Event
+	CompletedTurns int
+	Cell           util.Cell
+	State          uint8
+}
+
+// CellStatesChanged is an Event notifying the GUI about a batch of cells of a Generations rule that took new states on
+// the same turn, sent instead of a CellStateChanged for each of them, as CellsFlipped is for two-state rules.
+// States[i] is the new pixel value of Cells[i]. The slices belong to the receiver and are not changed after being sent.
+type CellStatesChanged struct { // implements Event
+	CompletedTurns int
+	Cells          []util.Cell
+	States         []uint8
+}
+
+// TurnStatistics is an Event reporting how the population changed on a turn: how many cells were born, how many died
+// (including alive cells that started to decay), and how many are alive with the fraction of the world they cover.
+// The engines count the births and deaths of their strips, and the broker adds them up and keeps the population.
+// The controller collects the statistics of every turn from the broker every 2s, so they arrive in batches.
+type TurnStatistics struct { // implements Event
+	CompletedTurns int
+	Births         int
+	Deaths         int
+	Population     int
+	Density        float64
+}
+
 // TurnComplete is an Event notifying the GUI about turn completion.
 // SDL will render a frame when this event is sent.
-// All CellFlipped events must be sent *before* TurnComplete.
+// All CellFlipped, CellsFlipped, CellStateChanged and CellStatesChanged events must be sent *before* TurnComplete.
 type TurnComplete struct { // implements Event
 	CompletedTurns int
 }
@@ -106,6 +158,18 @@ func (event ImageOutputComplete) GetCompletedTurns() int {
 	return event.CompletedTurns
 }
 
+func (event IOError) String() string {
+	return fmt.Sprintf("IO error: cannot %v %v: %v", event.Operation, event.Filename, event.Err)
+}
+
+func (event IOError) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event IOError) Error() string {
+	return event.String()
+}
+
 func (event CellFlipped) String() string {
 	return fmt.Sprintf("")
 }
@@ -114,6 +178,38 @@ func (event CellFlipped) GetCompletedTurns() int {
 	return event.CompletedTurns
 }
 
+func (event CellsFlipped) String() string {
+	return fmt.Sprintf("")
+}
+
+func (event CellsFlipped) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event CellStateChanged) String() string {
+	return fmt.Sprintf("")
+}
+
+func (event CellStateChanged) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event CellStatesChanged) String() string {
+	return fmt.Sprintf("")
+}
+
+func (event CellStatesChanged) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event TurnStatistics) String() string {
+	return fmt.Sprintf("")
+}
+
+func (event TurnStatistics) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
 func (event TurnComplete) String() string {
 	return fmt.Sprintf("")
 }
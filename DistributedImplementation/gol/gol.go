@@ -1,40 +1,204 @@
 package gol
 
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"uk.ac.bris.cs/gameoflife/pattern"
+)
+
 // Params provides the details of how to run the Game of Life and which image to load.
 type Params struct {
 	Turns       int
 	Threads     int
 	ImageWidth  int
 	ImageHeight int
+	Rule        string   // Rulestring in B/S notation, e.g. "B36/S23". Defaults to DefaultRule.
+	Topology    Topology // How the edges of the world are joined. Defaults to Torus.
+
+	// Input is the path of the PBM or PGM image to start from, images/<ImageWidth>x<ImageHeight>.pgm when left empty.
+	// ImageWidth and ImageHeight are read from its header when left 0, and must agree with it otherwise.
+	// PNG, JPEG and GIF images are scaled to ImageWidth by ImageHeight instead, and binarised: see Binarisation.
+	// RLE (.rle), plaintext (.cells) and Life 1.06 (.lif) patterns can be given too: see OffsetX and Centre.
+	Input string
+
+	// ImageIndex chooses the image to start from when Input holds several PBM or PGM images, counting from 0.
+	ImageIndex int
+
+	// AliveThreshold, between 0 and 1, makes the pixels of the input image at least that fraction of its maxval
+	// alive and every other pixel dead. Left 0, pixels are scaled to grey levels and snapped to the states of the rule.
+	AliveThreshold float64
+
+	// Binarisation chooses how the pixels of a PNG, JPEG or GIF image become alive or dead, by their brightness.
+	// Bright pixels are alive, or with Invert, dark pixels.
+	Binarisation Binarisation
+	Invert       bool
+
+	// Soup, given a density above 0, starts from a random soup instead of an image, so Input must be left empty.
+	Soup Soup
+
+	// A pattern given as Input has its top left corner placed at (OffsetX, OffsetY) on the board, or with Centre,
+	// is centred on the board and then moved by the offset. The board is the size of the pattern when ImageWidth
+	// and ImageHeight are left 0, and the rule in the header of an RLE pattern is used when Rule is left empty.
+	OffsetX int
+	OffsetY int
+	Centre  bool
+
+	// SnapshotFormat is the format of the snapshots saved by pressing 's': pgm, the default, or rle, cells or lif.
+	// Decaying cells of Generations rules are only kept in PGM images.
+	SnapshotFormat string
+
+	// PopulationCSV writes the number of alive cells after every turn to a CSV file beside the final PGM image,
+	// in the same format as check/alive. The rows are written as the statistics are collected from the broker.
+	PopulationCSV bool
+
+	// NoFlips sends no CellFlipped, CellsFlipped, CellStateChanged or CellStatesChanged events, for runs with nothing
+	// to draw the cells on. The board is still polled from the broker every 2 seconds, but only to count its alive cells.
+	NoFlips bool
 }
 
 // Run starts the processing of Game of Life. It should initialise channels and goroutines.
-func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
+// An error is returned, and events closed, if the parameters are rejected before the first turn.
+// Files that cannot be read or written are reported as IOError events, and the first is returned once events is closed.
+func Run(p Params, events chan<- Event, keyPresses <-chan rune) error {
+	_, err := RunContext(context.Background(), p, events, keyPresses)
+	return err
+}
+
+// RunContext is Run that can be cancelled through ctx, returning the number of completed turns as well.
+// Once cancelled, the broker is quit as 'q' does, the timer and io goroutine are stopped and events is closed after
+// a Quitting StateChange, without saving the world or sending FinalTurnComplete. ctx.Err() is returned.
+// events must be read until it is closed, however the run ends.
+func RunContext(ctx context.Context, p Params, events chan<- Event, keyPresses <-chan rune) (int, error) {
+	if p.ImageIndex < 0 || p.AliveThreshold < 0 || p.AliveThreshold > 1 {
+		close(events)
+		return 0, fmt.Errorf("invalid image index %d or alive threshold %v", p.ImageIndex, p.AliveThreshold)
+	}
+	if p.Binarisation < Threshold || p.Binarisation > FloydSteinberg {
+		close(events)
+		return 0, fmt.Errorf("invalid binarisation %v", p.Binarisation)
+	}
+	if p.Input != "" {
+		if err := inspectInput(&p); err != nil {
+			close(events)
+			return 0, err
+		}
+	}
+	rule, err := ParseRule(p.Rule)
+	if err != nil {
+		close(events)
+		return 0, err
+	}
+	if p.ImageWidth <= 0 || p.ImageHeight <= 0 {
+		close(events)
+		return 0, fmt.Errorf("invalid image size %dx%d", p.ImageWidth, p.ImageHeight)
+	}
+	if p.Soup.Density != 0 {
+		if err := p.Soup.check(p); err != nil {
+			close(events)
+			return 0, err
+		}
+		if p.Input != "" {
+			close(events)
+			return 0, fmt.Errorf("cannot start from both a random soup and %v", p.Input)
+		}
+	}
+	if p.SnapshotFormat != "" && p.SnapshotFormat != "pgm" {
+		if _, err := pattern.ParseFormat(p.SnapshotFormat); err != nil {
+			close(events)
+			return 0, err
+		}
+	}
 
 	//	TODO: Put the missing channels in here.
 
 	ioCommand := make(chan ioCommand)
 	filename := make(chan string)
+	turn := make(chan int)
 	output := make(chan uint8)
 	input := make(chan uint8)
-	ioIdle := make(chan bool)
+	ioIdle := make(chan error)
+	ioLoaded := make(chan error)
+	patterns := make(chan pattern.Pattern)
+	statistics := make(chan []TurnCounts)
 
 	ioChannels := ioChannels{
-		command:  ioCommand,
-		idle:     ioIdle,
-		filename: filename,
-		output:   output,
-		input:    input,
+		command:    ioCommand,
+		idle:       ioIdle,
+		events:     events,
+		loaded:     ioLoaded,
+		filename:   filename,
+		turn:       turn,
+		output:     output,
+		input:      input,
+		patterns:   patterns,
+		statistics: statistics,
 	}
 	go startIo(p, ioChannels)
 
 	distributorChannels := distributorChannels{
-		events:     events,
-		ioCommand:  ioCommand,
-		ioIdle:     ioIdle,
-		ioFilename: filename,
-		ioOutput:   output,
-		ioInput:    input,
+		events:       events,
+		ioCommand:    ioCommand,
+		ioIdle:       ioIdle,
+		ioLoaded:     ioLoaded,
+		ioFilename:   filename,
+		ioTurn:       turn,
+		ioOutput:     output,
+		ioInput:      input,
+		ioPattern:    patterns,
+		ioStatistics: statistics,
+	}
+	return distributor(ctx, p, rule, distributorChannels, keyPresses)
+}
+
+// inspectInput fills in the width and height of the world from the header of the input image, checking any size
+// that was given against it. A pattern is instead checked to fit on the board, which is the size of the pattern
+// unless given, and its rule used unless another is given.
+func inspectInput(p *Params) error {
+	loaded, isPattern, err := readPattern(p.Input)
+	if err != nil {
+		return err
+	}
+	if isPattern {
+		if p.ImageWidth == 0 {
+			p.ImageWidth = loaded.Width
+		}
+		if p.ImageHeight == 0 {
+			p.ImageHeight = loaded.Height
+		}
+		if p.Rule == "" {
+			p.Rule = loaded.Rule
+		}
+		_, err := placePattern(*p, loaded)
+		return err
+	}
+
+	width, height, err := ImageSize(p.Input, p.ImageIndex)
+	if err != nil {
+		return err
+	}
+	if _, isPhoto, _ := photoConfig(p.Input); isPhoto {
+		//Photos are scaled to any size of board, which is the size of the photo unless given
+		if p.ImageWidth == 0 {
+			p.ImageWidth = width
+		}
+		if p.ImageHeight == 0 {
+			p.ImageHeight = height
+		}
+		return nil
+	}
+	if (p.ImageWidth != 0 && p.ImageWidth != width) || (p.ImageHeight != 0 && p.ImageHeight != height) {
+		return fmt.Errorf("%v is %dx%d, not %dx%d", p.Input, width, height, p.ImageWidth, p.ImageHeight)
+	}
+	p.ImageWidth, p.ImageHeight = width, height
+	return nil
+}
+
+// imagePath returns the path of the PGM image the world starts from.
+func imagePath(p Params) string {
+	if p.Input != "" {
+		return p.Input
 	}
-	distributor(p, distributorChannels, keyPresses)
+	return "images/" + strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight) + ".pgm"
 }
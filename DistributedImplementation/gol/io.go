@@ -1,27 +1,43 @@
 package gol
 
 import (
+	"bufio"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"strconv"
-	"strings"
-	"uk.ac.bris.cs/gameoflife/util"
+
+	"uk.ac.bris.cs/gameoflife/pattern"
 )
 
 type ioChannels struct {
 	command <-chan ioCommand
-	idle    chan<- bool
+	idle    chan<- error
+	events  chan<- Event
+	loaded  chan<- error
 
 	filename <-chan string
+	turn     <-chan int
 	output   <-chan uint8
 	input    chan<- uint8
+	patterns chan pattern.Pattern
+
+	statistics <-chan []TurnCounts
 }
 
 // ioState is the internal ioState of the io goroutine.
 type ioState struct {
 	params   Params
 	channels ioChannels
+
+	// The population CSV file, kept open between batches of rows until the distributor checks the io goroutine is idle.
+	statisticsFile   *os.File
+	statisticsWriter *bufio.Writer
+	statisticsName   string
+	statisticsTurn   int
+	statisticsFailed bool
+
+	// The first failure to read or write a file, given to the distributor when it checks the io goroutine is idle.
+	failure error
 }
 
 // ioCommand allows requesting behaviour from the io (pgm) goroutine.
@@ -32,31 +48,26 @@ type ioCommand uint8
 //		ioOutput 	= 0
 //		ioInput 	= 1
 //		ioCheckIdle = 2
+//		ioInputPattern = 3
+//		ioOutputPattern = 4
+//		ioOutputStatistics = 5
 const (
 	ioOutput ioCommand = iota
 	ioInput
 	ioCheckIdle
+	ioInputPattern
+	ioOutputPattern
+	ioOutputStatistics
 )
 
-// writePgmImage receives an array of bytes and writes it to a pgm file.
+// writePgmImage receives an array of bytes and writes it to a pgm file, noting the turn and rule in comments.
+// Decaying cells of Generations rules are received, and written, as grey levels between 0 and 255.
 func (io *ioState) writePgmImage() {
 	_ = os.Mkdir("out", os.ModePerm)
 
-	// Request a filename from the distributor.
+	// Request a filename and the turn from the distributor.
 	filename := <-io.channels.filename
-
-	file, ioError := os.Create("out/" + filename + ".pgm")
-	util.Check(ioError)
-	defer file.Close()
-
-	_, _ = file.WriteString("P5\n")
-	//_, _ = file.WriteString("# PGM file writer by pnmmodules (https://github.com/owainkenwayucl/pnmmodules).\n")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageWidth))
-	_, _ = file.WriteString(" ")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageHeight))
-	_, _ = file.WriteString("\n")
-	_, _ = file.WriteString(strconv.Itoa(255))
-	_, _ = file.WriteString("\n")
+	turn := <-io.channels.turn
 
 	world := make([][]byte, io.params.ImageHeight)
 	for i := range world {
@@ -73,56 +84,229 @@ func (io *ioState) writePgmImage() {
 		}
 	}
 
+	rule, ioError := ParseRule(io.params.Rule)
+	if ioError != nil {
+		io.fail(turn, "write image", filename, ioError)
+		return
+	}
+
+	file, ioError := os.Create("out/" + filename + ".pgm")
+	if ioError != nil {
+		io.fail(turn, "write image", filename, ioError)
+		return
+	}
+	defer file.Close()
+
+	_, _ = file.WriteString("P5\n")
+	//_, _ = file.WriteString("# PGM file writer by pnmmodules (https://github.com/owainkenwayucl/pnmmodules).\n")
+	_, _ = file.WriteString("# Turn " + strconv.Itoa(turn) + "\n")
+	_, _ = file.WriteString("# Rule " + rule.String() + "\n")
+	_, _ = file.WriteString(strconv.Itoa(io.params.ImageWidth))
+	_, _ = file.WriteString(" ")
+	_, _ = file.WriteString(strconv.Itoa(io.params.ImageHeight))
+	_, _ = file.WriteString("\n")
+	_, _ = file.WriteString(strconv.Itoa(255))
+	_, _ = file.WriteString("\n")
+
 	for y := 0; y < io.params.ImageHeight; y++ {
-		for x := 0; x < io.params.ImageWidth; x++ {
-			_, ioError = file.Write([]byte{world[y][x]})
-			util.Check(ioError)
+		if _, ioError = file.Write(world[y]); ioError != nil {
+			io.fail(turn, "write image", filename, ioError)
+			return
 		}
 	}
 
-	ioError = file.Sync()
-	util.Check(ioError)
+	if ioError = file.Sync(); ioError != nil {
+		io.fail(turn, "write image", filename, ioError)
+		return
+	}
 
 	fmt.Println("File", filename, "output done!")
 }
 
-// readPgmImage opens a pgm file and sends its data as an array of bytes.
+// readPgmImage opens the PBM or PGM file at the path given by the distributor and sends the pixels of the image
+// chosen by Params.ImageIndex as an array of bytes, thresholded or scaled to grey levels between 0 and 255.
+// PNG, JPEG and GIF images are instead scaled to the size of the board and binarised to 0 and 255.
+// Whether the image could be read is sent first, and the pixels only if it could.
 func (io *ioState) readPgmImage() {
 
-	// Request a filename from the distributor.
-	filename := <-io.channels.filename
+	// Request a path from the distributor.
+	path := <-io.channels.filename
+
+	pixels, ioError := readImagePixels(path, io.params)
+	if ioError != nil {
+		io.channels.loaded <- io.fail(0, "read image", path, ioError)
+		return
+	}
+	io.channels.loaded <- nil
 
-	data, ioError := ioutil.ReadFile("images/" + filename + ".pgm")
-	util.Check(ioError)
+	for _, b := range pixels {
+		io.channels.input <- b
+	}
 
-	fields := strings.Fields(string(data))
+	fmt.Println("File", path, "input done!")
+}
 
-	if fields[0] != "P5" {
-		panic("Not a pgm file")
+// readImagePixels reads the pixels of the PBM, PGM, PNG, JPEG or GIF image at path, checking it is the size of the board.
+func readImagePixels(path string, p Params) ([]uint8, error) {
+	if _, isPhoto, _ := photoConfig(path); isPhoto {
+		return readPhoto(path, p)
 	}
 
-	width, _ := strconv.Atoi(fields[1])
-	if width != io.params.ImageWidth {
-		panic("Incorrect width")
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
+	defer file.Close()
 
-	height, _ := strconv.Atoi(fields[2])
-	if height != io.params.ImageHeight {
-		panic("Incorrect height")
+	image, err := readNetpbm(file, p.ImageIndex, false)
+	if err != nil {
+		return nil, err
+	}
+	if image.width != p.ImageWidth || image.height != p.ImageHeight {
+		return nil, fmt.Errorf("incorrect size %dx%d, not %dx%d", image.width, image.height, p.ImageWidth, p.ImageHeight)
 	}
+	return image.levels(p.AliveThreshold), nil
+}
 
-	maxval, _ := strconv.Atoi(fields[3])
-	if maxval != 255 {
-		panic("Incorrect maxval/bit depth")
+// ImageSize returns the width and height of the image at the given index of the PBM or PGM file at path,
+// or the size of the PNG, JPEG or GIF image, or RLE, plaintext or Life 1.06 pattern, at path.
+func ImageSize(path string, index int) (width, height int, err error) {
+	if loaded, isPattern, err := readPattern(path); isPattern {
+		return loaded.Width, loaded.Height, err
+	}
+	if config, isPhoto, err := photoConfig(path); isPhoto || err != nil {
+		return config.Width, config.Height, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	image, err := readNetpbm(file, index, true)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%v: %v", path, err)
 	}
+	return image.width, image.height, nil
+}
 
-	image := []byte(fields[4])
+// readPatternFile opens the pattern file at the path given by the distributor and sends back its cells.
+// Whether the file could be read is sent first.
+func (io *ioState) readPatternFile() {
 
-	for _, b := range image {
-		io.channels.input <- b
+	// Request a path from the distributor.
+	path := <-io.channels.filename
+
+	loaded, _, ioError := readPattern(path)
+	if ioError != nil {
+		io.channels.loaded <- io.fail(0, "read pattern", path, ioError)
+		return
+	}
+	io.channels.loaded <- nil
+	io.channels.patterns <- loaded
+
+	fmt.Println("File", path, "pattern input done!")
+}
+
+// writePatternFile receives the cells of the world and writes them to a pattern file in the snapshot format.
+func (io *ioState) writePatternFile() {
+	_ = os.Mkdir("out", os.ModePerm)
+
+	// Request a filename, the turn and the cells from the distributor.
+	filename := <-io.channels.filename
+	turn := <-io.channels.turn
+	snapshot := <-io.channels.patterns
+
+	format, ioError := pattern.ParseFormat(io.params.SnapshotFormat)
+	if ioError == nil {
+		var rule Rule
+		rule, ioError = ParseRule(io.params.Rule)
+		snapshot.Rule = rule.String()
+	}
+	if ioError == nil {
+		ioError = writeFile("out/"+filename+format.Extension(), func(file *os.File) error {
+			return pattern.Write(file, format, snapshot)
+		})
+	}
+	if ioError != nil {
+		io.fail(turn, "write pattern", filename, ioError)
+		return
+	}
+
+	fmt.Println("File", filename, "pattern output done!")
+}
+
+// writeFile creates the file at path, writes it with write and makes sure it reaches the disk.
+func writeFile(path string, write func(file *os.File) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeStatisticsRows receives the statistics of the turns collected from the broker and adds their populations to
+// the CSV file, creating the file with a header for the first batch. Once the file has failed to be created or written,
+// every later row is dropped.
+func (io *ioState) writeStatisticsRows() {
+	// Request a filename and the statistics from the distributor.
+	filename := <-io.channels.filename
+	statistics := <-io.channels.statistics
+
+	if io.statisticsFailed {
+		return
+	}
+	if io.statisticsFile == nil {
+		_ = os.Mkdir("out", os.ModePerm)
+		file, ioError := os.Create("out/" + filename + "-alive.csv")
+		if ioError != nil {
+			io.statisticsFailed = true
+			io.fail(statistics[0].CompletedTurns, "write statistics", filename, ioError)
+			return
+		}
+		io.statisticsFile = file
+		io.statisticsWriter = bufio.NewWriter(file)
+		io.statisticsName = filename
+		_, _ = io.statisticsWriter.WriteString("completed_turns,alive_cells\n")
+	}
+	for _, counts := range statistics {
+		io.statisticsTurn = counts.CompletedTurns
+		_, _ = fmt.Fprintf(io.statisticsWriter, "%d,%d\n", counts.CompletedTurns, counts.Population)
+	}
+}
+
+// closeStatistics finishes writing the population CSV file, if there is one.
+func (io *ioState) closeStatistics() {
+	if io.statisticsFile == nil {
+		return
 	}
+	ioError := io.statisticsWriter.Flush()
+	if closeError := io.statisticsFile.Close(); ioError == nil {
+		ioError = closeError
+	}
+	if ioError != nil {
+		io.fail(io.statisticsTurn, "write statistics", io.statisticsName, ioError)
+	}
+	io.statisticsFile, io.statisticsWriter = nil, nil
+}
 
-	fmt.Println("File", filename, "input done!")
+// fail reports a failure to read or write a file as an IOError event, instead of taking the whole process down,
+// and remembers the first failure for the distributor. The event is returned.
+func (io *ioState) fail(turn int, operation, filename string, err error) IOError {
+	failure := IOError{CompletedTurns: turn, Operation: operation, Filename: filename, Err: err}
+	fmt.Println("Error:", failure)
+	io.channels.events <- failure
+	if io.failure == nil {
+		io.failure = failure
+	}
+	return failure
 }
 
 // startIo should be the entrypoint of the io goroutine.
@@ -135,14 +319,25 @@ func startIo(p Params, c ioChannels) {
 	for {
 		select {
 		// Block and wait for requests from the distributor
-		case command := <-io.channels.command:
+		case command, ok := <-io.channels.command:
+			if !ok {
+				// The distributor has finished, so there will be no more requests
+				return
+			}
 			switch command {
 			case ioInput:
 				io.readPgmImage()
 			case ioOutput:
 				io.writePgmImage()
 			case ioCheckIdle:
-				io.channels.idle <- true
+				io.closeStatistics()
+				io.channels.idle <- io.failure
+			case ioInputPattern:
+				io.readPatternFile()
+			case ioOutputPattern:
+				io.writePatternFile()
+			case ioOutputStatistics:
+				io.writeStatisticsRows()
 			}
 		}
 	}
@@ -0,0 +1,224 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// netpbmImage is an image read from a netpbm file: a bitmap (PBM) or greymap (PGM), in the plain or raw encoding.
+// Bitmaps are read as greymaps with a maxval of 1, where the black pixels, 1 in the file, are the alive cells.
+type netpbmImage struct {
+	width, height int
+	maxval        int
+	pixels        []int
+	comments      []string
+}
+
+// levels returns the pixels of the image as grey levels between 0 and 255. Given a threshold above 0,
+// pixels at least that fraction of the maxval are alive, 255, and every other pixel dead, 0.
+func (image netpbmImage) levels(threshold float64) []uint8 {
+	levels := make([]uint8, len(image.pixels))
+	for i, v := range image.pixels {
+		if threshold > 0 {
+			if float64(v) >= threshold*float64(image.maxval) {
+				levels[i] = 255
+			}
+		} else {
+			levels[i] = uint8((v*255 + image.maxval/2) / image.maxval)
+		}
+	}
+	return levels
+}
+
+// readNetpbm reads the image at the given index of a netpbm file, which may hold several images one after another.
+// Only the header of the image is read when header is set, leaving its pixels nil.
+func readNetpbm(r io.Reader, index int, header bool) (netpbmImage, error) {
+	reader := bufio.NewReader(r)
+	for i := 0; ; i++ {
+		image, err := readNetpbmImage(reader, header && i == index)
+		if err == io.EOF {
+			if i == 0 {
+				return image, fmt.Errorf("empty netpbm file")
+			}
+			return image, fmt.Errorf("file holds %d images, so has no image %d", i, index)
+		}
+		if err != nil || i == index {
+			return image, err
+		}
+	}
+}
+
+// readNetpbmImage reads the next image from reader, returning io.EOF if there are none left.
+func readNetpbmImage(reader *bufio.Reader, header bool) (netpbmImage, error) {
+	var image netpbmImage
+
+	//Any whitespace between one image and the next, or at the end of the file, is skipped
+	magic, err := readToken(reader, &image.comments)
+	if err == io.EOF && magic == "" {
+		return image, io.EOF
+	}
+	if err != nil {
+		return image, err
+	}
+	bitmap, raw := false, false
+	switch magic {
+	case "P1":
+		bitmap = true
+	case "P2":
+	case "P4":
+		bitmap, raw = true, true
+	case "P5":
+		raw = true
+	default:
+		return image, fmt.Errorf("not a PBM or PGM image: starts with %q", magic)
+	}
+
+	if image.width, err = readNumber(reader, &image.comments); err != nil {
+		return image, err
+	}
+	if image.height, err = readNumber(reader, &image.comments); err != nil {
+		return image, err
+	}
+	if image.width <= 0 || image.height <= 0 {
+		return image, fmt.Errorf("invalid image size %dx%d", image.width, image.height)
+	}
+	image.maxval = 1
+	if !bitmap {
+		if image.maxval, err = readNumber(reader, &image.comments); err != nil {
+			return image, err
+		}
+		if image.maxval <= 0 || image.maxval > 65535 {
+			return image, fmt.Errorf("invalid maxval %d", image.maxval)
+		}
+	}
+	if raw {
+		//A single whitespace character separates the header from the pixels
+		if _, err := reader.ReadByte(); err != nil {
+			return image, fmt.Errorf("reading image header: %v", err)
+		}
+	}
+	if header {
+		return image, nil
+	}
+
+	image.pixels = make([]int, image.width*image.height)
+	switch {
+	case bitmap && raw:
+		//Rows of 8 pixels to a byte, the leftmost in the highest bit, with each row starting on a new byte
+		row := make([]byte, (image.width+7)/8)
+		for y := 0; y < image.height; y++ {
+			if _, err := io.ReadFull(reader, row); err != nil {
+				return image, fmt.Errorf("reading image pixels: %v", err)
+			}
+			for x := 0; x < image.width; x++ {
+				image.pixels[y*image.width+x] = int(row[x/8]>>uint(7-x%8)) & 1
+			}
+		}
+	case bitmap:
+		//Plain bitmaps need no whitespace between pixels, which are each a single 0 or 1
+		for i := range image.pixels {
+			c, err := skipSpace(reader, &image.comments)
+			if err != nil {
+				return image, fmt.Errorf("reading image pixels: %v", err)
+			}
+			if c != '0' && c != '1' {
+				return image, fmt.Errorf("invalid bitmap pixel %q", c)
+			}
+			image.pixels[i] = int(c - '0')
+		}
+	case raw:
+		//Pixels take two bytes, most significant first, when the maxval does not fit in one
+		size := 1
+		if image.maxval > 255 {
+			size = 2
+		}
+		data := make([]byte, size*len(image.pixels))
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return image, fmt.Errorf("reading image pixels: %v", err)
+		}
+		for i := range image.pixels {
+			if size == 2 {
+				image.pixels[i] = int(data[2*i])<<8 | int(data[2*i+1])
+			} else {
+				image.pixels[i] = int(data[i])
+			}
+		}
+	default:
+		for i := range image.pixels {
+			if image.pixels[i], err = readNumber(reader, &image.comments); err != nil {
+				return image, err
+			}
+		}
+	}
+	for _, v := range image.pixels {
+		if v > image.maxval {
+			return image, fmt.Errorf("pixel %d is above the maxval %d", v, image.maxval)
+		}
+	}
+	return image, nil
+}
+
+// skipSpace returns the next character of reader that is not whitespace or part of a comment,
+// adding each comment, from a '#' to the end of its line, to comments.
+func skipSpace(reader *bufio.Reader, comments *[]string) (byte, error) {
+	for {
+		c, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch c {
+		case ' ', '\t', '\n', '\r', '\v', '\f':
+		case '#':
+			line, err := reader.ReadString('\n')
+			*comments = append(*comments, strings.TrimSpace(line))
+			if err != nil {
+				return 0, err
+			}
+		default:
+			return c, nil
+		}
+	}
+}
+
+// readToken reads the next run of characters that are not whitespace, leaving the whitespace that ends it unread.
+func readToken(reader *bufio.Reader, comments *[]string) (string, error) {
+	c, err := skipSpace(reader, comments)
+	if err != nil {
+		return "", err
+	}
+	token := []byte{c}
+	for {
+		c, err := reader.ReadByte()
+		if err == io.EOF {
+			return string(token), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f' || c == '#' {
+			return string(token), reader.UnreadByte()
+		}
+		token = append(token, c)
+	}
+}
+
+// readNumber reads the next token as a decimal number.
+func readNumber(reader *bufio.Reader, comments *[]string) (int, error) {
+	token, err := readToken(reader, comments)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading image header: %v", err)
+	}
+	n := 0
+	for _, c := range token {
+		if c < '0' || c > '9' || n > 1<<24 {
+			return 0, fmt.Errorf("invalid number %q in image", token)
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, nil
+}
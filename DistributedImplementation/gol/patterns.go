@@ -0,0 +1,68 @@
+package gol
+
+import (
+	"fmt"
+	"os"
+
+	"uk.ac.bris.cs/gameoflife/pattern"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// readPattern reads the RLE, plaintext or Life 1.06 pattern at path, reporting false if path is not a pattern file,
+// going by its extension, and so names a PGM image.
+func readPattern(path string) (pattern.Pattern, bool, error) {
+	format, err := pattern.FormatOf(path)
+	if err != nil {
+		return pattern.Pattern{}, false, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return pattern.Pattern{}, true, err
+	}
+	defer file.Close()
+	loaded, err := pattern.Read(file, format)
+	if err != nil {
+		return pattern.Pattern{}, true, fmt.Errorf("%v: %v", path, err)
+	}
+	return loaded, true, nil
+}
+
+// placePattern returns the cell of the board the top left corner of the pattern is placed on,
+// checking that the whole pattern fits on the board.
+func placePattern(p Params, loaded pattern.Pattern) (util.Cell, error) {
+	corner := util.Cell{X: p.OffsetX, Y: p.OffsetY}
+	if p.Centre {
+		corner.X += (p.ImageWidth - loaded.Width) / 2
+		corner.Y += (p.ImageHeight - loaded.Height) / 2
+	}
+	if corner.X < 0 || corner.Y < 0 || corner.X+loaded.Width > p.ImageWidth || corner.Y+loaded.Height > p.ImageHeight {
+		return corner, fmt.Errorf("a %dx%d pattern at (%d, %d) does not fit on a %dx%d board",
+			loaded.Width, loaded.Height, corner.X, corner.Y, p.ImageWidth, p.ImageHeight)
+	}
+	return corner, nil
+}
+
+// patternBoard draws a pattern onto an empty board the size of the world, at the place given by the parameters.
+func patternBoard(p Params, loaded pattern.Pattern) [][]uint8 {
+	corner, err := placePattern(p, loaded)
+	util.Check(err)
+	board := make([][]uint8, p.ImageHeight)
+	for y := range board {
+		board[y] = make([]uint8, p.ImageWidth)
+	}
+	for _, cell := range loaded.Cells {
+		board[corner.Y+cell.Y][corner.X+cell.X] = 255
+	}
+	return board
+}
+
+// boardPattern returns the alive cells of the world as a pattern the size of the board, noting the turn.
+// Decaying cells of Generations rules are left out.
+func boardPattern(p Params, turn int, data func(y, x int) uint8) pattern.Pattern {
+	return pattern.Pattern{
+		Width:    p.ImageWidth,
+		Height:   p.ImageHeight,
+		Cells:    calculateAliveCells(p, data),
+		Comments: []string{fmt.Sprintf("Turn %d", turn)},
+	}
+}
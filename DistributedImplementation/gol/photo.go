@@ -0,0 +1,198 @@
+package gol
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"  // Registers the GIF decoder for image.Decode
+	_ "image/jpeg" // Registers the JPEG decoder for image.Decode
+	_ "image/png"  // Registers the PNG decoder for image.Decode
+	"os"
+	"strings"
+)
+
+// Binarisation is how the brightness of the pixels of a PNG, JPEG or GIF image turns into alive and dead cells.
+type Binarisation int
+
+const (
+	Threshold      Binarisation = iota // pixels at least Params.AliveThreshold of full brightness are alive, or half when it is 0
+	Otsu                               // the threshold is chosen by Otsu's method, to best split the pixels into dark and bright
+	FloydSteinberg                     // the error of every pixel is spread onto its neighbours, so the density of alive cells follows the brightness
+)
+
+var binarisationNames = []string{"threshold", "otsu", "dither"}
+
+// ParseBinarisation returns the binarisation with the given name: threshold, otsu or dither.
+func ParseBinarisation(name string) (Binarisation, error) {
+	for b, n := range binarisationNames {
+		if strings.EqualFold(name, n) {
+			return Binarisation(b), nil
+		}
+	}
+	return Threshold, fmt.Errorf("invalid binarisation %q: expected one of %v", name, strings.Join(binarisationNames, ", "))
+}
+
+func (b Binarisation) String() string {
+	if b < 0 || int(b) >= len(binarisationNames) {
+		return "Incorrect Binarisation"
+	}
+	return binarisationNames[b]
+}
+
+// photoConfig returns the size of the PNG, JPEG or GIF image at path. isPhoto is false, with no error,
+// when the file is in another format, such as a PBM or PGM image.
+func photoConfig(path string) (config image.Config, isPhoto bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return config, false, err
+	}
+	defer file.Close()
+	config, _, err = image.DecodeConfig(file)
+	if err == image.ErrFormat {
+		return config, false, nil
+	}
+	if err != nil {
+		return config, true, fmt.Errorf("%v: %v", path, err)
+	}
+	return config, true, nil
+}
+
+// readPhoto decodes the PNG, JPEG or GIF image at path, scales it to the size of the board and binarises it,
+// returning the pixel value of every cell, row by row: 255 when alive and 0 when dead.
+func readPhoto(path string, p Params) ([]uint8, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	photo, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	bounds := photo.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	brightness := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			grey := color.Gray16Model.Convert(photo.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray16)
+			brightness[y*width+x] = float64(grey.Y) / 0xFFFF
+			if p.Invert {
+				brightness[y*width+x] = 1 - brightness[y*width+x]
+			}
+		}
+	}
+	brightness = resize(brightness, width, height, p.ImageWidth, p.ImageHeight)
+
+	switch p.Binarisation {
+	case Otsu:
+		return threshold(brightness, otsuThreshold(brightness)), nil
+	case FloydSteinberg:
+		return dither(brightness, p.ImageWidth, p.ImageHeight), nil
+	}
+	if p.AliveThreshold > 0 {
+		return threshold(brightness, p.AliveThreshold), nil
+	}
+	return threshold(brightness, 0.5), nil
+}
+
+// resize scales an image of brightnesses from one size to another, averaging the pixels that fall within each new
+// pixel when shrinking it, and repeating pixels when enlarging it.
+func resize(brightness []float64, fromWidth, fromHeight, toWidth, toHeight int) []float64 {
+	if fromWidth == toWidth && fromHeight == toHeight {
+		return brightness
+	}
+	//span returns the pixels of the old image that new pixel i of n covers
+	span := func(i, n, from int) (int, int) {
+		start, end := i*from/n, (i+1)*from/n
+		if end == start {
+			end = start + 1
+		}
+		return start, end
+	}
+	resized := make([]float64, toWidth*toHeight)
+	for y := 0; y < toHeight; y++ {
+		y0, y1 := span(y, toHeight, fromHeight)
+		for x := 0; x < toWidth; x++ {
+			x0, x1 := span(x, toWidth, fromWidth)
+			sum := 0.0
+			for i := y0; i < y1; i++ {
+				for j := x0; j < x1; j++ {
+					sum += brightness[i*fromWidth+j]
+				}
+			}
+			resized[y*toWidth+x] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+	return resized
+}
+
+// threshold makes the pixels at least the given brightness alive.
+func threshold(brightness []float64, level float64) []uint8 {
+	cells := make([]uint8, len(brightness))
+	for i, b := range brightness {
+		if b >= level {
+			cells[i] = 255
+		}
+	}
+	return cells
+}
+
+// otsuThreshold returns the threshold that maximises the variance between the brightnesses of the pixels below it
+// and of the pixels at or above it, found from a histogram of 256 levels.
+func otsuThreshold(brightness []float64) float64 {
+	var histogram [256]int
+	for _, b := range brightness {
+		histogram[int(b*255+0.5)]++
+	}
+	total, sum := 0, 0
+	for level, count := range histogram {
+		total += count
+		sum += level * count
+	}
+
+	best, bestVariance := 128, -1.0
+	below, belowSum := 0, 0
+	for level := 1; level < 256; level++ {
+		//Pixels of brightness level-1 and darker are dead
+		below += histogram[level-1]
+		belowSum += (level - 1) * histogram[level-1]
+		above := total - below
+		if below == 0 || above == 0 {
+			continue
+		}
+		meanBelow := float64(belowSum) / float64(below)
+		meanAbove := float64(sum-belowSum) / float64(above)
+		variance := float64(below) * float64(above) * (meanAbove - meanBelow) * (meanAbove - meanBelow)
+		if variance > bestVariance {
+			best, bestVariance = level, variance
+		}
+	}
+	return (float64(best) - 0.5) / 255
+}
+
+// dither makes each pixel alive or dead by whether it is at least half brightness, spreading the difference between
+// its brightness and the state it takes over the pixels to its right and below, in the proportions of Floyd–Steinberg.
+func dither(brightness []float64, width, height int) []uint8 {
+	remaining := append([]float64(nil), brightness...)
+	cells := make([]uint8, len(brightness))
+	spread := func(y, x int, e float64) {
+		if y < height && x >= 0 && x < width {
+			remaining[y*width+x] += e
+		}
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			b := remaining[y*width+x]
+			if b >= 0.5 {
+				cells[y*width+x] = 255
+				b--
+			}
+			spread(y, x+1, b*7/16)
+			spread(y+1, x-1, b*3/16)
+			spread(y+1, x, b*5/16)
+			spread(y+1, x+1, b*1/16)
+		}
+	}
+	return cells
+}
@@ -0,0 +1,31 @@
+package gol
+
+import "uk.ac.bris.cs/gameoflife/rules"
+
+// DefaultRule is the rulestring of Conway's Game of Life, used when Params.Rule is empty.
+const DefaultRule = rules.DefaultRule
+
+// Rule is a Life-like, Generations or Larger than Life rule, parsed by the rules package shared with the broker
+// and the engines.
+type Rule = rules.Rule
+
+// ParseRule parses a rulestring as the broker and the engines do. See rules.ParseRule for the notations accepted.
+func ParseRule(rulestring string) (Rule, error) {
+	return rules.ParseRule(rulestring)
+}
+
+// Topology describes how the edges of the world are joined together, as the broker fills in the halo of each strip.
+type Topology = rules.Topology
+
+const (
+	Torus        = rules.Torus
+	Plane        = rules.Plane
+	Reflect      = rules.Reflect
+	KleinBottle  = rules.KleinBottle
+	CrossSurface = rules.CrossSurface
+)
+
+// ParseTopology returns the topology with the given name: torus, plane, reflect, klein or cross.
+func ParseTopology(name string) (Topology, error) {
+	return rules.ParseTopology(name)
+}
@@ -0,0 +1,146 @@
+package gol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Symmetry is a symmetry a random soup can be made with.
+type Symmetry int
+
+const (
+	NoSymmetry Symmetry = iota // every cell of the soup is chosen at random
+	C2                         // the soup looks the same turned through half a turn
+	C4                         // the soup looks the same turned through a quarter turn, so must be square
+	D8                         // the soup looks the same turned through a quarter turn or mirrored, so must be square
+)
+
+var symmetryNames = []string{"none", "C2", "C4", "D8"}
+
+// ParseSymmetry returns the symmetry with the given name: none, C2, C4 or D8.
+func ParseSymmetry(name string) (Symmetry, error) {
+	for s, n := range symmetryNames {
+		if strings.EqualFold(name, n) {
+			return Symmetry(s), nil
+		}
+	}
+	return NoSymmetry, fmt.Errorf("invalid symmetry %q: expected one of %v", name, strings.Join(symmetryNames, ", "))
+}
+
+func (s Symmetry) String() string {
+	if s < 0 || int(s) >= len(symmetryNames) {
+		return "Incorrect Symmetry"
+	}
+	return symmetryNames[s]
+}
+
+// Soup describes a random world to start from instead of an image. The same soup is made from the same seed
+// on every platform, by both the parallel and distributed implementations.
+type Soup struct {
+	Density  float64 // The chance of each cell of the soup being alive. A soup is only made when it is above 0.
+	Seed     uint64
+	Symmetry Symmetry
+
+	// Width and Height give the size of the soup, which is centred on an otherwise empty board.
+	// A 0 spans the whole board in that direction.
+	Width  int
+	Height int
+}
+
+// size returns the width and height of the soup on the board.
+func (s Soup) size(p Params) (width, height int) {
+	width, height = s.Width, s.Height
+	if width == 0 {
+		width = p.ImageWidth
+	}
+	if height == 0 {
+		height = p.ImageHeight
+	}
+	return width, height
+}
+
+// check returns an error if the soup cannot be made on the board.
+func (s Soup) check(p Params) error {
+	width, height := s.size(p)
+	if s.Density < 0 || s.Density > 1 {
+		return fmt.Errorf("invalid soup density %v", s.Density)
+	}
+	if s.Symmetry < NoSymmetry || s.Symmetry > D8 {
+		return fmt.Errorf("invalid soup symmetry %v", s.Symmetry)
+	}
+	if width <= 0 || height <= 0 || width > p.ImageWidth || height > p.ImageHeight {
+		return fmt.Errorf("a %dx%d soup does not fit on a %dx%d board", width, height, p.ImageWidth, p.ImageHeight)
+	}
+	if (s.Symmetry == C4 || s.Symmetry == D8) && width != height {
+		return fmt.Errorf("a %v soup must be square, not %dx%d", s.Symmetry, width, height)
+	}
+	return nil
+}
+
+// soupBoard returns the board with the soup drawn onto its centre.
+// A random number is drawn for every cell of the soup in turn, row by row, with only integer arithmetic, so that
+// the board is the same on every platform. A cell of a symmetric soup takes the number of the first cell it is
+// mapped onto by the symmetry.
+func soupBoard(p Params) [][]uint8 {
+	s := p.Soup
+	width, height := s.size(p)
+	random := splitMix64(s.Seed)
+	limit := uint64(s.Density * (1 << 53))
+	alive := make([]bool, width*height)
+	for i := range alive {
+		alive[i] = random.next()>>11 < limit
+	}
+
+	board := make([][]uint8, p.ImageHeight)
+	for y := range board {
+		board[y] = make([]uint8, p.ImageWidth)
+	}
+	left, top := (p.ImageWidth-width)/2, (p.ImageHeight-height)/2
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if alive[s.first(y, x, width, height)] {
+				board[top+y][left+x] = 255
+			}
+		}
+	}
+	return board
+}
+
+// first returns the index, row by row, of the first cell of the soup that the symmetry maps cell (y, x) onto.
+func (s Soup) first(y, x, width, height int) int {
+	first := y*width + x
+	consider := func(y, x int) {
+		if i := y*width + x; i < first {
+			first = i
+		}
+	}
+	switch s.Symmetry {
+	case C2:
+		consider(height-1-y, width-1-x)
+	case C4, D8:
+		//Quarter turns of a square soup, and for D8, quarter turns of its mirror image
+		starts := [][2]int{{y, x}}
+		if s.Symmetry == D8 {
+			starts = append(starts, [2]int{y, width - 1 - x})
+		}
+		for _, start := range starts {
+			cy, cx := start[0], start[1]
+			for turn := 0; turn < 4; turn++ {
+				consider(cy, cx)
+				cy, cx = cx, width-1-cy
+			}
+		}
+	}
+	return first
+}
+
+// splitMix64 is the SplitMix64 random number generator, whose numbers depend on nothing but its seed.
+type splitMix64 uint64
+
+func (s *splitMix64) next() uint64 {
+	*s += 0x9E3779B97F4A7C15
+	z := uint64(*s)
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
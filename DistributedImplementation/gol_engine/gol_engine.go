@@ -7,6 +7,8 @@ import (
 	"net"
 	"net/rpc"
 	"sync"
+
+	"uk.ac.bris.cs/gameoflife/rules"
 )
 
 const (
@@ -25,77 +27,55 @@ type EngineStateRequest struct {
 	State int
 }
 
+// StartEngineRequest holds one strip of the world, rows StartHeight to EndHeight, in GolWorld.
+// The strip is surrounded by a halo of as many cells as the radius of the rule on every side.
+// The broker fills the halo according to the topology of the world, so engines never wrap coordinates themselves.
 type StartEngineRequest struct {
 	GolWorld [][]uint8
 	ImageHeight int
 	ImageWidth int
 	StartHeight int
 	EndHeight int
+	Rule string
 }
 
+// StartEngineResponse holds the next state of the strip, with how many of its cells were born and how many died.
 type StartEngineResponse struct {
 	GolWorld [][]uint8
+	Births int
+	Deaths int
 }
 
 
 type EmptyRpcResponse struct {}
 
-func makeImmutableMatrix(matrix [][]uint8) func(y, x int) uint8 {
-	return func(y, x int) uint8 {
-		return matrix[y][x]
-	}
-}
+//Input: strip, the rows to process surrounded by a halo of rule.Radius cells on every side
+//Input: rule, deciding which neighbour counts cause births, survivals, deaths and decay
+//Returns: the next state of the rows inside the halo
+//Returns: how many cells were born, and how many died (including alive cells starting to decay)
+func calculateNextState(strip [][]uint8, rule rules.Rule) ([][]uint8, int, int) {
+	r := rule.Radius
 
-func calculateNextState(imageHeight, imageWidth, startY, endY int, data func(y, x int) uint8) [][]uint8 {
+	//find number of neighbours alive for every cell in the strip
+	aliveNeighbours := neighbourCounts(strip, rule)
 
-	//Create future state of world
-	future := make([][]uint8, imageHeight)
+	//Create future state of the strip, without its halo
+	future := make([][]uint8, len(aliveNeighbours))
+	births, deaths := 0, 0
 	for i := range future {
-		future[i] = make([]uint8, imageWidth)
-	}
-
-	//Loop through every cell in given range
-	for i := startY; i < endY; i++ {
-		for j := 0; j < imageWidth; j++ {
-
-			//find number of neighbours alive
-			aliveNeighbours := 0
-			for n := -1; n < 2; n++ {
-				for m := -1; m < 2; m++ {
-					// Adjusting for edge cases (closed domain)
-					x := (i + n + imageHeight) % imageHeight
-					y := (j + m + imageWidth) % imageWidth
-
-					if data(x,y) == 255 { // Checks if each neighbour cell is alive
-						aliveNeighbours++
-					}
-				}
-			}
-
-			//Adjusts in case current cell is also alive (it would have got counted in the above calculations but is not a neighbour)
-			if data(i, j) == 255 {
-				aliveNeighbours -= 1
-			}
-
-			//Implement rules of life
-			if (data(i, j) == 255) && (aliveNeighbours < 2) { 				//cell is alive but lonely and dies
-				future[i][j] = 0
-				//c.events <- CellFlipped{CompletedTurns: turn, Cell: util.Cell{X: j, Y: i}}
-			} else if (data(i, j) == 255) && (aliveNeighbours > 3) {     	//cell dies due to overpopulation
-				future[i][j] = 0
-				//c.events <- CellFlipped{CompletedTurns: turn, Cell: util.Cell{X: j, Y: i}}
-			} else if (data(i, j) == 0) && (aliveNeighbours == 3) {    		//a new cell is born
-				future[i][j] = 255
-				//c.events <- CellFlipped{CompletedTurns: turn, Cell: util.Cell{X: j, Y: i}}
-			} else {
-				future[i][j] = data(i, j)									//no change
+		future[i] = make([]uint8, len(aliveNeighbours[i]))
+		for j := range future[i] {
+			//Implement rules of life: births, survivals, deaths and decay
+			current := strip[i+r][j+r]
+			future[i][j] = rule.Next(current, aliveNeighbours[i][j])
+			if future[i][j] == 255 && current != 255 {
+				births++
+			} else if current == 255 && future[i][j] != 255 {
+				deaths++
 			}
 		}
 	}
-
-	//trim future world
-	future = future[startY:endY]
-	return future
+	return future, births, deaths
 }
 
 type GoLOperations struct {
@@ -124,9 +104,15 @@ func (g *GoLOperations) getGolWorld() [][]uint8 {
 
 func (g *GoLOperations) RunEngine(req StartEngineRequest, res *StartEngineResponse) (err error) {
 	fmt.Println("GoLOperations.RunEngine")
-	//Processing only the strip of the image, then return that strip in the response
-	newStripData := calculateNextState(req.ImageHeight, req.ImageWidth, req.StartHeight, req.EndHeight, makeImmutableMatrix(req.GolWorld))
+	rule, err := rules.ParseRule(req.Rule)
+	if err != nil {
+		return err
+	}
+	//Processing only the strip of the image, then return that strip (without its halo) in the response
+	newStripData, births, deaths := calculateNextState(req.GolWorld, rule)
 	res.GolWorld = newStripData
+	res.Births = births
+	res.Deaths = deaths
 	return
 }
 
@@ -0,0 +1,62 @@
+package main
+
+import "uk.ac.bris.cs/gameoflife/rules"
+
+// neighbourCounts returns the number of alive neighbours of every cell inside the halo of a strip.
+// The strip holds the rows to process surrounded by a halo of rule.Radius cells on every side, as built by the broker.
+// Moore neighbourhoods are counted with a summed-area table and von Neumann neighbourhoods with a sliding window
+// along each row, so the cost per cell does not grow with the square of the radius.
+func neighbourCounts(strip [][]uint8, rule rules.Rule) [][]int {
+	r := rule.Radius
+	height, width := len(strip)-2*r, len(strip[0])-2*r
+
+	//prefix[y][x] holds the alive cells of rows up to y (exclusive) and columns up to x (exclusive),
+	//or for von Neumann neighbourhoods the alive cells of row y before column x
+	prefix := make([][]int32, len(strip)+1)
+	for i := range prefix {
+		prefix[i] = make([]int32, len(strip[0])+1)
+	}
+	for i, row := range strip {
+		for j, cell := range row {
+			alive := int32(0)
+			if cell == 255 {
+				alive = 1
+			}
+			if rule.Neighbourhood == rules.VonNeumann {
+				prefix[i][j+1] = prefix[i][j] + alive
+			} else {
+				prefix[i+1][j+1] = prefix[i+1][j] + prefix[i][j+1] - prefix[i][j] + alive
+			}
+		}
+	}
+
+	counts := make([][]int, height)
+	for i := range counts {
+		counts[i] = make([]int, width)
+		for j := range counts[i] {
+			var count int32
+			if rule.Neighbourhood == rules.VonNeumann {
+				for n := -r; n <= r; n++ {
+					reach := r - abs(n)
+					row := prefix[i+r+n]
+					count += row[j+r+reach+1] - row[j+r-reach]
+				}
+			} else {
+				count = prefix[i+2*r+1][j+2*r+1] - prefix[i][j+2*r+1] - prefix[i+2*r+1][j] + prefix[i][j]
+			}
+			//The cell itself is inside the window, but only counts as its own neighbour for M1 rules
+			if !rule.Middle && strip[i+r][j+r] == 255 {
+				count--
+			}
+			counts[i][j] = int(count)
+		}
+	}
+	return counts
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// writeImage writes a binary PGM image of the given size with the given cells alive.
+func writeImage(path string, width, height int, alive []util.Cell) {
+	pixels := make([]byte, width*height)
+	for _, cell := range alive {
+		pixels[cell.Y*width+cell.X] = 255
+	}
+	file, err := os.Create(path)
+	util.Check(err)
+	defer file.Close()
+	_, err = fmt.Fprintf(file, "P5\n%d %d\n255\n", width, height)
+	util.Check(err)
+	_, err = file.Write(pixels)
+	util.Check(err)
+}
+
+// TestInputImage loads a glider on a 37x23 torus from an explicit path, with the size read from the image header.
+// Every 4 turns the glider moves one cell down and to the right, so after 92 turns it is back on the same rows,
+// 23 cells to the right.
+func TestInputImage(t *testing.T) {
+	glider := []util.Cell{{X: 1, Y: 0}, {X: 2, Y: 1}, {X: 0, Y: 2}, {X: 1, Y: 2}, {X: 2, Y: 2}}
+	path := filepath.Join(t.TempDir(), "glider.pgm")
+	writeImage(path, 37, 23, glider)
+	var expected []util.Cell
+	for _, cell := range glider {
+		expected = append(expected, util.Cell{X: (cell.X + 23) % 37, Y: cell.Y})
+	}
+
+	p := gol.Params{Input: path, Turns: 92, Threads: 4}
+	events := make(chan gol.Event)
+	go func() {
+		if err := gol.Run(p, events, nil); err != nil {
+			t.Error(err)
+		}
+	}()
+	for event := range events {
+		if e, ok := event.(gol.FinalTurnComplete); ok {
+			p.ImageWidth, p.ImageHeight = 37, 23
+			assertEqualBoard(t, e.Alive, expected, p)
+		}
+	}
+}
+
+// TestInputImageRejected checks that a size given alongside an input image must agree with its header,
+// and that missing or malformed images are rejected before the broker is called.
+func TestInputImageRejected(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "image.pgm")
+	writeImage(image, 20, 10, nil)
+	text := filepath.Join(dir, "text.pgm")
+	util.Check(os.WriteFile(text, []byte("not an image\n"), 0644))
+
+	tests := []gol.Params{
+		{Input: image, ImageWidth: 10, ImageHeight: 20},
+		{Input: image, ImageHeight: 20},
+		{Input: filepath.Join(dir, "missing.pgm")},
+		{Input: text},
+		{},
+	}
+	for _, p := range tests {
+		p.Turns, p.Threads = 1, 1
+		events := make(chan gol.Event)
+		if err := gol.Run(p, events, nil); err == nil {
+			t.Errorf("expected %+v to be rejected", p)
+		}
+		if _, ok := <-events; ok {
+			t.Errorf("expected events to be closed")
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestIOErrorRead checks that a missing image is reported as an IOError event, rather than a panic,
+// and that gol.Run returns it without contacting the broker.
+func TestIOErrorRead(t *testing.T) {
+	p := gol.Params{ImageWidth: 30, ImageHeight: 30, Turns: 1, Threads: 2}
+	events := make(chan gol.Event)
+	result := make(chan error)
+	go func() {
+		result <- gol.Run(p, events, nil)
+	}()
+
+	var reported []gol.IOError
+	for event := range events {
+		switch e := event.(type) {
+		case gol.IOError:
+			reported = append(reported, e)
+		default:
+			t.Errorf("unexpected event %T received for a missing image", event)
+		}
+	}
+	if len(reported) != 1 || reported[0].Operation != "read image" || reported[0].Filename != "images/30x30.pgm" {
+		t.Fatalf("expected one IOError reading images/30x30.pgm, got %v", reported)
+	}
+	err := <-result
+	if ioError, ok := err.(gol.IOError); !ok || ioError.Operation != "read image" || ioError.CompletedTurns != 0 {
+		t.Errorf("expected gol.Run to return the IOError, got %v", err)
+	}
+}
+
+// TestIOErrorWrite checks that an output image that cannot be written is reported as an IOError event,
+// while the run still finishes, and that gol.Run returns it.
+func TestIOErrorWrite(t *testing.T) {
+	//A directory in the way of the output image makes it impossible to create, even as root
+	_ = os.Mkdir("out", os.ModePerm)
+	blocked := "out/16x16x0.pgm"
+	util.Check(os.RemoveAll(blocked))
+	util.Check(os.MkdirAll(blocked, os.ModePerm))
+	defer os.RemoveAll(blocked)
+
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 0, Threads: 2}
+	events := make(chan gol.Event)
+	result := make(chan error)
+	go func() {
+		result <- gol.Run(p, events, nil)
+	}()
+
+	var reported []gol.IOError
+	final := false
+	for event := range events {
+		switch e := event.(type) {
+		case gol.IOError:
+			reported = append(reported, e)
+		case gol.FinalTurnComplete:
+			final = true
+		}
+	}
+	if !final {
+		t.Error("expected the run to finish")
+	}
+	if len(reported) != 1 || reported[0].Operation != "write image" || reported[0].Filename != "16x16x0" {
+		t.Fatalf("expected one IOError writing 16x16x0, got %v", reported)
+	}
+	if _, ok := (<-result).(gol.IOError); !ok {
+		t.Error("expected gol.Run to return an IOError")
+	}
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"image/color"
+	"os"
+	"os/signal"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
+	"uk.ac.bris.cs/gameoflife/eventlog"
 	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/record"
 	"uk.ac.bris.cs/gameoflife/sdl"
 )
 
@@ -23,14 +32,14 @@ func main() {
 	flag.IntVar(
 		&params.ImageWidth,
 		"w",
-		512,
-		"Specify the width of the image. Defaults to 512.")
+		0,
+		"Specify the width of the image. Defaults to 512, or the width of the input image.")
 
 	flag.IntVar(
 		&params.ImageHeight,
 		"h",
-		512,
-		"Specify the height of the image. Defaults to 512.")
+		0,
+		"Specify the height of the image. Defaults to 512, or the height of the input image.")
 
 	flag.IntVar(
 		&params.Turns,
@@ -38,31 +47,419 @@ func main() {
 		10000000000,
 		"Specify the number of turns to process. Defaults to 10000000000.")
 
+	flag.StringVar(
+		&params.Rule,
+		"rule",
+		"",
+		"Specify the rule in B/S notation, e.g. B36/S23 for HighLife. Defaults to the rule of the input pattern, or B3/S23.")
+
+	flag.StringVar(
+		&params.Input,
+		"input",
+		"",
+		"Specify the path of the PBM or PGM image, or RLE, .cells or Life 1.06 pattern, to start from. Defaults to images/<w>x<h>.pgm.")
+
+	flag.IntVar(
+		&params.ImageIndex,
+		"image",
+		0,
+		"Specify which image to start from when the input file holds several, counting from 0. Defaults to 0.")
+
+	flag.Float64Var(
+		&params.AliveThreshold,
+		"threshold",
+		0,
+		"Specify the fraction of the maxval at which pixels of the input image are alive. Defaults to 0, snapping grey levels to the states of the rule.")
+
+	binarisation := flag.String(
+		"binarise",
+		"threshold",
+		"Specify how a PNG, JPEG or GIF input image becomes alive and dead cells: threshold, otsu or dither. Defaults to threshold.")
+
+	flag.BoolVar(
+		&params.Invert,
+		"invert",
+		false,
+		"Makes the dark pixels of a PNG, JPEG or GIF input image alive instead of the bright ones.")
+
+	flag.Float64Var(
+		&params.Soup.Density,
+		"soup",
+		0,
+		"Specify the density of a random soup to start from instead of an input image, between 0 and 1. Defaults to 0, for no soup.")
+
+	flag.Uint64Var(
+		&params.Soup.Seed,
+		"seed",
+		1,
+		"Specify the seed of the random soup. The same seed makes the same soup on every platform. Defaults to 1.")
+
+	symmetry := flag.String(
+		"symmetry",
+		"none",
+		"Specify the symmetry of the random soup: none, C2, C4 or D8. Defaults to none.")
+
+	soupSize := flag.String(
+		"soupSize",
+		"",
+		"Specify the size WxH of the random soup, centred on an empty board. Defaults to the size of the board.")
+
+	offset := flag.String(
+		"offset",
+		"0,0",
+		"Specify how far to move a pattern right and down, as X,Y. Defaults to 0,0.")
+
+	flag.BoolVar(
+		&params.Centre,
+		"centre",
+		true,
+		"Centres a pattern on the board before moving it by the offset, instead of starting from the top left corner.")
+
+	flag.StringVar(
+		&params.SnapshotFormat,
+		"snapshot",
+		"pgm",
+		"Specify the format of snapshots saved with 's': pgm, rle, cells or lif. Defaults to pgm.")
+
+	topology := flag.String(
+		"topology",
+		"torus",
+		"Specify how the edges of the world are joined: torus, plane, reflect, klein or cross. Defaults to torus.")
+
+	recordFormat := flag.String(
+		"record",
+		"",
+		"Records the run as an animated GIF (gif) or a numbered sequence of PNG images (png) in out/. Defaults to no recording.")
+
+	var recording record.Options
+	flag.IntVar(
+		&recording.Every,
+		"recordEvery",
+		1,
+		"Specify the number of turns between recorded frames. Defaults to 1.")
+
+	flag.IntVar(
+		&recording.Scale,
+		"recordScale",
+		1,
+		"Specify the width and height in pixels of each cell of the recording. Defaults to 1.")
+
+	flag.DurationVar(
+		&recording.Delay,
+		"recordDelay",
+		100*time.Millisecond,
+		"Specify how long each frame of a recorded GIF is shown for. Defaults to 100ms.")
+
+	flag.IntVar(
+		&recording.MaxFrames,
+		"recordMaxFrames",
+		0,
+		"Specify the most frames a recorded GIF holds, after which frames are taken less often. Defaults to 1000.")
+
+	colours := flag.String(
+		"recordColours",
+		"ffffff,000000",
+		"Specify the colours of alive and dead cells in the recording, as rrggbb,rrggbb. Defaults to white on black.")
+
+	retries := flag.Int(
+		"retries",
+		0,
+		"Specify how many times to start again when the starting world cannot be read. Defaults to 0.")
+
+	retryDelay := flag.Duration(
+		"retryDelay",
+		5*time.Second,
+		"Specify how long to wait before starting again when the starting world cannot be read. Defaults to 5s.")
+
+	abortOnIOError := flag.Bool(
+		"abortOnIOError",
+		false,
+		"Quits the run, as if 'q' was pressed, as soon as a file cannot be written, instead of carrying on.")
+
+	eventLog := flag.String(
+		"eventLog",
+		"",
+		"Specify a file to log every event of the run to, one JSON object to a line, to be replayed later. Defaults to no log.")
+
+	replay := flag.String(
+		"replay",
+		"",
+		"Specify an event log to replay in the SDL window instead of running the Game of Life.")
+
+	replaySpeed := flag.Float64(
+		"replaySpeed",
+		1,
+		"Specify how many times faster than it was logged a run is replayed, or 0 for as fast as possible. Defaults to 1.")
+
 	noVis := flag.Bool(
 		"noVis",
 		false,
 		"Disables the SDL window, so there is no visualisation during the tests.")
 
+	flag.BoolVar(
+		&params.NoFlips,
+		"noFlips",
+		false,
+		"Sends no events for the cells that change, for headless runs. Recordings are then left blank.")
+
+	flag.BoolVar(
+		&params.PopulationCSV,
+		"csv",
+		false,
+		"Writes the number of alive cells after every turn to a CSV file in out/.")
+
 	flag.Parse()
 
+	//A replay shows a logged run again instead of running one
+	if *replay != "" {
+		if err := replayLog(*replay, *replaySpeed, *noVis); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if _, err := fmt.Sscanf(*offset, "%d,%d", &params.OffsetX, &params.OffsetY); err != nil {
+		fmt.Println("Error: invalid offset", *offset)
+		os.Exit(1)
+	}
+
+	//The size of the world is read from the input image or pattern unless it is given
+	if params.Input != "" {
+		width, height, err := gol.ImageSize(params.Input, params.ImageIndex)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if params.ImageWidth == 0 {
+			params.ImageWidth = width
+		}
+		if params.ImageHeight == 0 {
+			params.ImageHeight = height
+		}
+	}
+	if params.ImageWidth == 0 {
+		params.ImageWidth = 512
+	}
+	if params.ImageHeight == 0 {
+		params.ImageHeight = 512
+	}
+
 	fmt.Println("Threads:", params.Threads)
+	if params.Input != "" {
+		fmt.Println("Input:", params.Input)
+	}
 	fmt.Println("Width:", params.ImageWidth)
 	fmt.Println("Height:", params.ImageHeight)
 
+	rule, err := gol.ParseRule(params.Rule)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if params.Rule == "" && params.Input != "" {
+		//A pattern can give its own rule, which inspecting the input fills in once the run starts
+		fmt.Println("Rule: the input pattern's, or", rule)
+	} else {
+		fmt.Println("Rule:", rule)
+	}
+
+	params.Binarisation, err = gol.ParseBinarisation(*binarisation)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	params.Soup.Symmetry, err = gol.ParseSymmetry(*symmetry)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if *soupSize != "" {
+		if _, err := fmt.Sscanf(*soupSize, "%dx%d", &params.Soup.Width, &params.Soup.Height); err != nil {
+			fmt.Println("Error: invalid soup size", *soupSize)
+			os.Exit(1)
+		}
+	}
+
+	params.Topology, err = gol.ParseTopology(*topology)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Topology:", params.Topology)
+
+	//Events reach the SDL window through the recorder when the run is being recorded
+	var recordingOptions *record.Options
+	if *recordFormat != "" {
+		recording.Format, err = record.ParseFormat(*recordFormat)
+		if err == nil {
+			recording.Alive, recording.Dead, err = parseColours(*colours)
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		recording.Name = "out/" + strconv.Itoa(params.ImageWidth) + "x" + strconv.Itoa(params.ImageHeight) + "x" + strconv.Itoa(params.Turns)
+		recordingOptions = &recording
+		fmt.Println("Recording:", recording.Name, recording.Format)
+	}
+
+	//A starting world that cannot be read, such as an image still being copied in, is tried again
+	for attempt := 0; ; attempt++ {
+		err := run(params, recordingOptions, *eventLog, *noVis, *abortOnIOError)
+		if err == nil {
+			break
+		}
+		fmt.Println("Error:", err)
+		ioError, isIOError := err.(gol.IOError)
+		if !isIOError || !strings.HasPrefix(ioError.Operation, "read") || attempt >= *retries {
+			os.Exit(1)
+		}
+		fmt.Println("Retrying in", *retryDelay)
+		time.Sleep(*retryDelay)
+	}
+}
+
+// run runs the Game of Life once, showing it in the SDL window unless noVis is set, and returns the error of gol.Run.
+// Every event is logged to the file at eventLog unless it is empty.
+// With abortOnIOError, the first IOError quits the run as if 'q' was pressed. Ctrl-C cancels the run.
+func run(params gol.Params, recording *record.Options, eventLog string, noVis, abortOnIOError bool) error {
+	var logger *eventlog.Writer
+	if eventLog != "" {
+		var err error
+		if logger, err = eventlog.Create(eventLog, params); err != nil {
+			return err
+		}
+	}
+	var recorder *record.Recorder
+	if recording != nil {
+		var err error
+		if recorder, err = record.New(params, *recording); err != nil {
+			return err
+		}
+	}
+
 	keyPresses := make(chan rune, 10)
 	events := make(chan gol.Event, 1000)
+	var shown <-chan gol.Event = events
+	if logger != nil {
+		logged := make(chan gol.Event, 1000)
+		go logger.Relay(shown, logged)
+		shown = logged
+	}
+	if recorder != nil {
+		recorded := make(chan gol.Event, 1000)
+		go recorder.Relay(shown, recorded)
+		shown = recorded
+	}
+	if abortOnIOError {
+		watched := make(chan gol.Event, 1000)
+		go quitOnIOError(shown, watched, keyPresses)
+		shown = watched
+	}
 
-	go gol.Run(params, events, keyPresses)
-	if !(*noVis) {
+	//Interrupting cancels the run, which still lets the io goroutine finish writing
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		select {
+		case <-interrupts:
+			fmt.Println("Interrupted")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	result := make(chan error, 1)
+	go func() {
+		turns, err := gol.RunContext(ctx, params, events, keyPresses)
+		if err == context.Canceled {
+			err = fmt.Errorf("cancelled after %d turns", turns)
+		}
+		result <- err
+	}()
+	if !noVis {
+		sdl.Run(params, shown, keyPresses)
+	}
+	//Wait for events to be closed, once the io goroutine has finished writing and its last failures are known
+	for range shown {
+	}
+	err := <-result
+
+	if recorder != nil {
+		if recordError := recorder.Err(); recordError != nil && err == nil {
+			err = fmt.Errorf("recording: %v", recordError)
+		}
+	}
+	if logger != nil {
+		if logError := logger.Err(); logError != nil && err == nil {
+			err = fmt.Errorf("event log: %v", logError)
+		}
+	}
+	return err
+}
+
+// replayLog replays the event log at path in the SDL window, or without showing it if noVis is set,
+// at the given speed. Pressing 'p' pauses the replay and 'q' ends it.
+func replayLog(path string, speed float64, noVis bool) error {
+	if speed < 0 {
+		return fmt.Errorf("invalid replay speed %v", speed)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader, err := eventlog.NewReader(file)
+	if err != nil {
+		return err
+	}
+	params := reader.Params()
+	fmt.Println("Replaying:", path)
+	fmt.Println("Width:", params.ImageWidth)
+	fmt.Println("Height:", params.ImageHeight)
+
+	keyPresses := make(chan rune, 10)
+	events := make(chan gol.Event, 1000)
+	result := make(chan error, 1)
+	go func() {
+		result <- eventlog.Replay(reader, speed, events, keyPresses)
+	}()
+	if !noVis {
 		sdl.Run(params, events, keyPresses)
-	} else {
-		complete := false
-		for !complete {
-			event := <-events
-			switch event.(type) {
-			case gol.FinalTurnComplete:
-				complete = true
-			}
+	}
+	for range events {
+	}
+	return <-result
+}
+
+// quitOnIOError passes events from in to out, closing out once in is closed, and presses 'q' on the first IOError.
+func quitOnIOError(in <-chan gol.Event, out chan<- gol.Event, keyPresses chan<- rune) {
+	quitting := false
+	for event := range in {
+		if _, isIOError := event.(gol.IOError); isIOError && !quitting {
+			quitting = true
+			fmt.Println("Quitting after an IO error")
+			keyPresses <- 'q'
 		}
+		out <- event
+	}
+	close(out)
+}
+
+// parseColours parses the colours of alive and dead cells, given as rrggbb,rrggbb.
+func parseColours(s string) (alive, dead color.RGBA, err error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return alive, dead, fmt.Errorf("invalid colours %q: expected rrggbb,rrggbb", s)
+	}
+	if alive, err = record.ParseColour(parts[0]); err != nil {
+		return alive, dead, err
 	}
+	dead, err = record.ParseColour(parts[1])
+	return alive, dead, err
 }
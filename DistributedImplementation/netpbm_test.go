@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestNetpbm loads a glider on a 37x23 torus from a plain bitmap with comments in its header, from a raw bitmap
+// that is the second image of its file, and from a plain greymap with a threshold, checking it after 92 turns.
+func TestNetpbm(t *testing.T) {
+	dir := t.TempDir()
+	glider := []util.Cell{{X: 1, Y: 0}, {X: 2, Y: 1}, {X: 0, Y: 2}, {X: 1, Y: 2}, {X: 2, Y: 2}}
+	alive := make(map[util.Cell]bool)
+	for _, cell := range glider {
+		alive[cell] = true
+	}
+	var expected []util.Cell
+	for _, cell := range glider {
+		expected = append(expected, util.Cell{X: (cell.X + 23) % 37, Y: cell.Y})
+	}
+
+	var plain, raw, grey bytes.Buffer
+	plain.WriteString("P1\n# A glider\n37 # width\n23\n")
+	raw.WriteString("P4 37 23\n")
+	grey.WriteString("P2 37 23 100\n")
+	for y := 0; y < 23; y++ {
+		packed := make([]byte, (37+7)/8)
+		for x := 0; x < 37; x++ {
+			if alive[util.Cell{X: x, Y: y}] {
+				plain.WriteString("1")
+				packed[x/8] |= 0x80 >> uint(x%8)
+				grey.WriteString("60 ")
+			} else {
+				plain.WriteString("0")
+				grey.WriteString("30 ")
+			}
+		}
+		plain.WriteString("\n")
+		raw.Write(packed)
+		grey.WriteString("\n")
+	}
+
+	plainPath := filepath.Join(dir, "glider.pbm")
+	util.Check(os.WriteFile(plainPath, plain.Bytes(), 0644))
+	rawPath := filepath.Join(dir, "two.pbm")
+	util.Check(os.WriteFile(rawPath, append(append([]byte{}, plain.Bytes()...), raw.Bytes()...), 0644))
+	greyPath := filepath.Join(dir, "glider.pgm")
+	util.Check(os.WriteFile(greyPath, grey.Bytes(), 0644))
+
+	tests := []gol.Params{
+		{Input: plainPath},
+		{Input: rawPath, ImageIndex: 1},
+		{Input: greyPath, AliveThreshold: 0.5},
+	}
+	for _, p := range tests {
+		p.Turns, p.Threads = 92, 4
+		t.Run(filepath.Base(p.Input), func(t *testing.T) {
+			events := make(chan gol.Event)
+			go func() {
+				if err := gol.Run(p, events, nil); err != nil {
+					t.Error(err)
+				}
+			}()
+			for event := range events {
+				if e, ok := event.(gol.FinalTurnComplete); ok {
+					p.ImageWidth, p.ImageHeight = 37, 23
+					assertEqualBoard(t, e.Alive, expected, p)
+				}
+			}
+		})
+	}
+
+	p := gol.Params{Input: rawPath, ImageIndex: 2, Turns: 1, Threads: 1}
+	if err := gol.Run(p, make(chan gol.Event), nil); err == nil {
+		t.Errorf("expected image 2 of 2 to be rejected")
+	}
+}
+
+// TestPgmMetadata checks that the turn and rule are recorded in comments in the header of the final image.
+func TestPgmMetadata(t *testing.T) {
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 7, Threads: 2, Rule: "B36/S23"}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	turn := -1
+	for event := range events {
+		if e, ok := event.(gol.FinalTurnComplete); ok {
+			turn = e.CompletedTurns
+		}
+	}
+	data, err := os.ReadFile(fmt.Sprintf("out/16x16x%d.pgm", turn))
+	util.Check(err)
+	header := string(data[:bytes.Index(data, []byte("255\n"))])
+	for _, comment := range []string{fmt.Sprintf("# Turn %d\n", turn), "# Rule B36/S23\n"} {
+		if !strings.Contains(header, comment) {
+			t.Errorf("expected %q in the header %q", comment, header)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestPatternInput loads a glider from an RLE file with a comment and a rule header, and from a plaintext file,
+// offset onto a 37x23 torus. After 92 turns the glider is back on the same rows, 23 cells to the right.
+func TestPatternInput(t *testing.T) {
+	dir := t.TempDir()
+	rle := filepath.Join(dir, "glider.rle")
+	util.Check(os.WriteFile(rle, []byte("#C A glider\nx = 3, y = 3, rule = B3/S23\nbo$2bo$3o!\n"), 0644))
+	cells := filepath.Join(dir, "glider.cells")
+	util.Check(os.WriteFile(cells, []byte("!Name: Glider\n.O\n..O\nOOO\n"), 0644))
+
+	glider := []util.Cell{{X: 1, Y: 0}, {X: 2, Y: 1}, {X: 0, Y: 2}, {X: 1, Y: 2}, {X: 2, Y: 2}}
+	var expected []util.Cell
+	for _, cell := range glider {
+		expected = append(expected, util.Cell{X: (cell.X + 5 + 23) % 37, Y: cell.Y + 7})
+	}
+
+	for _, path := range []string{rle, cells} {
+		p := gol.Params{Input: path, ImageWidth: 37, ImageHeight: 23, OffsetX: 5, OffsetY: 7, Turns: 92, Threads: 4}
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			events := make(chan gol.Event)
+			go func() {
+				if err := gol.Run(p, events, nil); err != nil {
+					t.Error(err)
+				}
+			}()
+			for event := range events {
+				if e, ok := event.(gol.FinalTurnComplete); ok {
+					assertEqualBoard(t, e.Alive, expected, p)
+				}
+			}
+		})
+	}
+
+	//A pattern that does not fit on the board is rejected before the broker is called
+	p := gol.Params{Input: rle, ImageWidth: 37, ImageHeight: 23, OffsetX: 35, Turns: 1, Threads: 1}
+	if err := gol.Run(p, make(chan gol.Event), nil); err == nil {
+		t.Errorf("expected %+v to be rejected", p)
+	}
+}
+
+// TestPatternRule loads a domino from an RLE file with a Seeds rule header as main does, sizing the world from the
+// pattern and leaving the rule unset, and checks that the pattern's rule is the one run: under Seeds the domino
+// gives birth to the cells above and below it, where under B3/S23 it would die out.
+func TestPatternRule(t *testing.T) {
+	rle := filepath.Join(t.TempDir(), "domino.rle")
+	util.Check(os.WriteFile(rle, []byte("#C A domino\nx = 8, y = 8, rule = B2/S\n3$3b2o!\n"), 0644))
+	p := gol.Params{Input: rle, Turns: 1, Threads: 4}
+	width, height, err := gol.ImageSize(p.Input, p.ImageIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ImageWidth, p.ImageHeight = width, height
+
+	expected := []util.Cell{{X: 3, Y: 2}, {X: 4, Y: 2}, {X: 3, Y: 4}, {X: 4, Y: 4}}
+	events := make(chan gol.Event)
+	go func() {
+		if err := gol.Run(p, events, nil); err != nil {
+			t.Error(err)
+		}
+	}()
+	for event := range events {
+		if e, ok := event.(gol.FinalTurnComplete); ok {
+			assertEqualBoard(t, e.Alive, expected, p)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestPhoto loads a dark glider on a light PNG image three times the size of a 37x23 torus, inverted and with the
+// threshold chosen by Otsu's method. After 92 turns the glider is back on the same rows, 23 cells to the right.
+func TestPhoto(t *testing.T) {
+	glider := []util.Cell{{X: 1, Y: 0}, {X: 2, Y: 1}, {X: 0, Y: 2}, {X: 1, Y: 2}, {X: 2, Y: 2}}
+	alive := make(map[util.Cell]bool)
+	var expected []util.Cell
+	for _, cell := range glider {
+		alive[cell] = true
+		expected = append(expected, util.Cell{X: (cell.X + 23) % 37, Y: cell.Y})
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 37*3, 23*3))
+	for y := 0; y < 23*3; y++ {
+		for x := 0; x < 37*3; x++ {
+			if alive[util.Cell{X: x / 3, Y: y / 3}] {
+				img.Set(x, y, color.RGBA{R: 20, G: 40, B: 90, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{R: 230, G: 210, B: 160, A: 255})
+			}
+		}
+	}
+	path := filepath.Join(t.TempDir(), "glider.png")
+	file, err := os.Create(path)
+	util.Check(err)
+	util.Check(png.Encode(file, img))
+	util.Check(file.Close())
+
+	p := gol.Params{Input: path, ImageWidth: 37, ImageHeight: 23, Turns: 92, Threads: 4, Binarisation: gol.Otsu, Invert: true}
+	events := make(chan gol.Event)
+	go func() {
+		if err := gol.Run(p, events, nil); err != nil {
+			t.Error(err)
+		}
+	}()
+	for event := range events {
+		if e, ok := event.(gol.FinalTurnComplete); ok {
+			assertEqualBoard(t, e.Alive, expected, p)
+		}
+	}
+}
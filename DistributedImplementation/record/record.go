@@ -0,0 +1,343 @@
+// Package record records a run of the Game of Life, from the events it sends, as an animated GIF
+// or as a numbered sequence of PNG images.
+package record
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// Format is one of the formats a run can be recorded in.
+type Format int
+
+const (
+	GIF Format = iota
+	PNG
+)
+
+func (format Format) String() string {
+	switch format {
+	case GIF:
+		return "gif"
+	case PNG:
+		return "png"
+	}
+	return fmt.Sprintf("Format(%d)", int(format))
+}
+
+// ParseFormat parses the name of a format as printed by String: gif or png.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "gif":
+		return GIF, nil
+	case "png":
+		return PNG, nil
+	}
+	return 0, fmt.Errorf("unknown recording format %q: expected gif or png", name)
+}
+
+// ParseColour parses a colour given as six hexadecimal digits, rrggbb, optionally after a '#'.
+func ParseColour(s string) (color.RGBA, error) {
+	digits := strings.TrimPrefix(s, "#")
+	v, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || len(digits) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q: expected rrggbb", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xFF}, nil
+}
+
+// Options says how a run is recorded.
+type Options struct {
+	Format Format
+
+	// Name is the path of the recording without its extension. A GIF is written to Name.gif once the run is over,
+	// and PNG frames to Name-000000.png, Name-000001.png and so on as they are taken.
+	Name string
+
+	// Every is the number of turns between frames. A frame is always taken of the final turn too. Defaults to 1.
+	Every int
+
+	// Scale is the width and height in pixels of every cell. Defaults to 1.
+	Scale int
+
+	// Alive and Dead are the colours of alive and dead cells, with the decaying cells of Generations rules shaded
+	// between them. They default to white and black, as in the SDL window.
+	Alive color.Color
+	Dead  color.Color
+
+	// Delay is how long each frame of a GIF is shown for, to the nearest hundredth of a second. Defaults to 100ms.
+	Delay time.Duration
+
+	// MaxFrames is the most frames a GIF holds, as its frames are kept in memory until the run is over: about
+	// MaxFrames*Width*Height*Scale*Scale bytes. Once it is full, only the frames of every other recorded turn are
+	// kept and Every is doubled, so that a long run is still recorded from start to end, less often.
+	// Must be at least 2. Defaults to 1000. PNG frames are written as they are taken, so are not limited.
+	MaxFrames int
+}
+
+// Recorder follows the cells of the world through the CellFlipped, CellsFlipped, CellStateChanged and
+// CellStatesChanged events of a run, taking a frame whenever a TurnComplete event completes a turn it records.
+// The starting world is only recorded if turn 0 is reported complete, as the distributed implementation does.
+type Recorder struct {
+	options       Options
+	width, height int
+	world         []uint8 // The pixel value of every cell: 255 when alive, 0 when dead and a grey level while decaying.
+	palette       color.Palette
+	next          int // The first turn to take the next frame at.
+	last          int // The turn of the last frame taken, or -1 before the first.
+	frames        int
+	animation     *gif.GIF
+	turns         []int // The turn of every frame of the GIF.
+	closed        bool
+	err           error
+}
+
+// New returns a recorder for a run with the given parameters, filling in the options left 0.
+func New(p gol.Params, options Options) (*Recorder, error) {
+	if options.Every < 0 || options.Scale < 0 || options.Delay < 0 {
+		return nil, fmt.Errorf("invalid recording of every %d turns at scale %d with delay %v", options.Every, options.Scale, options.Delay)
+	}
+	if options.MaxFrames < 0 || options.MaxFrames == 1 {
+		return nil, fmt.Errorf("invalid recording of at most %d frames: expected at least 2", options.MaxFrames)
+	}
+	if options.Format != GIF && options.Format != PNG {
+		return nil, fmt.Errorf("unknown recording format %v", options.Format)
+	}
+	if options.Name == "" {
+		return nil, fmt.Errorf("no name given for the recording")
+	}
+	if p.ImageWidth <= 0 || p.ImageHeight <= 0 {
+		return nil, fmt.Errorf("invalid image size %dx%d", p.ImageWidth, p.ImageHeight)
+	}
+	if options.Every == 0 {
+		options.Every = 1
+	}
+	if options.Scale == 0 {
+		options.Scale = 1
+	}
+	if options.Alive == nil {
+		options.Alive = color.White
+	}
+	if options.Dead == nil {
+		options.Dead = color.Black
+	}
+	if options.Delay == 0 {
+		options.Delay = 100 * time.Millisecond
+	}
+	if options.MaxFrames == 0 {
+		options.MaxFrames = 1000
+	}
+	if err := os.MkdirAll(filepath.Dir(options.Name), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		options: options,
+		width:   p.ImageWidth,
+		height:  p.ImageHeight,
+		world:   make([]uint8, p.ImageWidth*p.ImageHeight),
+		palette: shades(options.Dead, options.Alive),
+		next:    options.Every,
+		last:    -1,
+	}
+	if options.Format == GIF {
+		r.animation = &gif.GIF{
+			Config: image.Config{
+				ColorModel: r.palette,
+				Width:      p.ImageWidth * options.Scale,
+				Height:     p.ImageHeight * options.Scale,
+			},
+		}
+	}
+	return r, nil
+}
+
+// shades returns a palette of 256 colours from dead to alive, so that the pixel value of a cell is its index.
+func shades(dead, alive color.Color) color.Palette {
+	r0, g0, b0, _ := dead.RGBA()
+	r1, g1, b1, _ := alive.RGBA()
+	mix := func(from, to uint32, i int) uint8 {
+		return uint8((int(from>>8)*(255-i) + int(to>>8)*i + 127) / 255)
+	}
+	palette := make(color.Palette, 256)
+	for i := range palette {
+		palette[i] = color.RGBA{R: mix(r0, r1, i), G: mix(g0, g1, i), B: mix(b0, b1, i), A: 0xFF}
+	}
+	return palette
+}
+
+// Record updates the world with an event, taking a frame if it completes a turn to be recorded,
+// and finishing the recording on FinalTurnComplete. Once writing a frame has failed every event is ignored.
+func (r *Recorder) Record(event gol.Event) {
+	if r.err != nil || r.closed {
+		return
+	}
+	switch e := event.(type) {
+	case gol.CellFlipped:
+		i := e.Cell.Y*r.width + e.Cell.X
+		r.world[i] = ^r.world[i]
+	case gol.CellsFlipped:
+		for _, cell := range e.Cells {
+			i := cell.Y*r.width + cell.X
+			r.world[i] = ^r.world[i]
+		}
+	case gol.CellStateChanged:
+		r.world[e.Cell.Y*r.width+e.Cell.X] = e.State
+	case gol.CellStatesChanged:
+		for i, cell := range e.Cells {
+			r.world[cell.Y*r.width+cell.X] = e.States[i]
+		}
+	case gol.TurnComplete:
+		if e.CompletedTurns >= r.next || (e.CompletedTurns == 0 && r.last < 0) {
+			r.frame(e.CompletedTurns, false)
+		}
+	case gol.FinalTurnComplete:
+		//The cells of the final turn are given in full, as the distributed engine only flips cells every few seconds
+		alive := make([]bool, len(r.world))
+		for _, cell := range e.Alive {
+			alive[cell.Y*r.width+cell.X] = true
+		}
+		changed := false
+		for i, a := range alive {
+			if a && r.world[i] != 255 {
+				r.world[i], changed = 255, true
+			} else if !a && r.world[i] == 255 {
+				r.world[i], changed = 0, true
+			}
+		}
+		if e.CompletedTurns != r.last || changed {
+			r.frame(e.CompletedTurns, true)
+		}
+		r.err = r.Close()
+	}
+}
+
+// frame takes a frame of the world as it is after the given turn, which is the final turn if final is set.
+// A second frame of the turn of the last frame replaces it, so that every turn is recorded at most once.
+func (r *Recorder) frame(turn int, final bool) {
+	replace := turn == r.last
+	if r.animation != nil && !replace && len(r.animation.Image) >= r.options.MaxFrames {
+		r.thin()
+		//The final turn is always recorded, but other turns only if they still fall on a frame
+		if turn%r.options.Every != 0 && !final {
+			r.next = turn - turn%r.options.Every + r.options.Every
+			return
+		}
+	}
+	scale := r.options.Scale
+	img := image.NewPaletted(image.Rect(0, 0, r.width*scale, r.height*scale), r.palette)
+	for y := 0; y < r.height; y++ {
+		row := r.world[y*r.width : (y+1)*r.width]
+		for i := 0; i < scale; i++ {
+			pixels := img.Pix[(y*scale+i)*img.Stride:]
+			for x, v := range row {
+				for j := 0; j < scale; j++ {
+					pixels[x*scale+j] = v
+				}
+			}
+		}
+	}
+	r.last = turn
+	r.next = turn - turn%r.options.Every + r.options.Every
+
+	if r.animation != nil {
+		//The frame of the last turn may already have been thinned out, and is then added again
+		if last := len(r.turns) - 1; replace && last >= 0 && r.turns[last] == turn {
+			r.animation.Image[last] = img
+			return
+		}
+		r.animation.Image = append(r.animation.Image, img)
+		r.animation.Delay = append(r.animation.Delay, int((r.options.Delay+5*time.Millisecond)/(10*time.Millisecond)))
+		r.turns = append(r.turns, turn)
+		return
+	}
+	if replace {
+		r.err = writePNG(fmt.Sprintf("%s-%06d.png", r.options.Name, r.frames-1), img)
+		return
+	}
+	r.err = writePNG(fmt.Sprintf("%s-%06d.png", r.options.Name, r.frames), img)
+	r.frames++
+}
+
+// thin doubles the number of turns between the frames of a full GIF, until it is no longer full,
+// keeping only the frames of turns that are still recorded.
+func (r *Recorder) thin() {
+	for len(r.animation.Image) >= r.options.MaxFrames {
+		r.options.Every *= 2
+		kept := 0
+		for i, turn := range r.turns {
+			if turn%r.options.Every == 0 {
+				r.animation.Image[kept] = r.animation.Image[i]
+				r.animation.Delay[kept] = r.animation.Delay[i]
+				r.turns[kept] = turn
+				kept++
+			}
+		}
+		//The frames dropped are cleared so that their memory is freed
+		for i := kept; i < len(r.animation.Image); i++ {
+			r.animation.Image[i] = nil
+		}
+		r.animation.Image, r.animation.Delay, r.turns = r.animation.Image[:kept], r.animation.Delay[:kept], r.turns[:kept]
+	}
+}
+
+// writePNG writes an image to a PNG file at path.
+func writePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Close finishes the recording, writing the GIF of the frames taken so far.
+func (r *Recorder) Close() error {
+	if r.closed {
+		return r.err
+	}
+	r.closed = true
+	if r.err != nil || r.animation == nil || len(r.animation.Image) == 0 {
+		return r.err
+	}
+	file, err := os.Create(r.options.Name + ".gif")
+	if err != nil {
+		return err
+	}
+	if err := gif.EncodeAll(file, r.animation); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Relay records every event from in and passes it on to out, closing out once in is closed.
+// The recording is finished before FinalTurnComplete is passed on, so that it is complete when the run is.
+func (r *Recorder) Relay(in <-chan gol.Event, out chan<- gol.Event) {
+	for event := range in {
+		r.Record(event)
+		out <- event
+	}
+	if !r.closed {
+		r.err = r.Close()
+	}
+	close(out)
+}
+
+// Err returns the first error met while recording, if any.
+func (r *Recorder) Err() error {
+	return r.err
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/record"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestRecordGIF records a glider on a 37x23 torus as an animated GIF. The distributed engine reports turn 0 and
+// then only the turns it polls the broker on, so the first frame is the starting glider and the last the final one.
+// With room for only 2 frames, the frames in between are dropped. Alive cells are the last colour of the palette of
+// the recording.
+func TestRecordGIF(t *testing.T) {
+	dir := t.TempDir()
+	glider := []util.Cell{{X: 1, Y: 0}, {X: 2, Y: 1}, {X: 0, Y: 2}, {X: 1, Y: 2}, {X: 2, Y: 2}}
+	path := filepath.Join(dir, "glider.pgm")
+	writeImage(path, 37, 23, glider)
+	var moved []util.Cell
+	for _, cell := range glider {
+		moved = append(moved, util.Cell{X: (cell.X + 23) % 37, Y: cell.Y})
+	}
+
+	p := gol.Params{Input: path, ImageWidth: 37, ImageHeight: 23, Turns: 92, Threads: 4}
+	name := filepath.Join(dir, "glider")
+	recorder, err := record.New(p, record.Options{Format: record.GIF, Name: name, Scale: 2, MaxFrames: 2})
+	util.Check(err)
+	events := make(chan gol.Event)
+	recorded := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	go recorder.Relay(events, recorded)
+	for range recorded {
+	}
+	util.Check(recorder.Err())
+
+	file, err := os.Open(name + ".gif")
+	util.Check(err)
+	defer file.Close()
+	animation, err := gif.DecodeAll(file)
+	util.Check(err)
+	if len(animation.Image) != 2 {
+		t.Fatalf("expected 2 frames, got %d", len(animation.Image))
+	}
+	frames := map[string]struct {
+		index int
+		alive []util.Cell
+	}{
+		"first": {0, glider},
+		"last":  {len(animation.Image) - 1, moved},
+	}
+	for which, frame := range frames {
+		var cells []util.Cell
+		img := animation.Image[frame.index]
+		for y := 0; y < 23; y++ {
+			for x := 0; x < 37; x++ {
+				if img.ColorIndexAt(2*x+1, 2*y+1) == 255 {
+					cells = append(cells, util.Cell{X: x, Y: y})
+				}
+			}
+		}
+		t.Run(which, func(t *testing.T) {
+			assertEqualBoard(t, cells, frame.alive, p)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Topology describes how the edges of the world are joined together.
+type Topology int
+
+const (
+	Torus        Topology = iota // opposite edges are joined: the closed domain of the original coursework
+	Plane                        // cells beyond the edges are always dead
+	Reflect                      // cells beyond an edge mirror the cells just inside it
+	KleinBottle                  // left and right edges are joined, top and bottom edges are joined with a twist
+	CrossSurface                 // both pairs of opposite edges are joined with a twist (the real projective plane)
+)
+
+var topologyNames = []string{"torus", "plane", "reflect", "klein", "cross"}
+
+// ParseTopology returns the topology with the given name: torus, plane, reflect, klein or cross.
+func ParseTopology(name string) (Topology, error) {
+	for t, n := range topologyNames {
+		if strings.EqualFold(name, n) {
+			return Topology(t), nil
+		}
+	}
+	return Torus, fmt.Errorf("invalid topology %q: expected one of %v", name, strings.Join(topologyNames, ", "))
+}
+
+// Valid reports whether t is one of the topologies above.
+func (t Topology) Valid() bool {
+	return t >= 0 && int(t) < len(topologyNames)
+}
+
+func (t Topology) String() string {
+	if !t.Valid() {
+		return "Incorrect Topology"
+	}
+	return topologyNames[t]
+}
+
+// Locate maps the coordinate (y, x), which may lie outside the world, onto the cell of the world it refers to.
+// ok is false when the coordinate lies beyond a dead edge.
+func (t Topology) Locate(y, x, height, width int) (cellY, cellX int, ok bool) {
+	switch t {
+	case Plane:
+		return y, x, y >= 0 && y < height && x >= 0 && x < width
+	case Reflect:
+		return reflect(y, height), reflect(x, width), true
+	case KleinBottle:
+		cellY, cellX = wrap(y, height), wrap(x, width)
+		//Every crossing of the top or bottom edge mirrors the world left to right
+		if floorDiv(y, height)%2 != 0 {
+			cellX = width - 1 - cellX
+		}
+		return cellY, cellX, true
+	case CrossSurface:
+		cellY, cellX = wrap(y, height), wrap(x, width)
+		if floorDiv(y, height)%2 != 0 {
+			cellX = width - 1 - cellX
+		}
+		//Every crossing of the left or right edge mirrors the world top to bottom
+		if floorDiv(x, width)%2 != 0 {
+			cellY = height - 1 - cellY
+		}
+		return cellY, cellX, true
+	default:
+		return wrap(y, height), wrap(x, width), true
+	}
+}
+
+// wrap returns the coordinate v moved onto a closed domain of size n.
+func wrap(v, n int) int {
+	return ((v % n) + n) % n
+}
+
+// reflect returns the coordinate v mirrored back into a domain of size n, so -1 maps to 0 and n maps to n-1.
+func reflect(v, n int) int {
+	v = wrap(v, 2*n)
+	if v >= n {
+		return 2*n - 1 - v
+	}
+	return v
+}
+
+// floorDiv returns v divided by n rounded towards negative infinity, counting how many edges v lies beyond.
+func floorDiv(v, n int) int {
+	if v < 0 {
+		return (v+1)/n - 1
+	}
+	return v / n
+}
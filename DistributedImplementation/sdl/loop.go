@@ -36,6 +36,16 @@ sdlLoop:
 			switch e := event.(type) {
 			case gol.CellFlipped:
 				w.FlipPixel(e.Cell.X, e.Cell.Y)
+			case gol.CellsFlipped:
+				for _, cell := range e.Cells {
+					w.FlipPixel(cell.X, cell.Y)
+				}
+			case gol.CellStateChanged:
+				w.SetPixelValue(e.Cell.X, e.Cell.Y, e.State)
+			case gol.CellStatesChanged:
+				for i, cell := range e.Cells {
+					w.SetPixelValue(cell.X, cell.Y, e.States[i])
+				}
 			case gol.TurnComplete:
 				w.RenderFrame()
 			case gol.FinalTurnComplete:
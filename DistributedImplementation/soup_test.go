@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// boardHash returns the FNV-1a hash of the pixels of a board with the given cells alive, row by row.
+func boardHash(cells []util.Cell, width, height int) uint64 {
+	board := make([]byte, width*height)
+	for _, cell := range cells {
+		board[cell.Y*width+cell.X] = 255
+	}
+	h := fnv.New64a()
+	h.Write(board)
+	return h.Sum64()
+}
+
+// TestSoup checks that soups on a 64x48 board are made exactly as the parallel implementation makes them,
+// by the hashes its tests check.
+func TestSoup(t *testing.T) {
+	tests := []struct {
+		soup  gol.Soup
+		alive int
+		hash  uint64
+	}{
+		{gol.Soup{Density: 0.35, Seed: 42}, 1056, 0x1cc00402cb1e0eff},
+		{gol.Soup{Density: 0.5, Seed: 7, Symmetry: gol.C2, Width: 30, Height: 20}, 296, 0x944974ad049cfd1},
+		{gol.Soup{Density: 0.25, Seed: 1, Symmetry: gol.C4, Width: 24, Height: 24}, 152, 0xcbeeb599aeb35bd},
+		{gol.Soup{Density: 0.6, Seed: 1 << 63, Symmetry: gol.D8, Width: 17, Height: 17}, 164, 0xe4ce719202c8db45},
+	}
+	for _, test := range tests {
+		p := gol.Params{ImageWidth: 64, ImageHeight: 48, Threads: 4, Soup: test.soup}
+		t.Run(fmt.Sprintf("%v-%v", test.soup.Seed, test.soup.Symmetry), func(t *testing.T) {
+			events := make(chan gol.Event)
+			go func() {
+				if err := gol.Run(p, events, nil); err != nil {
+					t.Error(err)
+				}
+			}()
+			for event := range events {
+				if e, ok := event.(gol.FinalTurnComplete); ok {
+					if hash := boardHash(e.Alive, 64, 48); len(e.Alive) != test.alive || hash != test.hash {
+						t.Errorf("expected %d cells alive with hash %#x, got %d with hash %#x", test.alive, test.hash, len(e.Alive), hash)
+					}
+				}
+			}
+		})
+	}
+
+	p := gol.Params{ImageWidth: 64, ImageHeight: 48, Turns: 1, Threads: 1, Soup: gol.Soup{Density: 0.5, Symmetry: gol.C4}}
+	if err := gol.Run(p, make(chan gol.Event), nil); err == nil {
+		t.Errorf("expected a C4 soup that is not square to be rejected")
+	}
+}
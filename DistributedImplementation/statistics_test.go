@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestTurnStatistics checks that the controller reports the births, deaths and population of every turn,
+// as counted by the engines and the broker, and that the population matches the counts in check/alive.
+func TestTurnStatistics(t *testing.T) {
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Threads: 4}
+	alive := readAliveCounts(p.ImageWidth, p.ImageHeight)
+	t.Run(fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+		events := make(chan gol.Event)
+		go gol.Run(p, events, nil)
+		turns := 0
+		population := len(readAliveCells("images/64x64.pgm", p.ImageWidth, p.ImageHeight))
+		for event := range events {
+			if e, ok := event.(gol.TurnStatistics); ok {
+				turns++
+				if e.CompletedTurns != turns {
+					t.Fatalf("expected statistics for turn %d, got turn %d", turns, e.CompletedTurns)
+				}
+				population += e.Births - e.Deaths
+				if e.Population != alive[e.CompletedTurns] || population != e.Population {
+					t.Errorf("turn %d: reported a population of %d (%d from births and deaths), expected %d", e.CompletedTurns, e.Population, population, alive[e.CompletedTurns])
+				}
+			}
+		}
+		if turns != p.Turns {
+			t.Errorf("expected statistics for %d turns, got %d", p.Turns, turns)
+		}
+	})
+}
+
+// TestPopulationCSV checks that the population CSV written by the controller starts with the same rows as check/alive.
+func TestPopulationCSV(t *testing.T) {
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Threads: 4, PopulationCSV: true}
+	t.Run(fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+		events := make(chan gol.Event)
+		go gol.Run(p, events, nil)
+		for range events {
+		}
+		expected, err := os.ReadFile(fmt.Sprintf("check/alive/%vx%v.csv", p.ImageWidth, p.ImageHeight))
+		if err != nil {
+			t.Fatal(err)
+		}
+		given, err := os.ReadFile(fmt.Sprintf("out/%vx%vx%v-alive.csv", p.ImageWidth, p.ImageHeight, p.Turns))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := strings.SplitAfter(string(expected), "\n")[:p.Turns+1]
+		if string(given) != strings.Join(rows, "") {
+			t.Errorf("out/%vx%vx%v-alive.csv differs from the first %d turns of check/alive", p.ImageWidth, p.ImageHeight, p.Turns, p.Turns)
+		}
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"uk.ac.bris.cs/gameoflife/gol"
 )
@@ -11,29 +12,85 @@ import (
 // Change the following constant to change how many turns to GoL benchmark should iterate
 const benchLength = 100
 
+// BenchmarkStudentVersion runs the 512x512 image on each number of threads, with each worker given a fixed strip of
+// the world and with workers stealing chunks of rows from a shared queue. The imbalance it reports is the busy time
+// of the busiest worker over the mean busy time of all of them, where 1 means the work was shared out evenly.
 func BenchmarkStudentVersion(b *testing.B) {
 	for threads := 1; threads <= 16; threads++ {
 		os.Stdout = nil // Disable all program output apart from benchmark results
-		p := gol.Params{
-			Turns:       benchLength,
-			Threads:     threads,
-			ImageWidth:  512,
-			ImageHeight: 512,
-		}
+		for _, stealing := range []bool{false, true} {
+			p := gol.Params{
+				Turns:        benchLength,
+				Threads:      threads,
+				ImageWidth:   512,
+				ImageHeight:  512,
+				WorkStealing: stealing,
+			}
 
-		name := fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
-		b.Run(name, func(b *testing.B) {
-			for i := 0; i < b.N; i++ {
-				events := make(chan gol.Event)
-				go gol.Run(p, events, nil)
-				for range events {
-				}
+			name := fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+			if stealing {
+				name += "-stealing"
 			}
-		})
+			b.Run(name, func(b *testing.B) {
+				imbalance := 0.0
+				for i := 0; i < b.N; i++ {
+					events := make(chan gol.Event)
+					go gol.Run(p, events, nil)
+					for event := range events {
+						if e, ok := event.(gol.WorkerStatistics); ok {
+							imbalance += workerImbalance(e.Busy) / float64(b.N)
+						}
+					}
+				}
+				b.ReportMetric(imbalance, "imbalance")
+			})
+		}
 	}
 }
 
+// workerImbalance returns the longest busy time over the mean busy time.
+func workerImbalance(busy []time.Duration) float64 {
+	var total, longest time.Duration
+	for _, d := range busy {
+		total += d
+		if d > longest {
+			longest = d
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return float64(longest) * float64(len(busy)) / float64(total)
+}
+
+// BenchmarkDecomposition compares dividing the world between the workers in horizontal strips against
+// dividing it into a grid of tiles, which have shorter edges and so fewer halo cells to exchange each turn.
+func BenchmarkDecomposition(b *testing.B) {
+	for threads := 2; threads <= 16; threads *= 2 {
+		os.Stdout = nil // Disable all program output apart from benchmark results
+		for _, tiles := range []string{"strips", "tiles"} {
+			p := gol.Params{
+				Turns:       benchLength,
+				Threads:     threads,
+				ImageWidth:  512,
+				ImageHeight: 512,
+			}
+			if tiles == "tiles" {
+				p.TileWidth, p.TileHeight = gol.AutoTiles, gol.AutoTiles
+			}
 
+			name := fmt.Sprintf("%s-%dx%dx%d-%d", tiles, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+			b.Run(name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					events := make(chan gol.Event)
+					go gol.Run(p, events, nil)
+					for range events {
+					}
+				}
+			})
+		}
+	}
+}
 
 /*
 // Benchmark applies the gol.Run to the 512x512 image, for 1000 turns, b.N times.
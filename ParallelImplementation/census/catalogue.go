@@ -0,0 +1,139 @@
+package census
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// entry is an object of the catalogue.
+type entry struct {
+	name   string
+	kind   Kind
+	period int
+	rows   string // the cells of one phase of the object, as rows of '*' and '.' separated by '/'
+}
+
+// objects are the common objects of Conway's Life, B3/S23.
+var objects = []entry{
+	{"block", StillLife, 1, "**/**"},
+	{"beehive", StillLife, 1, ".**./*..*/.**."},
+	{"loaf", StillLife, 1, ".**./*..*/.*.*/..*."},
+	{"boat", StillLife, 1, "**./*.*/.*."},
+	{"ship", StillLife, 1, "**./*.*/.**"},
+	{"tub", StillLife, 1, ".*./*.*/.*."},
+	{"pond", StillLife, 1, ".**./*..*/*..*/.**."},
+	{"barge", StillLife, 1, ".*../*.*./.*.*/..*."},
+	{"long boat", StillLife, 1, "**../*.*./.*.*/..*."},
+	{"snake", StillLife, 1, "**.*/*.**"},
+	{"aircraft carrier", StillLife, 1, "**../*..*/..**"},
+	{"eater", StillLife, 1, "**../*.*./..*./..**"},
+	{"blinker", Oscillator, 2, "***"},
+	{"toad", Oscillator, 2, ".***/***."},
+	{"beacon", Oscillator, 2, "**../**../..**/..**"},
+	{"pulsar", Oscillator, 3, "..***...***../............./*....*.*....*/*....*.*....*/*....*.*....*/..***...***../" +
+		"............./..***...***../*....*.*....*/*....*.*....*/*....*.*....*/............./..***...***.."},
+	{"glider", Spaceship, 4, ".*./..*/***"},
+	{"lightweight spaceship", Spaceship, 4, ".*..*/*..../*...*/****."},
+	{"middleweight spaceship", Spaceship, 4, "...*../.*...*/*...../*....*/*****."},
+	{"heavyweight spaceship", Spaceship, 4, "...**../.*....*/*....../*.....*/******."},
+}
+
+// catalogue finds the object of the catalogue from the canonical form of any of its phases.
+var catalogue = make(map[string]entry)
+
+func init() {
+	for _, object := range objects {
+		var cells []util.Cell
+		for y, row := range strings.Split(object.rows, "/") {
+			for x, char := range row {
+				if char == '*' {
+					cells = append(cells, util.Cell{X: x, Y: y})
+				}
+			}
+		}
+		for phase := 0; phase < object.period; phase++ {
+			catalogue[canonical(cells)] = object
+			cells = step(cells)
+		}
+	}
+}
+
+// canonical returns the same string for every rotation, reflection and position of an island,
+// by choosing the smallest of the strings of its eight orientations.
+func canonical(island []util.Cell) string {
+	smallest := ""
+	for orientation := 0; orientation < 8; orientation++ {
+		cells := make([]util.Cell, len(island))
+		for i, cell := range island {
+			x, y := cell.X, cell.Y
+			if orientation&1 != 0 {
+				x = -x
+			}
+			if orientation&2 != 0 {
+				y = -y
+			}
+			if orientation&4 != 0 {
+				x, y = y, x
+			}
+			cells[i] = util.Cell{X: x, Y: y}
+		}
+		form := normalise(cells)
+		if smallest == "" || form < smallest {
+			smallest = form
+		}
+	}
+	return smallest
+}
+
+// normalise moves the cells to the top left corner and lists them in order.
+func normalise(cells []util.Cell) string {
+	minX, minY := cells[0].X, cells[0].Y
+	for _, cell := range cells {
+		if cell.X < minX {
+			minX = cell.X
+		}
+		if cell.Y < minY {
+			minY = cell.Y
+		}
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].Y != cells[j].Y {
+			return cells[i].Y < cells[j].Y
+		}
+		return cells[i].X < cells[j].X
+	})
+	var form strings.Builder
+	for _, cell := range cells {
+		form.WriteString(strconv.Itoa(cell.X - minX))
+		form.WriteByte(',')
+		form.WriteString(strconv.Itoa(cell.Y - minY))
+		form.WriteByte(';')
+	}
+	return form.String()
+}
+
+// step returns the next turn of an object on its own in an unbounded Conway's Life world.
+func step(cells []util.Cell) []util.Cell {
+	alive := make(map[util.Cell]bool)
+	neighbours := make(map[util.Cell]int)
+	for _, cell := range cells {
+		alive[cell] = true
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if dx != 0 || dy != 0 {
+					neighbours[util.Cell{X: cell.X + dx, Y: cell.Y + dy}]++
+				}
+			}
+		}
+	}
+	var next []util.Cell
+	for cell, n := range neighbours {
+		if n == 3 || n == 2 && alive[cell] {
+			next = append(next, cell)
+		}
+	}
+	return next
+}
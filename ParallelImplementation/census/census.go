@@ -0,0 +1,140 @@
+// Package census splits a Game of Life world into its separate objects and names the ones it knows,
+// such as blocks, blinkers and gliders.
+package census
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Kind says how an object behaves over time.
+type Kind int
+
+const (
+	Unknown Kind = iota
+	StillLife
+	Oscillator
+	Spaceship
+)
+
+func (kind Kind) String() string {
+	switch kind {
+	case StillLife:
+		return "still life"
+	case Oscillator:
+		return "oscillator"
+	case Spaceship:
+		return "spaceship"
+	}
+	return "unknown"
+}
+
+// Tally is how many of one kind of object were found in a world.
+// Objects that are not in the catalogue are all tallied together under the name "unknown".
+type Tally struct {
+	Name   string
+	Kind   Kind
+	Period int // 1 for still lifes, and 0 for unknown objects
+	Count  int
+	Cells  int // the number of alive cells in all of these objects together
+}
+
+// Locate finds the cell of the world at (y, x), which may be beyond its edges, reporting false if there is none.
+type Locate func(y, x int) (int, int, bool)
+
+// islandReach is how far apart two alive cells can be to belong to the same island. Cells one apart would split some
+// phases of the lightweight spaceship in two, so cells with one dead cell between them are joined too.
+const islandReach = 2
+
+// Islands splits the alive cells of a world into islands of cells that are close to each other, following the
+// edges of the world with locate. The cells of each island are given as offsets from its first cell, unwrapped
+// across the edges of the world, so an island that crosses an edge keeps its shape.
+func Islands(alive []util.Cell, width, height int, locate Locate) [][]util.Cell {
+	isAlive := make([]bool, width*height)
+	for _, cell := range alive {
+		isAlive[cell.Y*width+cell.X] = true
+	}
+	seen := make([]bool, width*height)
+
+	var islands [][]util.Cell
+	for _, start := range alive {
+		if seen[start.Y*width+start.X] {
+			continue
+		}
+		seen[start.Y*width+start.X] = true
+
+		//Search outwards from the cell, keeping both the cell in the world and its offset from the start
+		type found struct{ cell, offset util.Cell }
+		queue := []found{{start, util.Cell{}}}
+		var island []util.Cell
+		for len(queue) > 0 {
+			next := queue[0]
+			queue = queue[1:]
+			island = append(island, next.offset)
+			for dy := -islandReach; dy <= islandReach; dy++ {
+				for dx := -islandReach; dx <= islandReach; dx++ {
+					y, x, ok := locate(next.cell.Y+dy, next.cell.X+dx)
+					if !ok || !isAlive[y*width+x] || seen[y*width+x] {
+						continue
+					}
+					seen[y*width+x] = true
+					queue = append(queue, found{util.Cell{X: x, Y: y}, util.Cell{X: next.offset.X + dx, Y: next.offset.Y + dy}})
+				}
+			}
+		}
+		islands = append(islands, island)
+	}
+	return islands
+}
+
+// Take splits the world into islands and tallies them against the catalogue of Conway's Life objects.
+// The tallies are ordered from the most common object to the least.
+func Take(alive []util.Cell, width, height int, locate Locate) []Tally {
+	counts := make(map[string]*Tally)
+	for _, island := range Islands(alive, width, height, locate) {
+		object, ok := catalogue[canonical(island)]
+		if !ok {
+			object = entry{name: "unknown", kind: Unknown}
+		}
+		tally, ok := counts[object.name]
+		if !ok {
+			tally = &Tally{Name: object.name, Kind: object.kind, Period: object.period}
+			counts[object.name] = tally
+		}
+		tally.Count++
+		tally.Cells += len(island)
+	}
+
+	var tallies []Tally
+	for _, tally := range counts {
+		tallies = append(tallies, *tally)
+	}
+	sort.Slice(tallies, func(i, j int) bool {
+		if tallies[i].Count != tallies[j].Count {
+			return tallies[i].Count > tallies[j].Count
+		}
+		return tallies[i].Name < tallies[j].Name
+	})
+	return tallies
+}
+
+// WriteCSV writes the tallies as CSV, with a header row.
+func WriteCSV(w io.Writer, tallies []Tally) error {
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{"object", "kind", "period", "count", "cells"})
+	for _, tally := range tallies {
+		_ = out.Write([]string{
+			tally.Name,
+			tally.Kind.String(),
+			strconv.Itoa(tally.Period),
+			strconv.Itoa(tally.Count),
+			strconv.Itoa(tally.Cells),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
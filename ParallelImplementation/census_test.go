@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/census"
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// shape returns the cells of a pattern drawn as rows of '*' and '.', with its top left corner at (y, x).
+func shape(rows string, y, x int) []util.Cell {
+	var cells []util.Cell
+	for i, row := range strings.Split(rows, "/") {
+		for j, char := range row {
+			if char == '*' {
+				cells = append(cells, util.Cell{X: x + j, Y: y + i})
+			}
+		}
+	}
+	return cells
+}
+
+// TestCensus checks that objects are named whatever their phase, rotation or reflection,
+// and that objects crossing the edges of a torus are put back together.
+func TestCensus(t *testing.T) {
+	torus := func(y, x int) (int, int, bool) {
+		return (y + 64) % 64, (x + 64) % 64, true
+	}
+	plane := func(y, x int) (int, int, bool) {
+		return y, x, y >= 0 && y < 64 && x >= 0 && x < 64
+	}
+
+	var alive []util.Cell
+	alive = append(alive, shape("**/**", 4, 4)...)
+	alive = append(alive, shape("**/**", 2, 10)...)
+	alive = append(alive, shape(".**./*..*/.**.", 10, 2)...)
+	alive = append(alive, shape("*/*/*", 10, 20)...)
+	alive = append(alive, shape("*.*/.**/.*.", 20, 2)...)
+	alive = append(alive, shape("***/*../.*.", 20, 20)...)
+	alive = append(alive, shape("*..*./....*/*...*/.****", 30, 2)...)
+	alive = append(alive, shape(".**/**./.*.", 40, 40)...)
+	//A block split across the four corners of the world
+	alive = append(alive, util.Cell{X: 0, Y: 0}, util.Cell{X: 63, Y: 0}, util.Cell{X: 0, Y: 63}, util.Cell{X: 63, Y: 63})
+
+	expected := []census.Tally{
+		{Name: "block", Kind: census.StillLife, Period: 1, Count: 3, Cells: 12},
+		{Name: "glider", Kind: census.Spaceship, Period: 4, Count: 2, Cells: 10},
+		{Name: "beehive", Kind: census.StillLife, Period: 1, Count: 1, Cells: 6},
+		{Name: "blinker", Kind: census.Oscillator, Period: 2, Count: 1, Cells: 3},
+		{Name: "lightweight spaceship", Kind: census.Spaceship, Period: 4, Count: 1, Cells: 9},
+		{Name: "unknown", Kind: census.Unknown, Count: 1, Cells: 5},
+	}
+	assertEqualTallies(t, census.Take(alive, 64, 64, torus), expected)
+
+	//On a plane the corners are four separate cells
+	expected = []census.Tally{
+		{Name: "unknown", Kind: census.Unknown, Count: 5, Cells: 9},
+		{Name: "block", Kind: census.StillLife, Period: 1, Count: 2, Cells: 8},
+		{Name: "glider", Kind: census.Spaceship, Period: 4, Count: 2, Cells: 10},
+		{Name: "beehive", Kind: census.StillLife, Period: 1, Count: 1, Cells: 6},
+		{Name: "blinker", Kind: census.Oscillator, Period: 2, Count: 1, Cells: 3},
+		{Name: "lightweight spaceship", Kind: census.Spaceship, Period: 4, Count: 1, Cells: 9},
+	}
+	assertEqualTallies(t, census.Take(alive, 64, 64, plane), expected)
+}
+
+// TestCensusOutput checks that the glider of the 16x16 image is found in the final world, in the
+// ObjectCensus event and in the CSV file written beside the PGM image.
+func TestCensusOutput(t *testing.T) {
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 10, Threads: 4}
+	expected := []census.Tally{{Name: "glider", Kind: census.Spaceship, Period: 4, Count: 1, Cells: 5}}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	found := false
+	for event := range events {
+		if e, ok := event.(gol.ObjectCensus); ok {
+			found = true
+			assertEqualTallies(t, e.Objects, expected)
+		}
+	}
+	if !found {
+		t.Fatalf("no ObjectCensus event was sent")
+	}
+
+	data, err := os.ReadFile(fmt.Sprintf("out/%vx%vx%v-census.csv", p.ImageWidth, p.ImageHeight, p.Turns))
+	util.Check(err)
+	if string(data) != "object,kind,period,count,cells\nglider,spaceship,4,1,5\n" {
+		t.Errorf("unexpected census file:\n%s", data)
+	}
+
+	//Every alive cell of a larger world belongs to exactly one object
+	p = gol.Params{ImageWidth: 512, ImageHeight: 512, Turns: 100, Threads: 8, Packed: true}
+	events = make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	cells := 0
+	for event := range events {
+		switch e := event.(type) {
+		case gol.ObjectCensus:
+			for _, tally := range e.Objects {
+				cells += tally.Cells
+			}
+		case gol.FinalTurnComplete:
+			if cells != len(e.Alive) {
+				t.Errorf("census holds %d cells, expected %d", cells, len(e.Alive))
+			}
+		}
+	}
+}
+
+func assertEqualTallies(t *testing.T, given, expected []census.Tally) {
+	t.Helper()
+	if fmt.Sprint(given) != fmt.Sprint(expected) {
+		t.Errorf("unexpected census\nexpected: %v\ngot:      %v", expected, given)
+	}
+}
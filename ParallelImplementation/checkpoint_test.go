@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestCheckpointResume checks that each engine writes a checkpoint every CheckpointTurns turns, and that a run
+// resumed from the last one reports the turns after it and reaches the golden image. The resumed run carries on the
+// population CSV of the first from the checkpoint, without repeating the rows the first wrote after it.
+func TestCheckpointResume(t *testing.T) {
+	engines := []gol.Params{
+		{Threads: 4},
+		{Threads: 4, WorkStealing: true},
+		{Threads: 4, Packed: true},
+		{Threads: 1, HashLife: true},
+	}
+	expectedAlive := readAliveCells("check/images/64x64x100.pgm", 64, 64)
+	population, err := os.ReadFile("check/alive/64x64.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedRows := strings.SplitAfterN(string(population), "\n", 102)[:101]
+	for _, p := range engines {
+		p.ImageWidth, p.ImageHeight, p.Turns, p.CheckpointTurns, p.PopulationCSV = 64, 64, 100, 30, true
+		t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", engineName(p), p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+			path, csv := "out/64x64x100.checkpoint", "out/64x64x100-alive.csv"
+			os.Remove(path)
+			runFinal(p)
+			written := readRows(t, csv)
+			resumed, turn, err := gol.ReadCheckpoint(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			//HashLife jumps many turns at once, so only checkpoints once at least 30 turns have passed
+			if (!p.HashLife && turn != 90) || turn < 30 || turn >= 100 {
+				t.Fatalf("expected the last checkpoint to be of turn 90, got turn %d", turn)
+			}
+			if resumed.ImageWidth != 64 || resumed.ImageHeight != 64 || resumed.Turns != 100 || resumed.Rule != gol.DefaultRule {
+				t.Errorf("expected the parameters of the run to be checkpointed, got %+v", resumed)
+			}
+
+			resumed.Resume = path
+			events := make(chan gol.Event)
+			go gol.Run(resumed, events, nil)
+			var final gol.FinalTurnComplete
+			for event := range events {
+				if event.GetCompletedTurns() < turn {
+					t.Fatalf("%T reported for turn %d, before the checkpoint of turn %d", event, event.GetCompletedTurns(), turn)
+				}
+				if e, ok := event.(gol.FinalTurnComplete); ok {
+					final = e
+				}
+			}
+			if final.CompletedTurns != 100 {
+				t.Errorf("expected the resumed run to finish on turn 100, got %d", final.CompletedTurns)
+			}
+			assertEqualBoard(t, final.Alive, expectedAlive, p)
+
+			//HashLife writes a row for every jump, and jumps from the checkpoint differently than from turn 0
+			rows := readRows(t, csv)
+			if !p.HashLife && !reflect.DeepEqual(rows, expectedRows) {
+				t.Errorf("expected the resumed population CSV to hold the %d rows of check/alive, got %d rows", len(expectedRows), len(rows))
+			}
+			for i, row := range written {
+				var rowTurn int
+				fmt.Sscanf(row, "%d,", &rowTurn)
+				if i > 0 && rowTurn > turn {
+					break
+				}
+				if i >= len(rows) || rows[i] != row {
+					t.Fatalf("expected row %d of the population CSV, %q, to be kept", i, row)
+				}
+			}
+			if len(rows) == 0 || rows[len(rows)-1] != expectedRows[100] {
+				t.Errorf("expected the population CSV to end with %q, got %q", expectedRows[100], rows)
+			}
+		})
+	}
+}
+
+// TestCheckpointStatistics checks that the rows of the population CSV up to a checkpoint are on the disk by the time
+// the checkpoint is, so that resuming after a crash leaves no gap in the CSV.
+func TestCheckpointStatistics(t *testing.T) {
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Threads: 4, CheckpointTurns: 30, PopulationCSV: true}
+	path, csv := "out/64x64x100.checkpoint", "out/64x64x100-alive.csv"
+	os.Remove(path)
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	for event := range events {
+		//The io goroutine has written the checkpoint before it takes the statistics of the turn after it
+		e, ok := event.(gol.TurnComplete)
+		if !ok || e.CompletedTurns%p.CheckpointTurns != 1 || e.CompletedTurns == 1 {
+			continue
+		}
+		_, turn, err := gol.ReadCheckpoint(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rows := readRows(t, csv); len(rows) < turn+1 {
+			t.Errorf("checkpoint of turn %d written with only %d lines of the population CSV on the disk", turn, len(rows))
+		}
+	}
+}
+
+// readRows returns the lines of the file at path, each with its newline.
+func readRows(t *testing.T, path string) []string {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := strings.SplitAfter(string(contents), "\n")
+	if rows[len(rows)-1] == "" {
+		rows = rows[:len(rows)-1]
+	}
+	return rows
+}
+
+// TestCheckpointQuit checks that cancelling a run writing checkpoints on a timer writes a last checkpoint of the
+// turn it stopped on.
+func TestCheckpointQuit(t *testing.T) {
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 1000000000, Threads: 2, CheckpointInterval: time.Hour}
+	path := "out/16x16x1000000000.checkpoint"
+	os.Remove(path)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan gol.Event)
+	result := make(chan contextResult)
+	go func() {
+		turns, err := gol.RunContext(ctx, p, events, nil)
+		result <- contextResult{turns, err}
+	}()
+	for event := range events {
+		if e, ok := event.(gol.TurnComplete); ok && e.CompletedTurns == 50 {
+			cancel()
+		}
+	}
+	r := <-result
+	_, turn, err := gol.ReadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if turn != r.turns {
+		t.Errorf("expected a checkpoint of turn %d, the turn the run stopped on, got turn %d", r.turns, turn)
+	}
+}
+
+// TestCheckpointSave checks that a simulation saved as a checkpoint is loaded again on the same turn with the same
+// world, keeping the decaying cells of Generations rules, and that a checkpoint of another size is rejected.
+func TestCheckpointSave(t *testing.T) {
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64, Threads: 2, Rule: "B2/S/C3"}
+	sim, err := gol.NewSimulation(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	sim.Step(10)
+	path := filepath.Join(t.TempDir(), "world.checkpoint")
+	if err := sim.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, turn, err := gol.ReadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if turn != 10 {
+		t.Errorf("expected a checkpoint of turn 10, got turn %d", turn)
+	}
+	resumed.Resume = path
+	loaded, err := gol.NewSimulation(resumed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Close()
+	if loaded.Turn() != 10 || !reflect.DeepEqual(loaded.World(), sim.World()) {
+		t.Fatalf("expected the world of turn 10 to be loaded, got turn %d", loaded.Turn())
+	}
+	sim.Step(5)
+	loaded.Step(5)
+	if !reflect.DeepEqual(loaded.World(), sim.World()) {
+		t.Error("expected the loaded world to carry on as the saved one does")
+	}
+
+	resumed.ImageWidth = 32
+	if _, err := gol.NewSimulation(resumed); err == nil {
+		t.Error("expected a checkpoint of a 64x64 world to be rejected for a 32x64 one")
+	} else if ioError, ok := err.(gol.IOError); !ok || ioError.Operation != "read checkpoint" {
+		t.Errorf("expected an IOError reading the checkpoint, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// contextResult is what gol.RunContext returned.
+type contextResult struct {
+	turns int
+	err   error
+}
+
+// TestRunContextCancel checks that cancelling the context of a run stops it after the turn being computed,
+// closing events once after a Quitting StateChange, and returns the last completed turn with every goroutine ended.
+func TestRunContextCancel(t *testing.T) {
+	tests := []gol.Params{
+		{Threads: 1},
+		{Threads: 8},
+		{Threads: 4, TileWidth: 16, TileHeight: 32},
+		{Threads: 4, WorkStealing: true},
+		{Threads: 4, Packed: true},
+	}
+	for _, p := range tests {
+		p.ImageWidth, p.ImageHeight, p.Turns = 64, 64, 1000000000
+		t.Run(fmt.Sprintf("%+v", p), func(t *testing.T) {
+			before := runtime.NumGoroutine()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			events := make(chan gol.Event)
+			result := make(chan contextResult)
+			go func() {
+				turns, err := gol.RunContext(ctx, p, events, nil)
+				result <- contextResult{turns, err}
+			}()
+
+			last, quitting := 0, -1
+			for event := range events {
+				switch e := event.(type) {
+				case gol.TurnComplete:
+					last = e.CompletedTurns
+					if last == 20 {
+						cancel()
+					}
+				case gol.StateChange:
+					if e.NewState == gol.Quitting {
+						quitting = e.CompletedTurns
+					}
+				case gol.FinalTurnComplete:
+					t.Error("FinalTurnComplete sent after cancelling")
+				}
+			}
+			r := <-result
+			if r.err != context.Canceled {
+				t.Errorf("expected context.Canceled, got %v", r.err)
+			}
+			if last < 20 || r.turns != last || quitting != last {
+				t.Errorf("expected %d completed turns to be returned and reported quitting, got %d and %d", last, r.turns, quitting)
+			}
+			assertGoroutinesEnded(t, before)
+		})
+	}
+}
+
+// TestRunContextPaused checks that a paused run can be cancelled.
+func TestRunContextPaused(t *testing.T) {
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 1000000000, Threads: 4}
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan gol.Event)
+	keyPresses := make(chan rune, 1)
+	result := make(chan contextResult)
+	go func() {
+		turns, err := gol.RunContext(ctx, p, events, keyPresses)
+		result <- contextResult{turns, err}
+	}()
+
+	paused := -1
+	for event := range events {
+		switch e := event.(type) {
+		case gol.TurnComplete:
+			if e.CompletedTurns == 5 {
+				keyPresses <- 'p'
+			}
+		case gol.StateChange:
+			if e.NewState == gol.Paused {
+				paused = e.CompletedTurns
+				cancel()
+			}
+		}
+	}
+	r := <-result
+	if r.err != context.Canceled || paused < 5 || r.turns != paused {
+		t.Errorf("expected context.Canceled at turn %d, got %v at turn %d", paused, r.err, r.turns)
+	}
+	assertGoroutinesEnded(t, before)
+}
+
+// TestRunContextQuit checks that pressing 'q' ends the run with the world saved, rather than running on after
+// events has been closed.
+func TestRunContextQuit(t *testing.T) {
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 1000000000, Threads: 4}
+	before := runtime.NumGoroutine()
+	events := make(chan gol.Event)
+	keyPresses := make(chan rune, 1)
+	result := make(chan contextResult)
+	go func() {
+		turns, err := gol.RunContext(context.Background(), p, events, keyPresses)
+		result <- contextResult{turns, err}
+	}()
+
+	final := -1
+	for event := range events {
+		switch e := event.(type) {
+		case gol.TurnComplete:
+			if e.CompletedTurns == 10 {
+				keyPresses <- 'q'
+			}
+		case gol.FinalTurnComplete:
+			final = e.CompletedTurns
+		}
+	}
+	r := <-result
+	if r.err != nil || final < 10 || r.turns != final {
+		t.Errorf("expected the run to quit with the world of turn %d, got %v at turn %d", final, r.err, r.turns)
+	}
+	assertGoroutinesEnded(t, before)
+}
+
+// assertGoroutinesEnded waits up to a second for the number of goroutines to fall back to what it was before a run.
+func assertGoroutinesEnded(t *testing.T, before int) {
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Errorf("%d goroutines are still running, %d were before the run", runtime.NumGoroutine(), before)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
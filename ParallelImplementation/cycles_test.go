@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestCycleDetected checks that each engine finds the glider of the 16x16 image back where it started after 64 turns
+// on a torus, and settled into a block in the corner of a plane, sending a single CycleDetected event for each.
+func TestCycleDetected(t *testing.T) {
+	engines := []gol.Params{
+		{Threads: 4},
+		{Threads: 4, WorkStealing: true},
+		{Threads: 4, Packed: true},
+	}
+	for _, p := range engines {
+		p.ImageWidth, p.ImageHeight, p.Turns = 16, 16, 200
+		for _, topology := range []gol.Topology{gol.Torus, gol.Plane} {
+			p.Topology = topology
+			t.Run(fmt.Sprintf("%v-%v-%dx%dx%d-%d", engineName(p), p.Topology, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+				events := make(chan gol.Event)
+				go gol.Run(p, events, nil)
+				var cycles []gol.CycleDetected
+				for event := range events {
+					if e, ok := event.(gol.CycleDetected); ok {
+						cycles = append(cycles, e)
+					}
+				}
+				if len(cycles) != 1 {
+					t.Fatalf("expected 1 CycleDetected event, got %d", len(cycles))
+				}
+				e := cycles[0]
+				if e.CompletedTurns != e.FirstTurn+2*e.Period {
+					t.Errorf("cycle of period %d from turn %d confirmed on turn %d", e.Period, e.FirstTurn, e.CompletedTurns)
+				}
+				if topology == gol.Torus && (e.Period != 64 || e.FirstTurn != 0) {
+					t.Errorf("expected a cycle of period 64 from turn 0, got period %d from turn %d", e.Period, e.FirstTurn)
+				}
+				if topology == gol.Plane && e.Period != 1 {
+					t.Errorf("expected the glider to settle into a still life, got period %d", e.Period)
+				}
+			})
+		}
+	}
+}
+
+// TestFastForward checks that skipping whole cycles leaves the world as HashLife finds it after far more turns than
+// could be computed one at a time, and that the 512x512 image ends on its even turn population (see TestAlive).
+func TestFastForward(t *testing.T) {
+	tests := []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16, Turns: 1000000007, Threads: 4},
+		{ImageWidth: 64, ImageHeight: 64, Turns: 1000000007, Threads: 4},
+		{ImageWidth: 64, ImageHeight: 64, Turns: 1000000007, Threads: 4, WorkStealing: true},
+		{ImageWidth: 64, ImageHeight: 64, Turns: 1000000000, Threads: 4, Packed: true},
+	}
+	for _, p := range tests {
+		expectedAlive := runFinal(gol.Params{ImageWidth: p.ImageWidth, ImageHeight: p.ImageHeight, Turns: p.Turns, Threads: 1, HashLife: true})
+		p.FastForward = true
+		t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", engineName(p), p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+			assertEqualBoard(t, runFinal(p), expectedAlive, p)
+		})
+	}
+
+	p := gol.Params{ImageWidth: 512, ImageHeight: 512, Turns: 10000000000, Threads: 8, Packed: true, FastForward: true}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	for event := range events {
+		switch e := event.(type) {
+		case gol.FinalTurnComplete:
+			if e.CompletedTurns != p.Turns {
+				t.Errorf("FinalTurnComplete reported %d turns, expected %d", e.CompletedTurns, p.Turns)
+			}
+			if len(e.Alive) != 5565 {
+				t.Errorf("expected 5565 alive cells after %d turns, got %d", p.Turns, len(e.Alive))
+			}
+		}
+	}
+}
+
+// engineName names the engine the parameters run on, for the names of subtests.
+func engineName(p gol.Params) string {
+	switch {
+	case p.HashLife:
+		return "hashlife"
+	case p.Packed:
+		return "packed"
+	case p.WorkStealing:
+		return "stealing"
+	}
+	return "strips"
+}
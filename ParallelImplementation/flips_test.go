@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestCellsFlipped checks that each engine sends the cells changed by a turn in at most one CellsFlipped per worker,
+// never naming a cell twice in a turn, and that with NoFlips it sends no cell events at all but still reaches the
+// golden image.
+func TestCellsFlipped(t *testing.T) {
+	engines := []gol.Params{
+		{Threads: 4},
+		{Threads: 4, WorkStealing: true},
+		{Threads: 4, Packed: true},
+		{Threads: 1, HashLife: true},
+	}
+	expectedAlive := readAliveCells("check/images/64x64x100.pgm", 64, 64)
+	for _, p := range engines {
+		p.ImageWidth, p.ImageHeight, p.Turns = 64, 64, 100
+		t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", engineName(p), p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			batches := make(map[int]int)
+			flipped := make(map[int]map[util.Cell]bool)
+			for event := range events {
+				switch e := event.(type) {
+				case gol.CellFlipped:
+					t.Fatalf("CellFlipped sent for turn %d instead of a batch", e.CompletedTurns)
+				case gol.CellsFlipped:
+					//The cells alive in the image share turn 0 with the first turn's changes, so are left out
+					if e.CompletedTurns == 0 {
+						continue
+					}
+					batches[e.CompletedTurns]++
+					if flipped[e.CompletedTurns] == nil {
+						flipped[e.CompletedTurns] = make(map[util.Cell]bool)
+					}
+					for _, cell := range e.Cells {
+						if flipped[e.CompletedTurns][cell] {
+							t.Fatalf("cell %v flipped twice on turn %d", cell, e.CompletedTurns)
+						}
+						flipped[e.CompletedTurns][cell] = true
+					}
+				}
+			}
+			for turn := 1; turn < p.Turns; turn++ {
+				if batches[turn] > p.Threads {
+					t.Errorf("turn %d: %d CellsFlipped sent by %d workers", turn, batches[turn], p.Threads)
+				}
+			}
+		})
+
+		p.NoFlips = true
+		t.Run(fmt.Sprintf("%v-%dx%dx%d-%d-NoFlips", engineName(p), p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			var final []util.Cell
+			for event := range events {
+				switch e := event.(type) {
+				case gol.CellFlipped, gol.CellsFlipped, gol.CellStateChanged, gol.CellStatesChanged:
+					t.Fatalf("%T sent with NoFlips", event)
+				case gol.FinalTurnComplete:
+					final = e.Alive
+				}
+			}
+			assertEqualBoard(t, final, expectedAlive, p)
+		})
+	}
+
+	//Generations rules report the cells that change state in batches too, unless NoFlips is set
+	for _, p := range engines[:2] {
+		p.ImageWidth, p.ImageHeight, p.Turns, p.Rule, p.NoFlips = 64, 64, 10, "B2/S/C3", true
+		events := make(chan gol.Event)
+		go gol.Run(p, events, nil)
+		for event := range events {
+			switch event.(type) {
+			case gol.CellStateChanged, gol.CellStatesChanged:
+				t.Fatalf("%T sent with NoFlips for the rule %v by the %v engine", event, p.Rule, engineName(p))
+			}
+		}
+	}
+}
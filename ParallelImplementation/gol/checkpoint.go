@@ -0,0 +1,99 @@
+package gol
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// checkpointVersion is the version of the checkpoint format, written in the header of every checkpoint.
+const checkpointVersion = 1
+
+// checkpoint is a turn of a run saved to carry on from later: a line of JSON giving the version of the format, the
+// turn, the rule and the parameters of the run, followed by the world as a PGM image, with decaying cells of
+// Generations rules kept as grey levels.
+type checkpoint struct {
+	Version int
+	Turn    int
+	Rule    string
+	Params  Params
+	world   [][]uint8
+}
+
+// writeCheckpoint writes a checkpoint to w.
+func writeCheckpoint(w io.Writer, saved checkpoint, rule Rule) error {
+	saved.Version = checkpointVersion
+	saved.Rule = rule.String()
+	header, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(append(header, '\n')); err != nil {
+		return err
+	}
+	return writePgm(w, rule, saved.Turn, saved.world)
+}
+
+// readCheckpointHeader reads the header of a checkpoint, leaving reader at the start of its world.
+func readCheckpointHeader(reader *bufio.Reader) (checkpoint, error) {
+	var saved checkpoint
+	line, err := reader.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return saved, err
+	}
+	if err := json.Unmarshal(line, &saved); err != nil {
+		return saved, fmt.Errorf("invalid checkpoint header: %v", err)
+	}
+	if saved.Version != checkpointVersion {
+		return saved, fmt.Errorf("unsupported checkpoint version %d: expected %d", saved.Version, checkpointVersion)
+	}
+	if saved.Turn < 0 || saved.Params.ImageWidth <= 0 || saved.Params.ImageHeight <= 0 {
+		return saved, fmt.Errorf("invalid checkpoint of turn %d of a %dx%d world", saved.Turn, saved.Params.ImageWidth, saved.Params.ImageHeight)
+	}
+	return saved, nil
+}
+
+// readCheckpoint reads a checkpoint from r, checking that its world is the size its parameters give.
+func readCheckpoint(r io.Reader) (checkpoint, error) {
+	reader := bufio.NewReader(r)
+	saved, err := readCheckpointHeader(reader)
+	if err != nil {
+		return saved, err
+	}
+	image, err := readNetpbmImage(reader, false)
+	if err == io.EOF {
+		err = fmt.Errorf("checkpoint holds no world")
+	}
+	if err != nil {
+		return saved, err
+	}
+	width, height := saved.Params.ImageWidth, saved.Params.ImageHeight
+	if image.width != width || image.height != height {
+		return saved, fmt.Errorf("checkpoint world is %dx%d, not %dx%d", image.width, image.height, width, height)
+	}
+	levels := image.levels(0)
+	saved.world = make([][]uint8, height)
+	for y := range saved.world {
+		saved.world[y] = levels[y*width : (y+1)*width]
+	}
+	return saved, nil
+}
+
+// ReadCheckpoint returns the parameters and turn saved in the checkpoint at path, without reading its world.
+// Run carries on from the checkpoint with these parameters once Params.Resume is set to path.
+func ReadCheckpoint(path string) (Params, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Params{}, 0, err
+	}
+	defer file.Close()
+	saved, err := readCheckpointHeader(bufio.NewReader(file))
+	if err != nil {
+		return Params{}, 0, err
+	}
+	//The rule is given in full, in case the run started from a pattern giving its own rule
+	saved.Params.Rule = saved.Rule
+	return saved.Params, saved.Turn, nil
+}
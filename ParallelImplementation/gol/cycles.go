@@ -0,0 +1,132 @@
+package gol
+
+import "math/bits"
+
+// cycleHistory is how many of the most recent turns are remembered when looking for a repeated world,
+// which is the longest period that can be found.
+const cycleHistory = 4096
+
+// zobristSeed is the fixed seed the keys of the cells are drawn from, so the same world always has the same hash.
+const zobristSeed = 1
+
+// zobrist gives a random key to every cell of the world. The hash of a world is the XOR of the keys of its live
+// cells, each multiplied by the state of the cell, so when a cell changes its term can be XORed out and the new one in
+// without rehashing the rest of the world. The keys are odd, so different states of a cell give different terms.
+// No key is stored: the key of cell i is the (i+1)th number of a SplitMix64 generator seeded with zobristSeed, which
+// can be found straight from i, so even the largest worlds need no table of keys.
+type zobrist struct {
+	width int
+}
+
+func newZobrist(p Params) *zobrist {
+	return &zobrist{width: p.ImageWidth}
+}
+
+// term returns what cell (y, x) adds to the hash when it holds the given value.
+func (z *zobrist) term(y, x int, value uint8) uint64 {
+	key := splitMix64(zobristSeed + uint64(y*z.width+x)*0x9E3779B97F4A7C15)
+	return (key.next() | 1) * uint64(value)
+}
+
+// hash returns the hash of the whole world.
+func (z *zobrist) hash(p Params, world func(y, x int) uint8) uint64 {
+	var hash uint64
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth; x++ {
+			hash ^= z.term(y, x, world(y, x))
+		}
+	}
+	return hash
+}
+
+// packedHash returns the hash of a packed world, visiting only its alive cells.
+func (z *zobrist) packedHash(w *packedWorld) uint64 {
+	var hash uint64
+	for y, row := range w.rows {
+		for i, word := range row {
+			for word != 0 {
+				x := i*64 + bits.TrailingZeros64(word)
+				hash ^= z.term(y, x, 255)
+				word &= word - 1
+			}
+		}
+	}
+	return hash
+}
+
+// cycleDetector remembers the hashes of the last cycleHistory turns, to spot when the world comes back to a state
+// it has been in before. From then on the world repeats forever: it is a still life or an oscillator, or it has only
+// spaceships that travel all the way around the world.
+type cycleDetector struct {
+	turns     map[uint64]int  // the turn each remembered hash was seen on
+	hashes    []uint64        // the remembered hashes, oldest first
+	candidate *cycleCandidate // the cycle a repeated hash suggests, until it is confirmed or ruled out
+}
+
+// cycleCandidate is a cycle suggested by a repeated hash, along with a copy of the world on the turn the hash
+// repeated, to compare with the world a period later.
+type cycleCandidate struct {
+	period, firstTurn int
+	turn              int
+	world             [][]uint8
+}
+
+func newCycleDetector() *cycleDetector {
+	return &cycleDetector{turns: make(map[uint64]int)}
+}
+
+// add remembers the hash of the world on a turn. If the world was the same on an earlier turn it returns the period
+// of the cycle and the first turn of it. The first repeat found is at the start of the cycle, as the turn before
+// the repeat would otherwise have repeated too.
+func (d *cycleDetector) add(hash uint64, turn int) (period, firstTurn int, ok bool) {
+	if first, ok := d.turns[hash]; ok {
+		return turn - first, first, true
+	}
+	if len(d.hashes) == cycleHistory {
+		delete(d.turns, d.hashes[0])
+		d.hashes = d.hashes[1:]
+	}
+	d.turns[hash] = turn
+	d.hashes = append(d.hashes, hash)
+	return 0, 0, false
+}
+
+// confirm remembers the hash of the world on a turn, returning a cycle only once it is certain of it. Different worlds
+// can share a hash, so a repeated hash only suggests a cycle: the world is copied, and the cycle is returned if the
+// world is exactly the same again a period later. Otherwise the hashes are looked through as before.
+func (d *cycleDetector) confirm(hash uint64, turn int, p Params, world func(y, x int) uint8) (period, firstTurn int, ok bool) {
+	if c := d.candidate; c != nil && turn == c.turn+c.period {
+		d.candidate = nil
+		if sameWorld(p, c.world, world) {
+			return c.period, c.firstTurn, true
+		}
+	}
+	if period, firstTurn, ok := d.add(hash, turn); ok && d.candidate == nil {
+		d.candidate = &cycleCandidate{period: period, firstTurn: firstTurn, turn: turn, world: copyWorld(p, world)}
+	}
+	return 0, 0, false
+}
+
+// copyWorld returns a copy of the world held by whichever engine is running.
+func copyWorld(p Params, world func(y, x int) uint8) [][]uint8 {
+	copied := make([][]uint8, p.ImageHeight)
+	for y := range copied {
+		copied[y] = make([]uint8, p.ImageWidth)
+		for x := range copied[y] {
+			copied[y][x] = world(y, x)
+		}
+	}
+	return copied
+}
+
+// sameWorld reports whether every cell of the world holds the same value as in the copy.
+func sameWorld(p Params, copied [][]uint8, world func(y, x int) uint8) bool {
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth; x++ {
+			if copied[y][x] != world(y, x) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -1,151 +1,161 @@
 package gol
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"time"
+
+	"uk.ac.bris.cs/gameoflife/census"
+	"uk.ac.bris.cs/gameoflife/pattern"
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
 type distributorChannels struct {
-	events     chan<- Event
-	ioCommand  chan<- ioCommand
-	ioIdle     <-chan bool
-	ioFilename chan<- string
-	ioOutput   chan<- uint8
-	ioInput    <-chan uint8
+	events       chan<- Event
+	ioCommand    chan<- ioCommand
+	ioIdle       <-chan error
+	ioLoaded     <-chan error
+	ioFilename   chan<- string
+	ioTurn       chan<- int
+	ioOutput     chan<- uint8
+	ioInput      <-chan uint8
+	ioMacrocell  chan hashLifeWorld
+	ioCensus     chan<- []census.Tally
+	ioStatistic  chan<- TurnStatistics
+	ioPattern    chan pattern.Pattern
+	ioCheckpoint chan checkpoint
 }
 
-// distributor divides the work between workers and interacts with other goroutines.
-func distributor(p Params, c distributorChannels, keyPresses <-chan rune) {
-	//Send command to IO, asking to run readPgmImage function
-	c.ioCommand <- 1
-
-	//Construct filename from image height and width
-	//Send filename to IO, allowing readPgmImage function to process input of image
-	filename := strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight)
-	c.ioFilename <- filename
-
-	//Create a 2D slice to store the world.
-	golWorld := make([][]uint8, p.ImageHeight)
-	for y := range golWorld {
-		golWorld[y] = make([]uint8, p.ImageWidth)
-	}
-
-	//Loop through 2d slice initializing each cell
-	for y := 0; y < p.ImageHeight; y++ {
-		for x := 0; x < p.ImageWidth; x++ {
-			//Receive data from channel and assign to 2d slice
-			b := <- c.ioInput
-			golWorld[y][x] = b
-			if b == 255 {
-				//Let the event component know which cells start alive
-				c.events <- CellFlipped{CompletedTurns: 0, Cell: util.Cell{X: x, Y: y}}
-			}
+// distributor runs the turns of the simulation up to p.Turns and interacts with other goroutines.
+// It returns the last completed turn, and the IOError of the first file that could not be read or written, if any.
+// Cancelling ctx leaves the turn loop as soon as the turn being computed is complete, returning ctx.Err().
+// Checkpoints are written every p.CheckpointTurns turns and every p.CheckpointInterval, and when quitting early.
+func distributor(ctx context.Context, s *Simulation, keyPresses <-chan rune) (int, error) {
+	p, c := s.p, s.c
+
+	//Ticking every 2 seconds to report the alive cell count, until the distributor returns
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	//Every way out of the turn loop closes the simulation, stopping the workers and the io goroutine,
+	//and closing events exactly once
+	stop := func(err error) (int, error) {
+		if ioError := s.Close(); err == nil {
+			err = ioError
 		}
+		return s.turn, err
 	}
 
-	//Initialize turns to 0
-	turn := 0
-
-	//Setting up chan for 2 second updates
-	timesUp := make(chan int)
-	//Running go routine to be flagging for updates every 2 seconds
-	go timer(timesUp)
-
-	//SINGLE THREAD IMPLEMENTATION FOR WHEN THREADS = 1
-	if p.Threads == 1 {
-		//Execute all turns of the Game of Life.
-		for t := 0; t < p.Turns; t++ {
-
-			immutableData := makeImmutableMatrix(golWorld)
-
-			select {
-				case <- timesUp:
-					//Check if 2 seconds has passed - if so report alive cell count to events
-					c.events <- AliveCellsCount{CompletedTurns: t, CellsCount: len(calculateAliveCells(p, immutableData))}
-				case key := <- keyPresses:
-					handleKeyPress(key, t, filename + "x" + strconv.Itoa(t), immutableData, p, c, keyPresses)
-				default:
-					//If timer not up, or not user input: do nothing :)
-			}
-
-			golWorld = calculateNextState(0, p.ImageHeight, 0, p.ImageWidth, immutableData, c, t, p)
-			turn++
-			//Report the completion of each turn
-			c.events <- TurnComplete{CompletedTurns: turn}
-		}
-	} else {
-		//PARALLELED MULTIPLE THREAD IMPLEMENTATION
-		//Creating slice of channels, initialized with channels, for each worker goroutine
-		channels := []chan [][]uint8{}
-		for i := 0; i < p.Threads; i++ {
-			newChan := make(chan [][]uint8)
-			channels = append(channels, newChan)
+	//Ticking every p.CheckpointInterval to write a checkpoint, if checkpoints are written on a timer
+	var checkpointTicks <-chan time.Time
+	if p.CheckpointInterval > 0 {
+		checkpointTicker := time.NewTicker(p.CheckpointInterval)
+		defer checkpointTicker.Stop()
+		checkpointTicks = checkpointTicker.C
+	}
+	checkpointed := s.turn
+	checkpoint := func() {
+		s.checkpoint()
+		checkpointed = s.turn
+	}
+	//Quitting early keeps the turns computed since the last checkpoint, so the run can be resumed from there
+	quit := func(err error) (int, error) {
+		if (p.CheckpointTurns > 0 || p.CheckpointInterval > 0) && s.turn != checkpointed {
+			checkpoint()
 		}
+		return stop(err)
+	}
 
-		//Defining the height of image for each worker
-		cuttingHeight := p.ImageHeight/p.Threads
-
-		//Execute all turns of the Game of Life.
-		for t := 0; t < p.Turns; t++ {
-
-			//Wrapping starting world in closure
-			immutableData := makeImmutableMatrix(golWorld)
-
-			select {
-				//Check if 2 seconds has passed - if so report alive cell count to events
-				case <-timesUp:
-					c.events <- AliveCellsCount{CompletedTurns: t, CellsCount: len(calculateAliveCells(p, immutableData))}
-				case key := <- keyPresses:
-					handleKeyPress(key, t, filename + "x" + strconv.Itoa(t), immutableData, p, c, keyPresses)
-				default:
-					//If time not up, or not user input: do nothing extra
-			}
-
-			//Creating var to store new world data in
-			var newGolWorld [][]uint8
-
-			//Assigning each goroutine, their slice of the image, and respective channel
-			for i := 0; i < p.Threads; i++ {
-				startHeight := i * cuttingHeight
-				endHeight := (i + 1) * cuttingHeight
-				if i == p.Threads-1 {
-					endHeight = p.ImageHeight
+	//Execute all turns of the Game of Life.
+	for s.turn < p.Turns {
+
+		select {
+			//Check if 2 seconds has passed - if so report alive cell count to events
+			case <-ticker.C:
+				c.events <- AliveCellsCount{CompletedTurns: s.turn, CellsCount: len(s.AliveCells())}
+			case <-checkpointTicks:
+				checkpoint()
+			case <-ctx.Done():
+				return quit(ctx.Err())
+			case key := <- keyPresses:
+				if handleKeyPress(ctx, key, s.turn, s.filename + "x" + strconv.Itoa(s.turn), s.immutable(), p, c, keyPresses) {
+					return quit(ctx.Err())
 				}
-				go worker(startHeight, endHeight, p, immutableData, c, t, channels[i])
-			}
-
-			//Receive all data back from worker goroutines and stitch image back together
-			for i := 0; i < p.Threads; i++ {
-				newGolWorld = append(newGolWorld, <-channels[i]...)
-			}
-
-			golWorld = newGolWorld
+			default:
+				//If time not up, or not user input: do nothing extra
+		}
 
-			turn++
-			//Report the completion of each turn
-			c.events <- TurnComplete{CompletedTurns: turn}
+		s.advance(p.Turns - s.turn)
+		if p.CheckpointTurns > 0 && s.turn-checkpointed >= p.CheckpointTurns {
+			checkpoint()
 		}
 	}
 
-	immutableData := makeImmutableMatrix(golWorld)
-
 	//Output final state as PGM image
-	outputImage(filename + "x" + strconv.Itoa(p.Turns), turn, immutableData, p, c)
+	immutableData := s.immutable()
+	outputImage(s.filename + "x" + strconv.Itoa(p.Turns), s.turn, immutableData, p, c)
+	if s.hashLife != nil {
+		//Also save the quadtree as a Macrocell file, which stays small however large the world is
+		c.ioCommand <- ioOutputMacrocell
+		c.ioFilename <- s.filename + "x" + strconv.Itoa(p.Turns)
+		c.ioMacrocell <- hashLifeWorld{universe: s.hashLife.universe, world: s.hashLife.world, turn: s.turn}
+	}
+
+	if s.pool != nil {
+		//Report how evenly the work was shared between the workers
+		c.events <- WorkerStatistics{CompletedTurns: s.turn, Busy: s.pool.busy()}
+	}
 
 	//Report the final state using FinalTurnCompleteEvent.
 	aliveCells := calculateAliveCells(p, immutableData)
-	c.events <- FinalTurnComplete{CompletedTurns: turn, Alive: aliveCells}
+	if s.rule.String() == DefaultRule {
+		//Name the objects left in the world, which the catalogue knows for Conway's Life only
+		objects := census.Take(aliveCells, p.ImageWidth, p.ImageHeight, func(y, x int) (int, int, bool) {
+			return p.Topology.locate(y, x, p.ImageHeight, p.ImageWidth)
+		})
+		c.events <- ObjectCensus{CompletedTurns: s.turn, Objects: objects}
+		c.ioCommand <- ioOutputCensus
+		c.ioFilename <- s.filename + "x" + strconv.Itoa(p.Turns)
+		c.ioTurn <- s.turn
+		c.ioCensus <- objects
+	}
+	c.events <- FinalTurnComplete{CompletedTurns: s.turn, Alive: aliveCells}
+	return stop(nil)
+}
 
+// finish waits for the io goroutine to finish any output before ending it, then reports that execution is quitting
+// and closes events. It returns the first failure of the io goroutine.
+func finish(turn int, c distributorChannels) error {
 	// Make sure that the Io has finished any output before exiting.
 	c.ioCommand <- ioCheckIdle
-	<-c.ioIdle
+	err := <-c.ioIdle
+	close(c.ioCommand)
 
 	c.events <- StateChange{turn, Quitting}
-	
+
 	// Close the channel to stop the SDL goroutine gracefully. Removing may cause deadlock.
 	close(c.events)
+	return err
+}
+
+// worldHash returns the Zobrist hash of the current turn of the world held by the workers or the packed engine.
+func worldHash(keys *zobrist, pool scheduler, packed *packedEngine) uint64 {
+	if packed != nil {
+		return keys.packedHash(packed.current)
+	}
+	return pool.hash()
+}
+
+// lastCounts returns how many cells were born and how many died on the last turn of whichever engine is running.
+func lastCounts(pool scheduler, packed *packedEngine, hashLife *hashLifeEngine) (births, deaths int) {
+	if hashLife != nil {
+		return hashLife.last.births, hashLife.last.deaths
+	}
+	if packed != nil {
+		return packed.last.births, packed.last.deaths
+	}
+	return pool.counts()
 }
 
 // makeImmutableMatrix takes an existing 2D matrix and wraps it in a getter closure.
@@ -155,77 +165,36 @@ func makeImmutableMatrix(matrix [][]uint8) func(y, x int) uint8 {
 	}
 }
 
-func worker(startY int, endY int, p Params, data func(y, x int) uint8, c distributorChannels, turns int, outputChan chan<- [][]uint8) {
-	newPixelData := calculateNextState(startY, endY, 0, p.ImageWidth, data, c, turns, p)
-	outputChan <- newPixelData
-}
-//Used to 2 second reporting ticker
-//Input: A channel of type int
+//Input: c of type distributorChannels allowing function to report events
+//Input: rule of type Rule deciding which event describes the change
+//Input: turn, cell and value describing which cell took which new value on which turn
 //No return
-func timer(timesUpChan chan int) {
-	for {
-		timesUpChan <- 1
-		time.Sleep(time.Second * 2)
+func reportCellChange(c distributorChannels, rule Rule, turn int, cell util.Cell, value uint8) {
+	c.events <- cellChange(rule, turn, cell, value)
+}
 
+// reportCellsFlipped sends the cells that flipped on a turn as one CellsFlipped event, unless there are none.
+func reportCellsFlipped(c distributorChannels, turn int, cells []util.Cell) {
+	if len(cells) > 0 {
+		c.events <- CellsFlipped{CompletedTurns: turn, Cells: cells}
 	}
 }
 
-//Input: p of type Params containing data about the world
-//Input: world of type 2d uint8 slice containing world data
-//Input: c of type distributorChannels allowing function to report events
-//Input: turn of type int to allow reported events to contain correct turn number
-//Returns: world of type 2d uint8 slice containing the updated world data
-
-func calculateNextState(startY, endY, startX, endX int, data func(y, x int) uint8, c distributorChannels, turn int, p Params) [][]uint8 {
-
-	//Create future state of world
-	future := make([][]uint8, p.ImageHeight)
-	for i := range future {
-		future[i] = make([]uint8, p.ImageWidth)
+// reportCellStatesChanged sends the cells of a Generations rule that took new states on a turn as one
+// CellStatesChanged event, unless there are none.
+func reportCellStatesChanged(c distributorChannels, turn int, cells []util.Cell, states []uint8) {
+	if len(cells) > 0 {
+		c.events <- CellStatesChanged{CompletedTurns: turn, Cells: cells, States: states}
 	}
+}
 
-	//Loop through every cell in given range
-	for i := startY; i < endY; i++ {
-		for j := 0; j < p.ImageWidth; j++ {
-
-			//find number of neighbours alive
-			aliveNeighbours := 0
-			for n := -1; n < 2; n++ {
-				for m := -1; m < 2; m++ {
-					// Adjusting for edge cases (closed domain)
-					x := (i + n + p.ImageHeight) % p.ImageHeight
-					y := (j + m + p.ImageWidth) % p.ImageWidth
-
-					if data(x,y) == 255 { // Checks if each neighbour cell is alive
-						aliveNeighbours++
-					}
-				}
-			}
-
-			//Adjusts in case current cell is also alive (it would have got counted in the above calculations but is not a neighbour)
-			if data(i, j) == 255 {
-				aliveNeighbours -= 1
-			}
-
-			//Implement rules of life
-			if (data(i, j) == 255) && (aliveNeighbours < 2) { 			//cell is alive but lonely and dies
-				future[i][j] = 0
-				c.events <- CellFlipped{CompletedTurns: turn, Cell: util.Cell{X: j, Y: i}}
-			} else if (data(i, j) == 255) && (aliveNeighbours > 3) {     //cell dies due to overpopulation
-				future[i][j] = 0
-				c.events <- CellFlipped{CompletedTurns: turn, Cell: util.Cell{X: j, Y: i}}
-			} else if (data(i, j) == 0) && (aliveNeighbours == 3) {    		//a new cell is born
-				future[i][j] = 255
-				c.events <- CellFlipped{CompletedTurns: turn, Cell: util.Cell{X: j, Y: i}}
-			} else {
-				future[i][j] = data(i, j)									//no change
-			}
-		}
+// cellChange returns the event describing a cell taking a new value on a turn: a CellStateChanged under
+// Generations rules, and otherwise a CellFlipped.
+func cellChange(rule Rule, turn int, cell util.Cell, value uint8) Event {
+	if rule.States > 2 {
+		return CellStateChanged{CompletedTurns: turn, Cell: cell, State: value}
 	}
-	//trim future world
-	future = future[startY:endY]
-
-	return future
+	return CellFlipped{CompletedTurns: turn, Cell: cell}
 }
 
 //Input: p of type Params containing data about the world
@@ -252,6 +221,7 @@ func calculateAliveCells(p Params, data func(y, x int) uint8) []util.Cell {
 func outputImage(filename string, t int, data func(y, x int) uint8, p Params, c distributorChannels) {
 	c.ioCommand <- 0
 	c.ioFilename <- filename
+	c.ioTurn <- t
 	for y := 0; y < p.ImageHeight; y++ {
 		for x := 0; x < p.ImageWidth; x++ {
 			c.ioOutput <- data(y, x)
@@ -260,10 +230,25 @@ func outputImage(filename string, t int, data func(y, x int) uint8, p Params, c
 	c.events <- ImageOutputComplete{CompletedTurns: t, Filename: filename}
 }
 
-func handleKeyPress(key rune, t int, filename string, data func(y, x int) uint8, p Params, c distributorChannels, keyPresses <-chan rune) {
+//Sends the alive cells of the world to IO to be written to a pattern file in the snapshot format
+func outputPattern(filename string, t int, data func(y, x int) uint8, p Params, c distributorChannels) {
+	c.ioCommand <- ioOutputPattern
+	c.ioFilename <- filename
+	c.ioTurn <- t
+	c.ioPattern <- boardPattern(p, t, data)
+	c.events <- ImageOutputComplete{CompletedTurns: t, Filename: filename}
+}
+
+// handleKeyPress acts on a key pressed between turns. It returns true when no more turns should be run:
+// once 'q' has saved the world, or when ctx is cancelled while paused.
+func handleKeyPress(ctx context.Context, key rune, t int, filename string, data func(y, x int) uint8, p Params, c distributorChannels, keyPresses <-chan rune) bool {
 	switch key {
 	case 's':
-		outputImage(filename, t, data, p, c)
+		if p.SnapshotFormat == "" || p.SnapshotFormat == "pgm" {
+			outputImage(filename, t, data, p, c)
+		} else {
+			outputPattern(filename, t, data, p, c)
+		}
 	case 'q':
 		//Output final state as PGM image
 		outputImage(filename, t, data, p, c)
@@ -271,15 +256,7 @@ func handleKeyPress(key rune, t int, filename string, data func(y, x int) uint8,
 		//Report the final state using FinalTurnCompleteEvent.
 		aliveCells := calculateAliveCells(p, data)
 		c.events <- FinalTurnComplete{CompletedTurns: t, Alive: aliveCells}
-
-		// Make sure that the Io has finished any output before exiting.
-		c.ioCommand <- ioCheckIdle
-		<-c.ioIdle
-
-		c.events <- StateChange{t, Quitting}
-
-		// Close the channel to stop the SDL goroutine gracefully. Removing may cause deadlock.
-		close(c.events)
+		return true
 	case 'p':
 		c.events <- StateChange{
 			CompletedTurns: t,
@@ -287,17 +264,23 @@ func handleKeyPress(key rune, t int, filename string, data func(y, x int) uint8,
 		}
 		unpaused := false
 		for !unpaused {
-			switch <-keyPresses {
-			case 'p':
-				unpaused = true
-				fmt.Println("Continuing...")
-				c.events <- StateChange{
-					CompletedTurns: t,
-					NewState:       Executing,
+			select {
+			case <-ctx.Done():
+				return true
+			case key := <-keyPresses:
+				switch key {
+				case 'p':
+					unpaused = true
+					fmt.Println("Continuing...")
+					c.events <- StateChange{
+						CompletedTurns: t,
+						NewState:       Executing,
+					}
+				default:
+					fmt.Println("Press 'p' to resume. No other functionality available whilst paused.")
 				}
-			default:
-				fmt.Println("Press 'p' to resume. No other functionality available whilst paused.")
 			}
 		}
 	}
+	return false
 }
\ No newline at end of file
@@ -1,39 +1,236 @@
 package gol
 
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/pattern"
+)
+
 // Params provides the details of how to run the Game of Life and which image to load.
 type Params struct {
 	Turns       int
 	Threads     int
 	ImageWidth  int
 	ImageHeight int
+	Rule        string   // Rulestring in B/S notation, e.g. "B36/S23". Defaults to DefaultRule.
+	Topology    Topology // How the edges of the world are joined. Defaults to Torus.
+	Packed      bool     // Store the world 64 cells to a uint64 word. Only two-state rules of the 8 surrounding cells can be packed.
+	HashLife    bool     // Run with HashLife, jumping 2^k turns at a time. Needs a square torus with sides a power of two.
+	Macrocell   string   // Path of a Macrocell (.mc) file to start HashLife from instead of the PGM image.
+
+	// HashLifeNodes is the most nodes HashLife keeps before forgetting the steps it has memoised and every node the
+	// world no longer uses, so that long runs of chaotic worlds do not run out of memory. Defaults to 2^21 nodes,
+	// a few hundred megabytes.
+	HashLifeNodes int
+
+	// Input is the path of the PBM or PGM image to start from, images/<ImageWidth>x<ImageHeight>.pgm when left empty.
+	// ImageWidth and ImageHeight are read from its header when left 0, and must agree with it otherwise.
+	// PNG, JPEG and GIF images are scaled to ImageWidth by ImageHeight instead, and binarised: see Binarisation.
+	// RLE (.rle), plaintext (.cells) and Life 1.06 (.lif) patterns can be given too: see OffsetX and Centre.
+	Input string
+
+	// ImageIndex chooses the image to start from when Input holds several PBM or PGM images, counting from 0.
+	ImageIndex int
+
+	// AliveThreshold, between 0 and 1, makes the pixels of the input image at least that fraction of its maxval
+	// alive and every other pixel dead. Left 0, pixels are scaled to grey levels and snapped to the states of the rule.
+	AliveThreshold float64
+
+	// Binarisation chooses how the pixels of a PNG, JPEG or GIF image become alive or dead, by their brightness.
+	// Bright pixels are alive, or with Invert, dark pixels.
+	Binarisation Binarisation
+	Invert       bool
+
+	// Soup, given a density above 0, starts from a random soup instead of an image, so Input must be left empty.
+	Soup Soup
+
+	// A pattern given as Input has its top left corner placed at (OffsetX, OffsetY) on the board, or with Centre,
+	// is centred on the board and then moved by the offset. The board is the size of the pattern when ImageWidth
+	// and ImageHeight are left 0, and the rule in the header of an RLE pattern is used when Rule is left empty.
+	OffsetX int
+	OffsetY int
+	Centre  bool
+
+	// SnapshotFormat is the format of the snapshots saved by pressing 's': pgm, the default, or rle, cells or lif.
+	// Decaying cells of Generations rules are only kept in PGM images.
+	SnapshotFormat string
+
+	// TileWidth and TileHeight give the size of the tile of the world each worker owns, with a worker for every tile.
+	// Leaving both 0 cuts the world into Threads horizontal strips, and AutoTiles chooses a grid of Threads tiles.
+	// A 0 alongside a size spans the whole world in that direction.
+	TileWidth  int
+	TileHeight int
+
+	// WorkStealing splits every turn into chunks of rows on a shared queue that idle workers take from,
+	// instead of giving each worker a fixed part of the world.
+	WorkStealing bool
+
+	// FastForward stops computing turns once the world repeats an earlier turn, moving the turn counter on by
+	// whole cycles to the last cycle before Turns. Only the turns of that last part cycle are computed.
+	FastForward bool
+
+	// PopulationCSV writes the number of alive cells after every turn to a CSV file beside the final PGM image,
+	// in the same format as check/alive. Turns skipped by FastForward are left out.
+	PopulationCSV bool
+
+	// NoFlips sends no CellFlipped, CellsFlipped, CellStateChanged or CellStatesChanged events, for runs with nothing
+	// to draw the cells on. The engines then skip gathering the cells that change every turn.
+	NoFlips bool
+
+	// Resume is the path of a checkpoint to carry on from, instead of loading the starting world: the run continues
+	// from the turn and world saved in it, up to Turns. The other parameters should be those ReadCheckpoint returns.
+	Resume string
+
+	// CheckpointTurns and CheckpointInterval write a checkpoint of the run to out/ every so many turns, and every so
+	// often, replacing the last one without ever leaving a partly written checkpoint behind. 0 turns them off.
+	// Quitting early writes a last checkpoint too while either is set.
+	CheckpointTurns    int
+	CheckpointInterval time.Duration
 }
 
+// AutoTiles, given as Params.TileWidth or TileHeight, divides the world into a grid of Params.Threads tiles
+// as close to square as the world allows.
+const AutoTiles = -1
+
 // Run starts the processing of Game of Life. It initialises channels and goroutines.
-func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
-	ioCommand := make(chan ioCommand)
-	filename := make(chan string)
-	output := make(chan uint8)
-	input := make(chan uint8)
-	ioIdle := make(chan bool)
-
-	ioChannels := ioChannels{
-		command:  ioCommand,
-		idle:     ioIdle,
-		filename: filename,
-		output:   output,
-		input:    input,
-	}
-	go startIo(p, ioChannels)
-
-	distributorChannels := distributorChannels{
-		events:     events,
-		ioCommand:  ioCommand,
-		ioIdle:     ioIdle,
-		ioFilename: filename,
-		ioOutput:   output,
-		ioInput:    input,
-	}
-	distributor(p, distributorChannels, keyPresses)
+// An error is returned, and events closed, if the parameters are rejected before the first turn.
+// Files that cannot be read or written are reported as IOError events, and the first is returned once events is closed.
+func Run(p Params, events chan<- Event, keyPresses <-chan rune) error {
+	_, err := RunContext(context.Background(), p, events, keyPresses)
+	return err
+}
+
+// RunContext is Run that can be cancelled through ctx, returning the number of completed turns as well.
+// Once cancelled, the turn being computed is finished, the workers, ticker and io goroutine are stopped and events
+// is closed after a Quitting StateChange, without saving the world or sending FinalTurnComplete. ctx.Err() is returned.
+// events must be read until it is closed, however the run ends.
+func RunContext(ctx context.Context, p Params, events chan<- Event, keyPresses <-chan rune) (int, error) {
+	sim, err := newSimulation(p, events)
+	if err != nil {
+		return 0, err
+	}
+	return distributor(ctx, sim, keyPresses)
+}
+
+// validate checks the parameters before anything is loaded, filling in any that are read from the input,
+// and returns the rule the world runs under.
+func validate(p *Params) (Rule, error) {
+	if p.ImageIndex < 0 || p.AliveThreshold < 0 || p.AliveThreshold > 1 {
+		return Rule{}, fmt.Errorf("invalid image index %d or alive threshold %v", p.ImageIndex, p.AliveThreshold)
+	}
+	if p.Binarisation < Threshold || p.Binarisation > FloydSteinberg {
+		return Rule{}, fmt.Errorf("invalid binarisation %v", p.Binarisation)
+	}
+	if p.Input != "" && p.Resume == "" {
+		if err := inspectInput(p); err != nil {
+			return Rule{}, err
+		}
+	}
+	rule, err := ParseRule(p.Rule)
+	if err != nil {
+		return Rule{}, err
+	}
+	if p.ImageWidth <= 0 || p.ImageHeight <= 0 {
+		return Rule{}, fmt.Errorf("invalid image size %dx%d", p.ImageWidth, p.ImageHeight)
+	}
+	if p.Soup.Density != 0 {
+		if err := p.Soup.check(*p); err != nil {
+			return Rule{}, err
+		}
+		if p.Input != "" || p.Macrocell != "" {
+			return Rule{}, fmt.Errorf("cannot start from both a random soup and %v", p.Input+p.Macrocell)
+		}
+	}
+	if p.Packed && !rule.canPack() {
+		return Rule{}, fmt.Errorf("rule %v cannot run on a packed world: only two-state rules counting the 8 surrounding cells can", rule)
+	}
+	if p.HashLifeNodes < 0 {
+		return Rule{}, fmt.Errorf("invalid limit of %d HashLife nodes", p.HashLifeNodes)
+	}
+	if p.HashLife {
+		if _, err := hashLifeLevel(*p, rule); err != nil {
+			return Rule{}, err
+		}
+		if p.Packed {
+			return Rule{}, fmt.Errorf("HashLife cannot run on a packed world")
+		}
+	}
+	if p.TileWidth < AutoTiles || p.TileHeight < AutoTiles {
+		return Rule{}, fmt.Errorf("invalid tile size %dx%d", p.TileWidth, p.TileHeight)
+	}
+	if p.WorkStealing && (p.Packed || p.HashLife || p.TileWidth != 0 || p.TileHeight != 0) {
+		return Rule{}, fmt.Errorf("work stealing cannot be used with the packed or HashLife engines, or with tiles")
+	}
+	if p.FastForward && p.HashLife {
+		return Rule{}, fmt.Errorf("HashLife does not look for cycles to fast-forward through")
+	}
+	if p.Macrocell != "" && !p.HashLife {
+		return Rule{}, fmt.Errorf("Macrocell files can only be loaded by HashLife")
+	}
+	if p.Macrocell != "" && p.Input != "" {
+		return Rule{}, fmt.Errorf("cannot start from both a Macrocell file and a PGM image")
+	}
+	if p.CheckpointTurns < 0 || p.CheckpointInterval < 0 {
+		return Rule{}, fmt.Errorf("invalid checkpoints every %d turns and every %v", p.CheckpointTurns, p.CheckpointInterval)
+	}
+	if p.SnapshotFormat != "" && p.SnapshotFormat != "pgm" {
+		if _, err := pattern.ParseFormat(p.SnapshotFormat); err != nil {
+			return Rule{}, err
+		}
+	}
+	return rule, nil
 }
 
+// inspectInput fills in the width and height of the world from the header of the input image, checking any size
+// that was given against it. A pattern is instead checked to fit on the board, which is the size of the pattern
+// unless given, and its rule used unless another is given.
+func inspectInput(p *Params) error {
+	loaded, isPattern, err := readPattern(p.Input)
+	if err != nil {
+		return err
+	}
+	if isPattern {
+		if p.ImageWidth == 0 {
+			p.ImageWidth = loaded.Width
+		}
+		if p.ImageHeight == 0 {
+			p.ImageHeight = loaded.Height
+		}
+		if p.Rule == "" {
+			p.Rule = loaded.Rule
+		}
+		_, err := placePattern(*p, loaded)
+		return err
+	}
+
+	width, height, err := ImageSize(p.Input, p.ImageIndex)
+	if err != nil {
+		return err
+	}
+	if _, isPhoto, _ := photoConfig(p.Input); isPhoto {
+		//Photos are scaled to any size of board, which is the size of the photo unless given
+		if p.ImageWidth == 0 {
+			p.ImageWidth = width
+		}
+		if p.ImageHeight == 0 {
+			p.ImageHeight = height
+		}
+		return nil
+	}
+	if (p.ImageWidth != 0 && p.ImageWidth != width) || (p.ImageHeight != 0 && p.ImageHeight != height) {
+		return fmt.Errorf("%v is %dx%d, not %dx%d", p.Input, width, height, p.ImageWidth, p.ImageHeight)
+	}
+	p.ImageWidth, p.ImageHeight = width, height
+	return nil
+}
 
+// imagePath returns the path of the PGM image the world starts from.
+func imagePath(p Params) string {
+	if p.Input != "" {
+		return p.Input
+	}
+	return "images/" + strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight) + ".pgm"
+}
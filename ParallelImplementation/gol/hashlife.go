@@ -0,0 +1,366 @@
+package gol
+
+import (
+	"fmt"
+	"math"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// hashNode is a square of 2^level cells in a HashLife quadtree. Nodes are canonical: there is only one node
+// for each combination of children, so equal squares anywhere in the world, and at any turn, share their results.
+// Level 0 nodes are single cells.
+type hashNode struct {
+	nw, ne, sw, se *hashNode
+	level          uint
+	population     int64     // saturates at math.MaxInt64 on the huge nodes used for long jumps
+	next           *hashNode // the centre of the node 2^(level-2) turns later, once it has been computed
+}
+
+type quadrants struct {
+	nw, ne, sw, se *hashNode
+}
+
+type stepKey struct {
+	node  *hashNode
+	turns uint
+}
+
+// defaultHashLifeNodes is how many nodes a HashLife universe keeps before collecting, when Params.HashLifeNodes is 0.
+const defaultHashLifeNodes = 1 << 21
+
+// hashUniverse holds the canonical nodes of a HashLife quadtree along with the memoised results of every step.
+// Once it holds more than maxNodes nodes it can be collected, keeping only the nodes of the world.
+type hashUniverse struct {
+	rule        Rule
+	nodes       map[quadrants]*hashNode
+	steps       map[stepKey]*hashNode
+	dead, alive *hashNode
+	empty       []*hashNode
+	maxNodes    int
+}
+
+func newHashUniverse(rule Rule, maxNodes int) *hashUniverse {
+	dead := &hashNode{}
+	if maxNodes == 0 {
+		maxNodes = defaultHashLifeNodes
+	}
+	return &hashUniverse{
+		rule:     rule,
+		nodes:    make(map[quadrants]*hashNode),
+		steps:    make(map[stepKey]*hashNode),
+		dead:     dead,
+		alive:    &hashNode{population: 1},
+		empty:    []*hashNode{dead},
+		maxNodes: maxNodes,
+	}
+}
+
+// collect forgets every memoised step and every node that is not part of root, once there are more than maxNodes,
+// as Golly's HashLife collects its garbage. The nodes of root stay canonical, so root can be moved on as before.
+// It must not be called during a step, as the nodes the step is holding would no longer be canonical.
+func (u *hashUniverse) collect(root *hashNode) {
+	if len(u.nodes) <= u.maxNodes {
+		return
+	}
+	u.nodes = make(map[quadrants]*hashNode)
+	u.steps = make(map[stepKey]*hashNode)
+	u.empty = []*hashNode{u.dead}
+	u.keep(root)
+}
+
+// keep adds a node and all of its children back into the canonical nodes, forgetting their memoised results.
+func (u *hashUniverse) keep(n *hashNode) {
+	if n.level == 0 {
+		return
+	}
+	q := quadrants{n.nw, n.ne, n.sw, n.se}
+	if _, ok := u.nodes[q]; ok {
+		return
+	}
+	u.keep(n.nw)
+	u.keep(n.ne)
+	u.keep(n.sw)
+	u.keep(n.se)
+	n.next = nil
+	u.nodes[q] = n
+}
+
+// join returns the canonical node with the given children, which must all be of the same level.
+func (u *hashUniverse) join(nw, ne, sw, se *hashNode) *hashNode {
+	q := quadrants{nw, ne, sw, se}
+	if n, ok := u.nodes[q]; ok {
+		return n
+	}
+	population := int64(0)
+	for _, child := range []*hashNode{nw, ne, sw, se} {
+		if population > math.MaxInt64-child.population {
+			population = math.MaxInt64
+		} else {
+			population += child.population
+		}
+	}
+	n := &hashNode{nw: nw, ne: ne, sw: sw, se: se, level: nw.level + 1, population: population}
+	u.nodes[q] = n
+	return n
+}
+
+// emptyNode returns the node of the given level with no alive cells.
+func (u *hashUniverse) emptyNode(level uint) *hashNode {
+	for uint(len(u.empty)) <= level {
+		e := u.empty[len(u.empty)-1]
+		u.empty = append(u.empty, u.join(e, e, e, e))
+	}
+	return u.empty[level]
+}
+
+// centre returns the square of half the size in the middle of the node.
+func (u *hashUniverse) centre(n *hashNode) *hashNode {
+	return u.join(n.nw.se, n.ne.sw, n.sw.ne, n.se.nw)
+}
+
+// build makes the node of the given level whose top left cell is (y, x) of the world.
+func (u *hashUniverse) build(level uint, y, x int, data func(y, x int) uint8) *hashNode {
+	if level == 0 {
+		if data(y, x) == 255 {
+			return u.alive
+		}
+		return u.dead
+	}
+	half := 1 << (level - 1)
+	return u.join(
+		u.build(level-1, y, x, data),
+		u.build(level-1, y, x+half, data),
+		u.build(level-1, y+half, x, data),
+		u.build(level-1, y+half, x+half, data))
+}
+
+// cell returns whether cell (y, x) of the node is alive.
+func (u *hashUniverse) cell(n *hashNode, y, x int) bool {
+	for n.level > 0 {
+		half := 1 << (n.level - 1)
+		switch {
+		case y < half && x < half:
+			n = n.nw
+		case y < half:
+			n, x = n.ne, x-half
+		case x < half:
+			n, y = n.sw, y-half
+		default:
+			n, y, x = n.se, y-half, x-half
+		}
+	}
+	return n == u.alive
+}
+
+// set returns the node with cell (y, x) made alive or dead, sharing every square of the node that did not change.
+func (u *hashUniverse) set(n *hashNode, y, x int, alive bool) *hashNode {
+	if n.level == 0 {
+		if alive {
+			return u.alive
+		}
+		return u.dead
+	}
+	half := 1 << (n.level - 1)
+	nw, ne, sw, se := n.nw, n.ne, n.sw, n.se
+	switch {
+	case y < half && x < half:
+		nw = u.set(nw, y, x, alive)
+	case y < half:
+		ne = u.set(ne, y, x-half, alive)
+	case x < half:
+		sw = u.set(sw, y-half, x, alive)
+	default:
+		se = u.set(se, y-half, x-half, alive)
+	}
+	return u.join(nw, ne, sw, se)
+}
+
+// step returns the centre of the node 2^turns turns later, where turns is at most level-2.
+// Nine overlapping squares of half the size are moved on, or just cut down to their centres for short steps,
+// then combined into four squares that are moved on again, so that the whole step is made from memoised halves.
+func (u *hashUniverse) step(n *hashNode, turns uint) *hashNode {
+	//Empty space stays empty unless cells can be born with no neighbours
+	if n.population == 0 && !u.rule.Birth[0] {
+		return u.emptyNode(n.level - 1)
+	}
+	longest := turns == n.level-2
+	if longest && n.next != nil {
+		return n.next
+	}
+	key := stepKey{n, turns}
+	if !longest {
+		if result, ok := u.steps[key]; ok {
+			return result
+		}
+	}
+
+	var result *hashNode
+	if n.level == 2 {
+		result = u.base(n)
+	} else {
+		squares := [9]*hashNode{
+			n.nw, u.join(n.nw.ne, n.ne.nw, n.nw.se, n.ne.sw), n.ne,
+			u.join(n.nw.sw, n.nw.se, n.sw.nw, n.sw.ne), u.centre(n), u.join(n.ne.sw, n.ne.se, n.se.nw, n.se.ne),
+			n.sw, u.join(n.sw.ne, n.se.nw, n.sw.se, n.se.sw), n.se,
+		}
+		remaining := turns
+		var r [9]*hashNode
+		for i, square := range squares {
+			if longest {
+				r[i] = u.step(square, turns-1)
+			} else {
+				r[i] = u.centre(square)
+			}
+		}
+		if longest {
+			remaining = turns - 1
+		}
+		result = u.join(
+			u.step(u.join(r[0], r[1], r[3], r[4]), remaining),
+			u.step(u.join(r[1], r[2], r[4], r[5]), remaining),
+			u.step(u.join(r[3], r[4], r[6], r[7]), remaining),
+			u.step(u.join(r[4], r[5], r[7], r[8]), remaining))
+	}
+
+	if longest {
+		n.next = result
+	} else {
+		u.steps[key] = result
+	}
+	return result
+}
+
+// base moves the centre 2x2 cells of a 4x4 node on by a single turn.
+func (u *hashUniverse) base(n *hashNode) *hashNode {
+	var next [4]*hashNode
+	for i := range next {
+		y, x := 1+i/2, 1+i%2
+		aliveNeighbours := 0
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if (dy != 0 || dx != 0) && u.cell(n, y+dy, x+dx) {
+					aliveNeighbours++
+				}
+			}
+		}
+		if u.cell(n, y, x) && u.rule.Survival[aliveNeighbours] || !u.cell(n, y, x) && u.rule.Birth[aliveNeighbours] {
+			next[i] = u.alive
+		} else {
+			next[i] = u.dead
+		}
+	}
+	return u.join(next[0], next[1], next[2], next[3])
+}
+
+// advance moves a world on a torus, held in a node of the same size, on by 2^turns turns.
+// The world is tiled into a node large enough to step by 2^turns, and as the tiling repeats every
+// world width the result is the world itself, shifted by half its width when the step is short.
+func (u *hashUniverse) advance(world *hashNode, turns uint) *hashNode {
+	tiling := world
+	for tiling.level < world.level+1 || tiling.level < turns+2 {
+		tiling = u.join(tiling, tiling, tiling, tiling)
+	}
+	result := u.step(tiling, turns)
+	if tiling.level == world.level+1 {
+		//The result starts half a world in from the tiling, so its quadrants are swapped around
+		return u.join(result.se, result.sw, result.ne, result.nw)
+	}
+	for result.level > world.level {
+		result = result.nw
+	}
+	return result
+}
+
+// changes calls changed for every cell that differs between two nodes of the same level,
+// skipping every square the nodes share.
+func (u *hashUniverse) changes(a, b *hashNode, y, x int, changed func(y, x int)) {
+	if a == b {
+		return
+	}
+	if a.level == 0 {
+		changed(y, x)
+		return
+	}
+	half := 1 << (a.level - 1)
+	u.changes(a.nw, b.nw, y, x, changed)
+	u.changes(a.ne, b.ne, y, x+half, changed)
+	u.changes(a.sw, b.sw, y+half, x, changed)
+	u.changes(a.se, b.se, y+half, x+half, changed)
+}
+
+// hashLifeEngine runs a world on a torus with HashLife, jumping as many turns at a time as it can.
+type hashLifeEngine struct {
+	universe *hashUniverse
+	world    *hashNode
+	last     turnChanges // the cells alive after the last move that were not before, and the reverse
+	report   bool        // whether the cells that flip are sent as events
+}
+
+// hashLifeLevel returns the level of the node holding the world, checking that the world can run on HashLife:
+// a square torus with sides a power of two of at least 8 cells, under a two-state rule of the 8 surrounding cells.
+func hashLifeLevel(p Params, rule Rule) (uint, error) {
+	if !rule.canPack() {
+		return 0, fmt.Errorf("rule %v cannot run on HashLife: only two-state rules counting the 8 surrounding cells can", rule)
+	}
+	if p.Topology != Torus {
+		return 0, fmt.Errorf("HashLife only runs on a torus, not a %v", p.Topology)
+	}
+	level := uint(3)
+	for 1<<level < p.ImageWidth {
+		level++
+	}
+	if p.ImageWidth != p.ImageHeight || p.ImageWidth != 1<<level {
+		return 0, fmt.Errorf("HashLife needs a square world with sides a power of two of at least 8, not %dx%d", p.ImageWidth, p.ImageHeight)
+	}
+	return level, nil
+}
+
+// newHashLifeEngine returns an engine holding an empty world, which is filled in by moveTo.
+func newHashLifeEngine(p Params, rule Rule) *hashLifeEngine {
+	level, _ := hashLifeLevel(p, rule)
+	u := newHashUniverse(rule, p.HashLifeNodes)
+	return &hashLifeEngine{universe: u, world: u.emptyNode(level), report: !p.NoFlips}
+}
+
+// jump moves the world on by the largest power of two turns that does not pass the given number of remaining turns,
+// reporting every cell that flipped, then collects the universe if it has grown too large.
+// It returns the number of turns completed.
+func (e *hashLifeEngine) jump(c distributorChannels, turn, remaining int) int {
+	turns := uint(0)
+	for turns < 62 && 2<<turns <= remaining {
+		turns++
+	}
+	e.moveTo(c, turn, e.universe.advance(e.world, turns))
+	e.universe.collect(e.world)
+	return 1 << turns
+}
+
+// moveTo replaces the world with the next one, reporting every cell that differs between them in one CellsFlipped.
+func (e *hashLifeEngine) moveTo(c distributorChannels, turn int, next *hashNode) {
+	e.last = turnChanges{}
+	var flipped []util.Cell
+	e.universe.changes(e.world, next, 0, 0, func(y, x int) {
+		if e.universe.cell(next, y, x) {
+			e.last.births++
+		} else {
+			e.last.deaths++
+		}
+		if e.report {
+			flipped = append(flipped, util.Cell{X: x, Y: y})
+		}
+	})
+	e.world = next
+	reportCellsFlipped(c, turn, flipped)
+}
+
+// immutable wraps the current world in a getter closure, in the same way as makeImmutableMatrix.
+func (e *hashLifeEngine) immutable() func(y, x int) uint8 {
+	u, world := e.universe, e.world
+	return func(y, x int) uint8 {
+		if u.cell(world, y, x) {
+			return 255
+		}
+		return 0
+	}
+}
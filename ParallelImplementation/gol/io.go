@@ -1,27 +1,45 @@
 package gol
 
 import (
+	"bufio"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"strconv"
-	"strings"
-	"uk.ac.bris.cs/gameoflife/util"
+
+	"uk.ac.bris.cs/gameoflife/census"
+	"uk.ac.bris.cs/gameoflife/pattern"
 )
 
 type ioChannels struct {
 	command <-chan ioCommand
-	idle    chan<- bool
+	idle    chan<- error
+	events  chan<- Event
+	loaded  chan<- error
 
-	filename <-chan string
-	output   <-chan uint8
-	input    chan<- uint8
+	filename   <-chan string
+	turn       <-chan int
+	output     <-chan uint8
+	input      chan<- uint8
+	macrocell  chan hashLifeWorld
+	census     <-chan []census.Tally
+	statistic  <-chan TurnStatistics
+	patterns   chan pattern.Pattern
+	checkpoint chan checkpoint
 }
 
 // ioState is the internal ioState of the io goroutine.
 type ioState struct {
 	params   Params
 	channels ioChannels
+
+	// The population CSV file, kept open between turns until the distributor checks the io goroutine is idle.
+	statisticsFile   *os.File
+	statisticsWriter *bufio.Writer
+	statisticsName   string
+	statisticsTurn   int
+	statisticsFailed bool
+
+	// The first failure to read or write a file, given to the distributor when it checks the io goroutine is idle.
+	failure error
 }
 
 // ioCommand allows requesting behaviour from the io (pgm) goroutine.
@@ -32,31 +50,36 @@ type ioCommand uint8
 //		ioOutput 	= 0
 //		ioInput 	= 1
 //		ioCheckIdle = 2
+//		ioOutputMacrocell = 3
+//		ioInputMacrocell = 4
+//		ioOutputCensus = 5
+//		ioOutputStatistics = 6
+//		ioInputPattern = 7
+//		ioOutputPattern = 8
+//		ioOutputCheckpoint = 9
+//		ioInputCheckpoint = 10
 const (
 	ioOutput ioCommand = iota
 	ioInput
 	ioCheckIdle
+	ioOutputMacrocell
+	ioInputMacrocell
+	ioOutputCensus
+	ioOutputStatistics
+	ioInputPattern
+	ioOutputPattern
+	ioOutputCheckpoint
+	ioInputCheckpoint
 )
 
-// writePgmImage receives an array of bytes and writes it to a pgm file.
+// writePgmImage receives an array of bytes and writes it to a pgm file, noting the turn and rule in comments.
+// Decaying cells of Generations rules are received, and written, as grey levels between 0 and 255.
 func (io *ioState) writePgmImage() {
 	_ = os.Mkdir("out", os.ModePerm)
 
-	// Request a filename from the distributor.
+	// Request a filename and the turn from the distributor.
 	filename := <-io.channels.filename
-
-	file, ioError := os.Create("out/" + filename + ".pgm")
-	util.Check(ioError)
-	defer file.Close()
-
-	_, _ = file.WriteString("P5\n")
-	//_, _ = file.WriteString("# PGM file writer by pnmmodules (https://github.com/owainkenwayucl/pnmmodules).\n")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageWidth))
-	_, _ = file.WriteString(" ")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageHeight))
-	_, _ = file.WriteString("\n")
-	_, _ = file.WriteString(strconv.Itoa(255))
-	_, _ = file.WriteString("\n")
+	turn := <-io.channels.turn
 
 	world := make([][]byte, io.params.ImageHeight)
 	for i := range world {
@@ -73,56 +96,387 @@ func (io *ioState) writePgmImage() {
 		}
 	}
 
-	for y := 0; y < io.params.ImageHeight; y++ {
-		for x := 0; x < io.params.ImageWidth; x++ {
-			_, ioError = file.Write([]byte{world[y][x]})
-			util.Check(ioError)
-		}
+	rule, ioError := ParseRule(io.params.Rule)
+	if ioError == nil {
+		ioError = writeFile("out/"+filename+".pgm", func(file *os.File) error {
+			return writePgm(file, rule, turn, world)
+		})
+	}
+	if ioError != nil {
+		io.fail(turn, "write image", filename, ioError)
+		return
 	}
-
-	ioError = file.Sync()
-	util.Check(ioError)
 
 	fmt.Println("File", filename, "output done!")
 }
 
-// readPgmImage opens a pgm file and sends its data as an array of bytes.
+// readPgmImage opens the PBM or PGM file at the path given by the distributor and sends the pixels of the image
+// chosen by Params.ImageIndex as an array of bytes, thresholded or scaled to grey levels between 0 and 255.
+// PNG, JPEG and GIF images are instead scaled to the size of the board and binarised to 0 and 255.
+// Whether the image could be read is sent first, and the pixels only if it could.
 func (io *ioState) readPgmImage() {
 
-	// Request a filename from the distributor.
+	// Request a path from the distributor.
+	path := <-io.channels.filename
+
+	pixels, ioError := readImagePixels(path, io.params)
+	if ioError != nil {
+		io.channels.loaded <- io.fail(0, "read image", path, ioError)
+		return
+	}
+	io.channels.loaded <- nil
+
+	for _, b := range pixels {
+		io.channels.input <- b
+	}
+
+	fmt.Println("File", path, "input done!")
+}
+
+// readImagePixels reads the pixels of the PBM, PGM, PNG, JPEG or GIF image at path, checking it is the size of the board.
+func readImagePixels(path string, p Params) ([]uint8, error) {
+	if _, isPhoto, _ := photoConfig(path); isPhoto {
+		return readPhoto(path, p)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	image, err := readNetpbm(file, p.ImageIndex, false)
+	if err != nil {
+		return nil, err
+	}
+	if image.width != p.ImageWidth || image.height != p.ImageHeight {
+		return nil, fmt.Errorf("incorrect size %dx%d, not %dx%d", image.width, image.height, p.ImageWidth, p.ImageHeight)
+	}
+	return image.levels(p.AliveThreshold), nil
+}
+
+// ImageSize returns the width and height of the image at the given index of the PBM or PGM file at path,
+// or the size of the PNG, JPEG or GIF image, or RLE, plaintext or Life 1.06 pattern, at path.
+func ImageSize(path string, index int) (width, height int, err error) {
+	if loaded, isPattern, err := readPattern(path); isPattern {
+		return loaded.Width, loaded.Height, err
+	}
+	if config, isPhoto, err := photoConfig(path); isPhoto || err != nil {
+		return config.Width, config.Height, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	image, err := readNetpbm(file, index, true)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%v: %v", path, err)
+	}
+	return image.width, image.height, nil
+}
+
+// writeMacrocellFile receives a HashLife world and writes it to a Macrocell (.mc) file.
+func (io *ioState) writeMacrocellFile() {
+	_ = os.Mkdir("out", os.ModePerm)
+
+	// Request a filename and the world from the distributor.
 	filename := <-io.channels.filename
+	world := <-io.channels.macrocell
 
-	data, ioError := ioutil.ReadFile("images/" + filename + ".pgm")
-	util.Check(ioError)
+	rule, ioError := ParseRule(io.params.Rule)
+	if ioError == nil {
+		ioError = writeFile("out/"+filename+".mc", func(file *os.File) error {
+			return writeMacrocell(file, rule, world)
+		})
+	}
+	if ioError != nil {
+		io.fail(world.turn, "write Macrocell", filename, ioError)
+		return
+	}
+
+	fmt.Println("File", filename, "Macrocell output done!")
+}
 
-	fields := strings.Fields(string(data))
+// readMacrocellFile opens the Macrocell file at the path given by the distributor and sends back its world,
+// read into the universe the distributor sent. Whether the file could be read is sent first.
+func (io *ioState) readMacrocellFile() {
 
-	if fields[0] != "P5" {
-		panic("Not a pgm file")
+	// Request a path and an empty world from the distributor.
+	path := <-io.channels.filename
+	world := <-io.channels.macrocell
+
+	file, ioError := os.Open(path)
+	if ioError == nil {
+		world.world, ioError = readMacrocell(file, world.universe, world.world.level)
+		file.Close()
+	}
+	if ioError != nil {
+		io.channels.loaded <- io.fail(0, "read Macrocell", path, ioError)
+		return
 	}
+	io.channels.loaded <- nil
+	io.channels.macrocell <- world
 
-	width, _ := strconv.Atoi(fields[1])
-	if width != io.params.ImageWidth {
-		panic("Incorrect width")
+	fmt.Println("File", path, "Macrocell input done!")
+}
+
+// readPatternFile opens the pattern file at the path given by the distributor and sends back its cells.
+// Whether the file could be read is sent first.
+func (io *ioState) readPatternFile() {
+
+	// Request a path from the distributor.
+	path := <-io.channels.filename
+
+	loaded, _, ioError := readPattern(path)
+	if ioError != nil {
+		io.channels.loaded <- io.fail(0, "read pattern", path, ioError)
+		return
 	}
+	io.channels.loaded <- nil
+	io.channels.patterns <- loaded
+
+	fmt.Println("File", path, "pattern input done!")
+}
+
+// writePatternFile receives the cells of the world and writes them to a pattern file in the snapshot format.
+func (io *ioState) writePatternFile() {
+	_ = os.Mkdir("out", os.ModePerm)
 
-	height, _ := strconv.Atoi(fields[2])
-	if height != io.params.ImageHeight {
-		panic("Incorrect height")
+	// Request a filename, the turn and the cells from the distributor.
+	filename := <-io.channels.filename
+	turn := <-io.channels.turn
+	snapshot := <-io.channels.patterns
+
+	format, ioError := pattern.ParseFormat(io.params.SnapshotFormat)
+	if ioError == nil {
+		var rule Rule
+		rule, ioError = ParseRule(io.params.Rule)
+		snapshot.Rule = rule.String()
+	}
+	if ioError == nil {
+		ioError = writeFile("out/"+filename+format.Extension(), func(file *os.File) error {
+			return pattern.Write(file, format, snapshot)
+		})
+	}
+	if ioError != nil {
+		io.fail(turn, "write pattern", filename, ioError)
+		return
 	}
 
-	maxval, _ := strconv.Atoi(fields[3])
-	if maxval != 255 {
-		panic("Incorrect maxval/bit depth")
+	fmt.Println("File", filename, "pattern output done!")
+}
+
+// writeCheckpointFile receives a checkpoint of the world and writes it to out/, replacing the last checkpoint of the
+// run only once the new one is complete.
+func (io *ioState) writeCheckpointFile() {
+	_ = os.Mkdir("out", os.ModePerm)
+
+	// Request a filename and the checkpoint from the distributor.
+	filename := <-io.channels.filename
+	saved := <-io.channels.checkpoint
+
+	// The rows of the population CSV up to the checkpoint must reach the disk before the checkpoint does,
+	// or resuming after a crash would leave a gap in the CSV.
+	if !io.syncStatistics() {
+		return
+	}
+	rule, ioError := ParseRule(io.params.Rule)
+	if ioError == nil {
+		ioError = replaceFile("out/"+filename+".checkpoint", func(file *os.File) error {
+			return writeCheckpoint(file, saved, rule)
+		})
 	}
+	if ioError != nil {
+		io.fail(saved.Turn, "write checkpoint", filename, ioError)
+		return
+	}
+
+	fmt.Println("File", filename, "checkpoint output done!")
+}
 
-	image := []byte(fields[4])
+// readCheckpointFile opens the checkpoint at the path given by the distributor and sends it back, checking that its
+// world is the size of the board. Whether the checkpoint could be read is sent first.
+func (io *ioState) readCheckpointFile() {
 
-	for _, b := range image {
-		io.channels.input <- b
+	// Request a path from the distributor.
+	path := <-io.channels.filename
+
+	file, ioError := os.Open(path)
+	var saved checkpoint
+	if ioError == nil {
+		saved, ioError = readCheckpoint(file)
+		file.Close()
+	}
+	if ioError == nil && (saved.Params.ImageWidth != io.params.ImageWidth || saved.Params.ImageHeight != io.params.ImageHeight) {
+		ioError = fmt.Errorf("incorrect size %dx%d, not %dx%d", saved.Params.ImageWidth, saved.Params.ImageHeight, io.params.ImageWidth, io.params.ImageHeight)
 	}
+	if ioError != nil {
+		io.channels.loaded <- io.fail(0, "read checkpoint", path, ioError)
+		return
+	}
+	io.channels.loaded <- nil
+	io.channels.checkpoint <- saved
 
-	fmt.Println("File", filename, "input done!")
+	fmt.Println("File", path, "checkpoint input done!")
+}
+
+// writeCensusFile receives the objects found in the world and writes them to a CSV file beside the PGM image.
+func (io *ioState) writeCensusFile() {
+	_ = os.Mkdir("out", os.ModePerm)
+
+	// Request a filename, the turn and the census from the distributor.
+	filename := <-io.channels.filename
+	turn := <-io.channels.turn
+	objects := <-io.channels.census
+
+	ioError := writeFile("out/"+filename+"-census.csv", func(file *os.File) error {
+		return census.WriteCSV(file, objects)
+	})
+	if ioError != nil {
+		io.fail(turn, "write census", filename, ioError)
+		return
+	}
+
+	fmt.Println("File", filename, "census output done!")
+}
+
+// writeStatisticsRow receives the statistics of a turn and adds its population to the CSV file, creating the file
+// with a header on the first turn. A resumed run carries on the file of the run it resumes, from its first turn.
+// Once the file has failed to be created or written, every later row is dropped.
+func (io *ioState) writeStatisticsRow() {
+	// Request a filename and the statistics from the distributor.
+	filename := <-io.channels.filename
+	statistics := <-io.channels.statistic
+
+	if io.statisticsFailed {
+		return
+	}
+	if io.statisticsFile == nil {
+		_ = os.Mkdir("out", os.ModePerm)
+		path := "out/" + filename + "-alive.csv"
+		var file *os.File
+		var ioError error
+		empty := true
+		if io.params.Resume != "" {
+			file, empty, ioError = openStatistics(path, statistics.CompletedTurns)
+		} else {
+			file, ioError = os.Create(path)
+		}
+		if ioError != nil {
+			io.statisticsFailed = true
+			io.fail(statistics.CompletedTurns, "write statistics", filename, ioError)
+			return
+		}
+		io.statisticsFile = file
+		io.statisticsWriter = bufio.NewWriter(file)
+		io.statisticsName = filename
+		if empty {
+			_, _ = io.statisticsWriter.WriteString("completed_turns,alive_cells\n")
+		}
+	}
+	io.statisticsTurn = statistics.CompletedTurns
+	_, _ = fmt.Fprintf(io.statisticsWriter, "%d,%d\n", statistics.CompletedTurns, statistics.Population)
+}
+
+// openStatistics opens the population CSV file at path to add the rows of a resumed run to, from the given turn on,
+// creating it if there is none. The header and the rows of earlier turns are kept, and any rows of later turns,
+// written by the run after the checkpoint it is resumed from, are dropped. It reports whether the file is empty.
+func openStatistics(path string, from int) (*os.File, bool, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, false, err
+	}
+	kept := int64(0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var turn, population int
+		if _, err := fmt.Sscanf(scanner.Text(), "%d,%d", &turn, &population); err == nil && turn >= from {
+			break
+		}
+		kept += int64(len(scanner.Bytes())) + 1
+	}
+	err = scanner.Err()
+	if err == nil {
+		err = file.Truncate(kept)
+	}
+	if err != nil {
+		file.Close()
+		return nil, false, err
+	}
+	return file, kept == 0, nil
+}
+
+// syncStatistics makes sure the rows written to the population CSV file so far, if there is one, are on the disk.
+// It reports whether they are.
+func (io *ioState) syncStatistics() bool {
+	if io.statisticsFile == nil {
+		return true
+	}
+	ioError := io.statisticsWriter.Flush()
+	if ioError == nil {
+		ioError = io.statisticsFile.Sync()
+	}
+	if ioError != nil {
+		io.fail(io.statisticsTurn, "write statistics", io.statisticsName, ioError)
+		return false
+	}
+	return true
+}
+
+// closeStatistics finishes writing the population CSV file, if there is one.
+func (io *ioState) closeStatistics() {
+	if io.statisticsFile == nil {
+		return
+	}
+	ioError := io.statisticsWriter.Flush()
+	if closeError := io.statisticsFile.Close(); ioError == nil {
+		ioError = closeError
+	}
+	if ioError != nil {
+		io.fail(io.statisticsTurn, "write statistics", io.statisticsName, ioError)
+	}
+	io.statisticsFile, io.statisticsWriter = nil, nil
+}
+
+// writeFile creates the file at path, writes it with write and makes sure it reaches the disk.
+func writeFile(path string, write func(file *os.File) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// replaceFile writes the file at path through a temporary file beside it, which is only renamed over path once it
+// has been written in full, so that path holds either the old file or the new one whatever happens while writing.
+func replaceFile(path string, write func(file *os.File) error) error {
+	temporary := path + ".tmp"
+	if err := writeFile(temporary, write); err != nil {
+		os.Remove(temporary)
+		return err
+	}
+	return os.Rename(temporary, path)
+}
+
+// fail reports a failure to read or write a file as an IOError event, instead of taking the whole process down,
+// and remembers the first failure for the distributor. The event is returned.
+func (io *ioState) fail(turn int, operation, filename string, err error) IOError {
+	failure := IOError{CompletedTurns: turn, Operation: operation, Filename: filename, Err: err}
+	fmt.Println("Error:", failure)
+	io.channels.events <- failure
+	if io.failure == nil {
+		io.failure = failure
+	}
+	return failure
 }
 
 // startIo should be the entrypoint of the io goroutine.
@@ -134,14 +488,35 @@ func startIo(p Params, c ioChannels) {
 	for {
 		select {
 		// Block and wait for requests from the distributor
-		case command := <-io.channels.command:
+		case command, ok := <-io.channels.command:
+			if !ok {
+				// The distributor has finished, so there will be no more requests
+				return
+			}
 			switch command {
 			case ioInput:
 				io.readPgmImage()
 			case ioOutput:
 				io.writePgmImage()
 			case ioCheckIdle:
-				io.channels.idle <- true
+				io.closeStatistics()
+				io.channels.idle <- io.failure
+			case ioOutputMacrocell:
+				io.writeMacrocellFile()
+			case ioInputMacrocell:
+				io.readMacrocellFile()
+			case ioOutputCensus:
+				io.writeCensusFile()
+			case ioOutputStatistics:
+				io.writeStatisticsRow()
+			case ioInputPattern:
+				io.readPatternFile()
+			case ioOutputPattern:
+				io.writePatternFile()
+			case ioOutputCheckpoint:
+				io.writeCheckpointFile()
+			case ioInputCheckpoint:
+				io.readCheckpointFile()
 			}
 		}
 	}
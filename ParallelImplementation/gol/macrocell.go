@@ -0,0 +1,155 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// macrocellLeafLevel is the level of the leaves of a Macrocell file, which are written out as 8x8 squares of cells.
+const macrocellLeafLevel = 3
+
+// hashLifeWorld is a HashLife world passed to and from the io goroutine to be written to, or read from, a Macrocell file.
+type hashLifeWorld struct {
+	universe *hashUniverse
+	world    *hashNode
+	turn     int
+}
+
+// writeMacrocell writes a world in Golly's Macrocell format: a line for each distinct square of the quadtree,
+// children before their parents, where 8x8 leaves are drawn with '.', '*' and '$' and larger squares list
+// their level and the line numbers of their four children, with 0 for an empty child. The last line is the world.
+func writeMacrocell(w io.Writer, rule Rule, h hashLifeWorld) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "[M2] (uk.ac.bris.cs/gameoflife)")
+	fmt.Fprintf(out, "#R %v\n", rule)
+	if h.turn > 0 {
+		fmt.Fprintf(out, "#G %d\n", h.turn)
+	}
+
+	lines := make(map[*hashNode]int)
+	var write func(n *hashNode, root bool) int
+	write = func(n *hashNode, root bool) int {
+		if n.population == 0 && !root {
+			return 0
+		}
+		if line, ok := lines[n]; ok {
+			return line
+		}
+		if n.level == macrocellLeafLevel {
+			var rows []string
+			for y := 0; y < 8; y++ {
+				var row strings.Builder
+				for x := 0; x < 8; x++ {
+					if h.universe.cell(n, y, x) {
+						row.WriteByte('*')
+					} else {
+						row.WriteByte('.')
+					}
+				}
+				rows = append(rows, strings.TrimRight(row.String(), ".")+"$")
+			}
+			//Trailing empty rows are left out, but an empty leaf still needs a line of its own
+			leaf := strings.TrimRight(strings.Join(rows, ""), "$")
+			fmt.Fprintln(out, leaf+"$")
+		} else {
+			nw, ne := write(n.nw, false), write(n.ne, false)
+			sw, se := write(n.sw, false), write(n.se, false)
+			fmt.Fprintf(out, "%d %d %d %d %d\n", n.level, nw, ne, sw, se)
+		}
+		lines[n] = len(lines) + 1
+		return lines[n]
+	}
+	write(h.world, true)
+	return out.Flush()
+}
+
+// readMacrocell reads a world in Golly's Macrocell format into the universe, placing the top left corner of the
+// pattern at the top left corner of a world of the given level. Patterns smaller than the world are padded with
+// dead cells, and larger patterns must have no alive cells outside it. The rule and turn in the file are ignored.
+func readMacrocell(r io.Reader, u *hashUniverse, level uint) (*hashNode, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024), 1024*1024)
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "[M2]") {
+		return nil, fmt.Errorf("not a Macrocell file: the first line must start with [M2]")
+	}
+
+	nodes := []*hashNode{nil}
+	for lineNumber := 2; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		var n *hashNode
+		if strings.ContainsAny(line[:1], ".*$") {
+			var cells [8][8]bool
+			y, x := 0, 0
+			for _, char := range line {
+				switch {
+				case char == '$':
+					y, x = y+1, 0
+				case y >= 8 || x >= 8:
+					return nil, fmt.Errorf("line %d: leaf is larger than 8x8", lineNumber)
+				case char == '*':
+					cells[y][x] = true
+					x++
+				case char == '.':
+					x++
+				default:
+					return nil, fmt.Errorf("line %d: unexpected %q in leaf", lineNumber, char)
+				}
+			}
+			n = u.build(macrocellLeafLevel, 0, 0, func(y, x int) uint8 {
+				if cells[y][x] {
+					return 255
+				}
+				return 0
+			})
+		} else {
+			var nodeLevel uint
+			var children [4]int
+			if _, err := fmt.Sscan(line, &nodeLevel, &children[0], &children[1], &children[2], &children[3]); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			if nodeLevel <= macrocellLeafLevel || nodeLevel > 62 {
+				return nil, fmt.Errorf("line %d: level %d is not between %d and 62", lineNumber, nodeLevel, macrocellLeafLevel+1)
+			}
+			var quadrants [4]*hashNode
+			for i, child := range children {
+				if child < 0 || child >= len(nodes) {
+					return nil, fmt.Errorf("line %d: child %d has not been defined", lineNumber, child)
+				}
+				quadrants[i] = nodes[child]
+				if child == 0 {
+					quadrants[i] = u.emptyNode(nodeLevel - 1)
+				}
+				if quadrants[i].level != nodeLevel-1 {
+					return nil, fmt.Errorf("line %d: child %d is not of level %d", lineNumber, child, nodeLevel-1)
+				}
+			}
+			n = u.join(quadrants[0], quadrants[1], quadrants[2], quadrants[3])
+		}
+		nodes = append(nodes, n)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(nodes) == 1 {
+		return nil, fmt.Errorf("Macrocell file holds no squares")
+	}
+
+	root := nodes[len(nodes)-1]
+	for root.level < level {
+		empty := u.emptyNode(root.level)
+		root = u.join(root, empty, empty, empty)
+	}
+	for root.level > level {
+		if root.ne.population != 0 || root.sw.population != 0 || root.se.population != 0 {
+			return nil, fmt.Errorf("pattern of %dx%d cells does not fit in a world of %dx%d", 1<<root.level, 1<<root.level, 1<<level, 1<<level)
+		}
+		root = root.nw
+	}
+	return root, nil
+}
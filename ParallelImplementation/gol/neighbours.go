@@ -0,0 +1,76 @@
+package gol
+
+// neighbourCounter counts the alive neighbours of the cells in a region of a buffer that has a halo of Radius cells
+// around the region, reusing the same tables for every region it counts.
+// Moore neighbourhoods are counted with a summed-area table and von Neumann neighbourhoods with a sliding window
+// along each row, so the cost per cell does not grow with the square of the radius.
+type neighbourCounter struct {
+	rule Rule
+	//prefix[y][x] holds the alive cells of rows up to y (exclusive) and columns up to x (exclusive) of the region
+	//and its halo, or for von Neumann neighbourhoods the alive cells of row y before column x
+	prefix [][]int32
+	counts [][]int
+}
+
+// newNeighbourCounter returns a counter for regions of up to maxHeight by maxWidth cells.
+func newNeighbourCounter(rule Rule, maxHeight, maxWidth int) *neighbourCounter {
+	n := &neighbourCounter{rule: rule}
+	n.prefix = make([][]int32, maxHeight+2*rule.Radius+1)
+	for i := range n.prefix {
+		n.prefix[i] = make([]int32, maxWidth+2*rule.Radius+1)
+	}
+	n.counts = make([][]int, maxHeight)
+	for i := range n.counts {
+		n.counts[i] = make([]int, maxWidth)
+	}
+	return n
+}
+
+// count finds the number of alive neighbours of the cells in rows startY to endY and columns startX to endX of the
+// buffer, leaving the count for cell (y, x) in counts[y-startY][x-startX].
+func (n *neighbourCounter) count(buffer [][]uint8, startY, endY, startX, endX int) {
+	r := n.rule.Radius
+	height, width := endY-startY, endX-startX
+
+	for i := 0; i < height+2*r; i++ {
+		row := buffer[startY-r+i][startX-r : endX+r]
+		for j, cell := range row {
+			alive := int32(0)
+			if cell == 255 {
+				alive = 1
+			}
+			if n.rule.Neighbourhood == VonNeumann {
+				n.prefix[i][j+1] = n.prefix[i][j] + alive
+			} else {
+				n.prefix[i+1][j+1] = n.prefix[i+1][j] + n.prefix[i][j+1] - n.prefix[i][j] + alive
+			}
+		}
+	}
+
+	for i := 0; i < height; i++ {
+		for j := 0; j < width; j++ {
+			var count int32
+			if n.rule.Neighbourhood == VonNeumann {
+				for d := -r; d <= r; d++ {
+					reach := r - abs(d)
+					row := n.prefix[i+r+d]
+					count += row[j+r+reach+1] - row[j+r-reach]
+				}
+			} else {
+				count = n.prefix[i+2*r+1][j+2*r+1] - n.prefix[i][j+2*r+1] - n.prefix[i+2*r+1][j] + n.prefix[i][j]
+			}
+			//The cell itself is inside the window, but only counts as its own neighbour for M1 rules
+			if !n.rule.Middle && buffer[startY+i][startX+j] == 255 {
+				count--
+			}
+			n.counts[i][j] = int(count)
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,223 @@
+package gol
+
+import (
+	"math/bits"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// packedWorld stores a world 64 cells to a word: bit x%64 of rows[y][x/64] is set when cell (x, y) is alive.
+// Bits beyond the width of the world in the last word of each row are always clear.
+type packedWorld struct {
+	height, width int
+	rows          [][]uint64
+}
+
+func newPackedWorld(height, width int) *packedWorld {
+	rows := make([][]uint64, height)
+	for y := range rows {
+		rows[y] = make([]uint64, (width+63)/64)
+	}
+	return &packedWorld{height: height, width: width, rows: rows}
+}
+
+func (w *packedWorld) alive(y, x int) bool {
+	return w.rows[y][x>>6]>>uint(x&63)&1 != 0
+}
+
+func (w *packedWorld) set(y, x int) {
+	w.rows[y][x>>6] |= 1 << uint(x&63)
+}
+
+func (w *packedWorld) clear(y, x int) {
+	w.rows[y][x>>6] &^= 1 << uint(x&63)
+}
+
+// packedEngine computes the turns of a Life-like rule on a pair of packed worlds, swapping them after every turn.
+// Each word of the next turn is found from the 8 neighbouring words with bitwise adders, 64 cells at a time.
+type packedEngine struct {
+	p             Params
+	rule          Rule
+	current, next *packedWorld
+	done          chan turnChanges
+	last          turnChanges // the cells born and died on the last turn
+}
+
+// canPack reports whether the rule can run on a packed world: it must have two states
+// and count the 8 cells around each cell.
+func (rule Rule) canPack() bool {
+	return rule.States == 2 && rule.isLifeLike()
+}
+
+func newPackedEngine(p Params, rule Rule) *packedEngine {
+	return &packedEngine{
+		p:       p,
+		rule:    rule,
+		current: newPackedWorld(p.ImageHeight, p.ImageWidth),
+		next:    newPackedWorld(p.ImageHeight, p.ImageWidth),
+		done:    make(chan turnChanges),
+	}
+}
+
+// immutable wraps the current turn of the packed world in a getter closure, in the same way as makeImmutableMatrix.
+func (e *packedEngine) immutable() func(y, x int) uint8 {
+	world := e.current
+	return func(y, x int) uint8 {
+		if world.alive(y, x) {
+			return 255
+		}
+		return 0
+	}
+}
+
+// step computes the next turn, splitting the rows of the world between p.Threads workers.
+func (e *packedEngine) step(c distributorChannels, turn int) {
+	cuttingHeight := e.p.ImageHeight / e.p.Threads
+	for i := 0; i < e.p.Threads; i++ {
+		startHeight := i * cuttingHeight
+		endHeight := (i + 1) * cuttingHeight
+		if i == e.p.Threads-1 {
+			endHeight = e.p.ImageHeight
+		}
+		go func(startY, endY int) {
+			e.done <- e.nextRows(startY, endY, c, turn)
+		}(startHeight, endHeight)
+	}
+	e.last = turnChanges{}
+	for i := 0; i < e.p.Threads; i++ {
+		e.last.merge(<-e.done)
+	}
+	e.current, e.next = e.next, e.current
+}
+
+// packedRow holds a row of cells along with the same row shifted so that each bit holds
+// the cell to its left, and to its right.
+type packedRow struct {
+	row, left, right []uint64
+}
+
+// load fills r with row y of the world, which may lie beyond the top or bottom edge.
+// Cells beyond the edges are found through the topology of the world.
+func (e *packedEngine) load(r packedRow, y int) {
+	w := e.current
+	if y >= 0 && y < w.height {
+		copy(r.row, w.rows[y])
+	} else {
+		for k := range r.row {
+			r.row[k] = 0
+		}
+		for x := 0; x < w.width; x++ {
+			if cellY, cellX, ok := e.p.Topology.locate(y, x, w.height, w.width); ok && w.alive(cellY, cellX) {
+				r.row[x>>6] |= 1 << uint(x&63)
+			}
+		}
+	}
+
+	last := len(r.row) - 1
+	for k := range r.row {
+		r.left[k] = r.row[k] << 1
+		r.right[k] = r.row[k] >> 1
+		if k > 0 {
+			r.left[k] |= r.row[k-1] >> 63
+		}
+		if k < last {
+			r.right[k] |= r.row[k+1] << 63
+		}
+	}
+	r.left[0] |= e.edge(y, -1)
+	r.right[last] |= e.edge(y, w.width) << uint((w.width-1)&63)
+}
+
+// edge returns 1 if the cell at (y, x) beyond the left or right edge of the world is alive.
+func (e *packedEngine) edge(y, x int) uint64 {
+	if cellY, cellX, ok := e.p.Topology.locate(y, x, e.current.height, e.current.width); ok && e.current.alive(cellY, cellX) {
+		return 1
+	}
+	return 0
+}
+
+// nextRows computes rows startY to endY of the next turn, reporting the cells that flip in one CellsFlipped.
+// It returns how many cells were born and how many died.
+func (e *packedEngine) nextRows(startY, endY int, c distributorChannels, turn int) turnChanges {
+	changes := turnChanges{report: !e.p.NoFlips}
+	words := len(e.current.rows[0])
+	newRow := func() packedRow {
+		return packedRow{make([]uint64, words), make([]uint64, words), make([]uint64, words)}
+	}
+	up, middle, down := newRow(), newRow(), newRow()
+	if startY < endY {
+		e.load(up, startY-1)
+		e.load(middle, startY)
+	}
+
+	//Mask of the bits of the last word of a row that hold cells of the world
+	lastMask := ^uint64(0) >> uint(64*words-e.p.ImageWidth)
+
+	for y := startY; y < endY; y++ {
+		e.load(down, y+1)
+		for k := 0; k < words; k++ {
+			count0, count1, count2, count3 := addNeighbours(
+				up.left[k], up.row[k], up.right[k],
+				middle.left[k], middle.right[k],
+				down.left[k], down.row[k], down.right[k])
+			alive := middle.row[k]
+			born := countsMatching(e.rule.Birth, count0, count1, count2, count3)
+			survive := countsMatching(e.rule.Survival, count0, count1, count2, count3)
+			next := (alive & survive) | (^alive & born)
+			if k == words-1 {
+				next &= lastMask
+			}
+			e.next.rows[y][k] = next
+			changes.births += bits.OnesCount64(next &^ alive)
+			changes.deaths += bits.OnesCount64(alive &^ next)
+
+			//Gather every cell that changed, lowest bit first
+			if changes.report {
+				for changed := next ^ alive; changed != 0; changed &= changed - 1 {
+					x := k*64 + bits.TrailingZeros64(changed)
+					changes.flipped = append(changes.flipped, util.Cell{X: x, Y: y})
+				}
+			}
+		}
+		up, middle, down = middle, down, up
+	}
+	reportCellsFlipped(c, turn, changes.flipped)
+	return changes
+}
+
+// addNeighbours adds up 8 words of neighbour bits with full adders, giving the 4 bits of the neighbour count of every cell.
+func addNeighbours(a, b, c, d, e, f, g, h uint64) (count0, count1, count2, count3 uint64) {
+	ones1, twos1 := fullAdder(a, b, c)
+	ones2, twos2 := fullAdder(d, e, f)
+	ones3, twos3 := g^h, g&h
+	count0, twos4 := fullAdder(ones1, ones2, ones3)
+	twos5, fours1 := fullAdder(twos1, twos2, twos3)
+	count1, fours2 := twos5^twos4, twos5&twos4
+	count2, count3 = fours1^fours2, fours1&fours2
+	return
+}
+
+func fullAdder(a, b, c uint64) (sum, carry uint64) {
+	partial := a ^ b
+	return partial ^ c, (a & b) | (partial & c)
+}
+
+// countsMatching returns the bits of the cells whose neighbour count is one of the marked counts.
+func countsMatching(counts []bool, count0, count1, count2, count3 uint64) uint64 {
+	var matching uint64
+	for n, marked := range counts {
+		if !marked {
+			continue
+		}
+		match := ^uint64(0)
+		for i, bit := range [4]uint64{count0, count1, count2, count3} {
+			if n>>uint(i)&1 == 1 {
+				match &= bit
+			} else {
+				match &^= bit
+			}
+		}
+		matching |= match
+	}
+	return matching
+}
@@ -0,0 +1,431 @@
+package gol
+
+import (
+	"math"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// haloCell is a cell copied into the halo of a worker: from position (fromY, fromX) of one buffer to (toY, toX) of another.
+type haloCell struct {
+	fromY, fromX, toY, toX int
+}
+
+// haloTransfer is the set of cells one worker sends to another every turn, packed into a buffer in a fixed order.
+// For strips on a torus these are the rows along the edge of the strip.
+type haloTransfer struct {
+	cells   []haloCell
+	buffer  []uint8
+	channel chan []uint8
+}
+
+// poolWorker is a long-lived worker that owns rows startY to endY and columns startX to endX of the world.
+// It keeps its part of the world in two buffers with a halo of radius cells on every side: each turn reads
+// the current buffer and writes the next one, and the two are swapped at the end of the turn.
+type poolWorker struct {
+	startY, endY, startX, endX int
+
+	current, next [][]uint8
+	counter       *neighbourCounter
+
+	sends    []*haloTransfer // cells of this worker needed by others
+	receives []*haloTransfer // cells of others needed in this worker's halo
+	own      []haloCell      // halo cells that come from this worker's own part of the world
+
+	tiles   []int  // tiles that overlap this worker's part of the world
+	changed []bool // tiles this worker changed on the last turn
+	start   chan int
+	busy    time.Duration // time spent computing turns, not waiting for halos or other workers
+	changes turnChanges   // what this worker changed on the last turn
+}
+
+// scheduler runs the turns of the world on a set of long-lived worker goroutines.
+type scheduler interface {
+	// step runs a turn and returns how many tiles were skipped.
+	step(turn int) int
+	// immutable wraps the current turn of the world in a getter closure, to be read between turns.
+	immutable() func(y, x int) uint8
+	// busy returns the time each worker has spent computing turns.
+	busy() []time.Duration
+	// hash returns the Zobrist hash of the current turn of the world.
+	hash() uint64
+	// counts returns how many cells were born and how many died on the last turn.
+	counts() (births, deaths int)
+	// set changes cell (y, x) of the current turn of the world, between turns.
+	set(y, x int, value uint8)
+	// stop ends the worker goroutines, waiting for every one of them to return.
+	stop()
+}
+
+// workerPool runs the world on long-lived workers, one for each region of the world returned by decompose. The distributor starts each turn and waits for every
+// worker to finish it, so between turns the workers are idle and the world can be read from their buffers.
+type workerPool struct {
+	p       Params
+	rule    Rule
+	tiles   *tileGrid
+	workers []*poolWorker
+	owner   []int // owner[y*p.ImageWidth+x] is the worker that owns cell (y, x)
+	done    chan bool
+	keys    *zobrist
+	world   uint64 // the hash of the current turn of the world
+	last    turnChanges
+}
+
+// newWorkerPool divides the world between the workers, works out which cells each worker must send to the others
+// each turn, and starts the workers.
+func newWorkerPool(p Params, rule Rule, world [][]uint8, tiles *tileGrid, keys *zobrist, c distributorChannels) *workerPool {
+	pool := &workerPool{
+		p:     p,
+		rule:  rule,
+		tiles: tiles,
+		keys:  keys,
+		owner: make([]int, p.ImageHeight*p.ImageWidth),
+		done:  make(chan bool),
+	}
+	for i, part := range decompose(p) {
+		pool.workers = append(pool.workers, pool.newWorker(i, part.startY, part.endY, part.startX, part.endX, world))
+	}
+	pool.planHalos()
+	pool.world = keys.hash(p, func(y, x int) uint8 { return world[y][x] })
+
+	for _, w := range pool.workers {
+		go w.run(pool, c)
+	}
+	return pool
+}
+
+// region is the rectangle of the world owned by a worker.
+type region struct {
+	startY, endY, startX, endX int
+}
+
+// decompose divides the world between the workers: into p.Threads horizontal strips by default, into a grid of
+// p.Threads tiles with AutoTiles, or into tiles of TileWidth by TileHeight cells with a worker for each tile.
+func decompose(p Params) []region {
+	rows, columns := p.Threads, 1
+	if p.TileWidth == AutoTiles || p.TileHeight == AutoTiles {
+		rows, columns = autoGrid(p)
+	} else if p.TileWidth > 0 || p.TileHeight > 0 {
+		rows, columns = 1, 1
+		if p.TileHeight > 0 {
+			rows = (p.ImageHeight + p.TileHeight - 1) / p.TileHeight
+		}
+		if p.TileWidth > 0 {
+			columns = (p.ImageWidth + p.TileWidth - 1) / p.TileWidth
+		}
+	}
+
+	var regions []region
+	for i := 0; i < rows; i++ {
+		startY, endY := cut(i, rows, p.ImageHeight, p.TileHeight)
+		for j := 0; j < columns; j++ {
+			startX, endX := cut(j, columns, p.ImageWidth, p.TileWidth)
+			regions = append(regions, region{startY, endY, startX, endX})
+		}
+	}
+	return regions
+}
+
+// cut returns the start and end of the i-th of n parts of a side of the world. Parts are size cells long when size
+// is given, and otherwise share the side equally, with the remainder going to the last part.
+func cut(i, n, length, size int) (start, end int) {
+	if size <= 0 {
+		size = length / n
+	}
+	start, end = i*size, (i+1)*size
+	if i == n-1 || end > length {
+		end = length
+	}
+	return start, end
+}
+
+// autoGrid chooses how many rows and columns of tiles to split the world into, so that there is a tile for every
+// thread and the tiles are as close to square as possible. The shorter the edges of a tile, the fewer halo cells
+// its worker has to exchange each turn.
+func autoGrid(p Params) (rows, columns int) {
+	rows, columns = p.Threads, 1
+	best := -1.0
+	for r := 1; r <= p.Threads; r++ {
+		if p.Threads%r != 0 {
+			continue
+		}
+		c := p.Threads / r
+		difference := math.Abs(float64(p.ImageHeight)/float64(r) - float64(p.ImageWidth)/float64(c))
+		if best < 0 || difference < best {
+			rows, columns, best = r, c, difference
+		}
+	}
+	return rows, columns
+}
+
+// newWorker makes the worker owning the given part of the world, copying the part into both of its buffers.
+func (pool *workerPool) newWorker(index, startY, endY, startX, endX int, world [][]uint8) *poolWorker {
+	r := pool.rule.Radius
+	w := &poolWorker{
+		startY: startY, endY: endY, startX: startX, endX: endX,
+		counter: newNeighbourCounter(pool.rule, pool.tiles.size, pool.tiles.size),
+		changed: make([]bool, len(pool.tiles.active)),
+		start:   make(chan int),
+	}
+	w.current = make([][]uint8, endY-startY+2*r)
+	w.next = make([][]uint8, endY-startY+2*r)
+	for i := range w.current {
+		w.current[i] = make([]uint8, endX-startX+2*r)
+		w.next[i] = make([]uint8, endX-startX+2*r)
+	}
+	for y := startY; y < endY; y++ {
+		for x := startX; x < endX; x++ {
+			pool.owner[y*pool.p.ImageWidth+x] = index
+			w.current[y-startY+r][x-startX+r] = world[y][x]
+			w.next[y-startY+r][x-startX+r] = world[y][x]
+		}
+	}
+	for t := range pool.tiles.active {
+		tileStartY, tileEndY, tileStartX, tileEndX := pool.tiles.bounds(t, pool.p)
+		if tileStartY < endY && tileEndY > startY && tileStartX < endX && tileEndX > startX {
+			w.tiles = append(w.tiles, t)
+		}
+	}
+	return w
+}
+
+// planHalos finds where every halo cell of every worker comes from, through the topology of the world.
+// Cells owned by another worker are collected into one transfer for each pair of workers.
+func (pool *workerPool) planHalos() {
+	p, r := pool.p, pool.rule.Radius
+	for to, w := range pool.workers {
+		if w.startY == w.endY || w.startX == w.endX {
+			//Workers left with no cells have no halo to fill
+			continue
+		}
+		transfers := make(map[int]*haloTransfer)
+		for i := range w.current {
+			for j := range w.current[i] {
+				if i >= r && i < len(w.current)-r && j >= r && j < len(w.current[i])-r {
+					continue
+				}
+				y, x, ok := p.Topology.locate(w.startY-r+i, w.startX-r+j, p.ImageHeight, p.ImageWidth)
+				if !ok {
+					//Beyond a dead edge: the halo cell is never written, so stays dead in both buffers
+					continue
+				}
+				from := pool.owner[y*p.ImageWidth+x]
+				source := pool.workers[from]
+				cell := haloCell{fromY: y - source.startY + r, fromX: x - source.startX + r, toY: i, toX: j}
+				if from == to {
+					w.own = append(w.own, cell)
+					continue
+				}
+				transfer, ok := transfers[from]
+				if !ok {
+					transfer = &haloTransfer{channel: make(chan []uint8, 1)}
+					transfers[from] = transfer
+					source.sends = append(source.sends, transfer)
+					w.receives = append(w.receives, transfer)
+				}
+				transfer.cells = append(transfer.cells, cell)
+			}
+		}
+		for _, transfer := range transfers {
+			transfer.buffer = make([]uint8, len(transfer.cells))
+		}
+	}
+}
+
+// run computes a turn every time the distributor starts one, until the start channel is closed.
+func (w *poolWorker) run(pool *workerPool, c distributorChannels) {
+	for turn := range w.start {
+		w.exchangeHalo()
+		w.calculateNextState(pool, c, turn)
+		w.current, w.next = w.next, w.current
+		pool.done <- true
+	}
+	//Letting stop know this worker has returned
+	pool.done <- true
+}
+
+// exchangeHalo sends the edge cells of this worker to the workers that need them, then fills its own halo.
+// Each transfer channel holds one buffer, so sends never wait for the receiving worker.
+func (w *poolWorker) exchangeHalo() {
+	for _, send := range w.sends {
+		for k, cell := range send.cells {
+			send.buffer[k] = w.current[cell.fromY][cell.fromX]
+		}
+		send.channel <- send.buffer
+	}
+	for _, receive := range w.receives {
+		buffer := <-receive.channel
+		for k, cell := range receive.cells {
+			w.current[cell.toY][cell.toX] = buffer[k]
+		}
+	}
+	for _, cell := range w.own {
+		w.current[cell.toY][cell.toX] = w.current[cell.fromY][cell.fromX]
+	}
+}
+
+// calculateNextState writes the next turn of every active tile of this worker's part of the world into the next buffer.
+// Skipped tiles are already correct in the next buffer: they have not changed for two turns.
+func (w *poolWorker) calculateNextState(pool *workerPool, c distributorChannels, turn int) {
+	r := pool.rule.Radius
+	started := time.Now()
+	w.changes = turnChanges{report: !pool.p.NoFlips}
+	for _, t := range w.tiles {
+		w.changed[t] = false
+		if !pool.tiles.active[t] {
+			continue
+		}
+		tileStartY, tileEndY, tileStartX, tileEndX := pool.tiles.bounds(t, pool.p)
+		y0, y1 := clamp(tileStartY, w.startY, w.endY), clamp(tileEndY, w.startY, w.endY)
+		x0, x1 := clamp(tileStartX, w.startX, w.endX), clamp(tileEndX, w.startX, w.endX)
+		w.changed[t] = nextRegion(pool.rule, pool.keys, w.counter, w.current, w.next, w.startY-r, w.startX-r, y0, y1, x0, x1, &w.changes)
+	}
+	w.busy += time.Since(started)
+	w.changes.send(c, turn)
+}
+
+// nextRegion writes the next turn of rows y0 to y1 and columns x0 to x1 of the world from the current buffer into
+// the next one, where cell (y, x) of the world is held at (y-originY, x-originX) of both buffers.
+// It reports whether any of the cells changed, and adds the changes to the ones the worker has made this turn.
+func nextRegion(rule Rule, keys *zobrist, counter *neighbourCounter, current, next [][]uint8, originY, originX, y0, y1, x0, x1 int, changes *turnChanges) bool {
+	//Find number of neighbours alive for every cell in the region
+	counter.count(current, y0-originY, y1-originY, x0-originX, x1-originX)
+
+	changed := false
+	for y := y0; y < y1; y++ {
+		i := y - originY
+		for x := x0; x < x1; x++ {
+			j := x - originX
+			//Implement rules of life: births, survivals, deaths and decay
+			value := rule.next(current[i][j], counter.counts[y-y0][x-x0])
+			next[i][j] = value
+			if value != current[i][j] {
+				changed = true
+				changes.add(keys, y, x, current[i][j], value)
+				if !changes.report {
+					continue
+				}
+				if rule.States > 2 {
+					changes.changed = append(changes.changed, util.Cell{X: x, Y: y})
+					changes.states = append(changes.states, value)
+				} else {
+					changes.flipped = append(changes.flipped, util.Cell{X: x, Y: y})
+				}
+			}
+		}
+	}
+	return changed
+}
+
+// turnChanges is what a worker changed on a turn: the change to the hash of the world,
+// and how many cells were born and how many died, including alive cells starting to decay.
+// When report is set, the cells that changed are gathered too, to be sent in one batch by the worker: the cells that
+// flipped for two-state rules, and the cells of Generations rules along with their new states.
+type turnChanges struct {
+	hash           uint64
+	births, deaths int
+	report         bool
+	flipped        []util.Cell
+	changed        []util.Cell
+	states         []uint8
+}
+
+// add records cell (y, x) changing from one value to another.
+func (changes *turnChanges) add(keys *zobrist, y, x int, from, to uint8) {
+	changes.hash ^= keys.term(y, x, from) ^ keys.term(y, x, to)
+	if to == 255 {
+		changes.births++
+	} else if from == 255 {
+		changes.deaths++
+	}
+}
+
+// send sends the cells gathered on a turn, as one CellsFlipped or for Generations rules one CellStatesChanged.
+func (changes *turnChanges) send(c distributorChannels, turn int) {
+	reportCellsFlipped(c, turn, changes.flipped)
+	reportCellStatesChanged(c, turn, changes.changed, changes.states)
+}
+
+// merge adds the changes of another worker. The cells it flipped have already been sent.
+func (changes *turnChanges) merge(other turnChanges) {
+	changes.hash ^= other.hash
+	changes.births += other.births
+	changes.deaths += other.deaths
+}
+
+// step runs a turn on every worker and waits for them all to finish it, then marks the tiles to recompute next turn.
+// It returns how many tiles were skipped.
+func (pool *workerPool) step(turn int) int {
+	pool.last = turnChanges{}
+	for _, w := range pool.workers {
+		w.start <- turn
+	}
+	for range pool.workers {
+		<-pool.done
+	}
+
+	//A tile split between workers has changed if any of them changed it
+	changed := pool.tiles.changed
+	for t := range changed {
+		changed[t] = false
+	}
+	for _, w := range pool.workers {
+		for _, t := range w.tiles {
+			changed[t] = changed[t] || w.changed[t]
+		}
+		pool.last.merge(w.changes)
+	}
+	pool.world ^= pool.last.hash
+	return pool.tiles.update(changed)
+}
+
+// immutable wraps the current turn of the world held by the workers in a getter closure.
+// It must only be read between turns, while the workers are idle.
+func (pool *workerPool) immutable() func(y, x int) uint8 {
+	r := pool.rule.Radius
+	return func(y, x int) uint8 {
+		w := pool.workers[pool.owner[y*pool.p.ImageWidth+x]]
+		return w.current[y-w.startY+r][x-w.startX+r]
+	}
+}
+
+// busy returns the time each worker has spent computing turns.
+func (pool *workerPool) busy() []time.Duration {
+	var busy []time.Duration
+	for _, w := range pool.workers {
+		busy = append(busy, w.busy)
+	}
+	return busy
+}
+
+// hash returns the Zobrist hash of the current turn of the world.
+func (pool *workerPool) hash() uint64 {
+	return pool.world
+}
+
+// counts returns how many cells were born and how many died on the last turn.
+func (pool *workerPool) counts() (births, deaths int) {
+	return pool.last.births, pool.last.deaths
+}
+
+// set changes cell (y, x) in both buffers of the worker that owns it, so that tiles skipped later are still correct,
+// and wakes every tile to take the change into account.
+func (pool *workerPool) set(y, x int, value uint8) {
+	r := pool.rule.Radius
+	w := pool.workers[pool.owner[y*pool.p.ImageWidth+x]]
+	i, j := y-w.startY+r, x-w.startX+r
+	pool.world ^= pool.keys.term(y, x, w.current[i][j]) ^ pool.keys.term(y, x, value)
+	w.current[i][j], w.next[i][j] = value, value
+	pool.tiles.wake()
+}
+
+// stop ends the worker goroutines, waiting for every one of them to return.
+func (pool *workerPool) stop() {
+	for _, w := range pool.workers {
+		close(w.start)
+	}
+	for range pool.workers {
+		<-pool.done
+	}
+}
@@ -0,0 +1,330 @@
+package gol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultRule is the rulestring of Conway's Game of Life, used when Params.Rule is empty.
+const DefaultRule = "B3/S23"
+
+// maxRadius is the largest neighbourhood radius accepted for Larger than Life rules.
+const maxRadius = 500
+
+// Neighbourhood is the shape of the cells counted around each cell.
+type Neighbourhood int
+
+const (
+	Moore      Neighbourhood = iota // every cell within Radius in both directions (a square)
+	VonNeumann                      // every cell within a Manhattan distance of Radius (a diamond)
+)
+
+// Rule describes a Life-like, Generations or Larger than Life cellular automaton.
+// Birth[n] reports whether a dead cell with n alive neighbours is born,
+// Survival[n] reports whether an alive cell with n alive neighbours stays alive.
+// States is 2 for Life-like rules. Generations rules have more states: an alive cell that does not
+// survive steps through States-2 decaying states before it is dead, and decaying cells are not
+// counted as alive neighbours.
+// Radius and Neighbourhood give the cells that are counted, and Middle reports whether a cell counts itself.
+type Rule struct {
+	Birth         []bool
+	Survival      []bool
+	States        int
+	Radius        int
+	Neighbourhood Neighbourhood
+	Middle        bool
+}
+
+// ParseRule parses a rulestring in B/S notation (e.g. "B36/S23" for HighLife, "B2/S" for Seeds).
+// The older S/B notation used by Life 1.05 files (e.g. "23/36") is also accepted.
+// Generations rules add the number of states as a third part, e.g. "B2/S/C3" or "/2/3" for Brian's Brain.
+// Larger than Life rules use Golly's notation, e.g. "R5,C0,M1,S34..58,B34..45,NM" for Bosco's rule.
+// An empty rulestring gives Conway's Game of Life.
+func ParseRule(rulestring string) (Rule, error) {
+	s := strings.TrimSpace(rulestring)
+	if s == "" {
+		s = DefaultRule
+	}
+	if strings.HasPrefix(strings.ToUpper(s), "R") {
+		return parseLargerThanLife(rulestring, strings.ToUpper(s))
+	}
+
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 && len(parts) != 3 {
+		return Rule{}, fmt.Errorf("invalid rule %q: expected the form B<digits>/S<digits> or B<digits>/S<digits>/C<states>", rulestring)
+	}
+
+	rule := Rule{Birth: make([]bool, 9), Survival: make([]bool, 9), States: 2, Radius: 1, Neighbourhood: Moore}
+	if len(parts) == 3 {
+		states, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(parts[2]), "C"))
+		if err != nil || states < 2 || states > 256 {
+			return Rule{}, fmt.Errorf("invalid rule %q: number of states must be between 2 and 256", rulestring)
+		}
+		rule.States = states
+	}
+
+	var birth, survival string
+	first, second := strings.ToUpper(parts[0]), strings.ToUpper(parts[1])
+	switch {
+	case strings.HasPrefix(first, "B") && strings.HasPrefix(second, "S"):
+		birth, survival = first[1:], second[1:]
+	case strings.HasPrefix(first, "S") && strings.HasPrefix(second, "B"):
+		survival, birth = first[1:], second[1:]
+	default:
+		//S/B notation: survival counts come first
+		survival, birth = first, second
+	}
+
+	if err := parseCounts(birth, rule.Birth); err != nil {
+		return Rule{}, fmt.Errorf("invalid rule %q: birth %v", rulestring, err)
+	}
+	if err := parseCounts(survival, rule.Survival); err != nil {
+		return Rule{}, fmt.Errorf("invalid rule %q: survival %v", rulestring, err)
+	}
+	return rule, nil
+}
+
+// parseCounts marks every neighbour count listed in digits.
+func parseCounts(digits string, counts []bool) error {
+	for _, d := range digits {
+		if d < '0' || d > '8' {
+			return fmt.Errorf("count %q is not between 0 and 8", d)
+		}
+		counts[d-'0'] = true
+	}
+	return nil
+}
+
+// parseLargerThanLife parses the comma separated Rr,Cc,Mm,Smin..max,Bmin..max,Nn notation.
+// Several ranges or single counts may follow S and B, e.g. "S2..3,5,B3".
+func parseLargerThanLife(rulestring, s string) (Rule, error) {
+	rule := Rule{States: 2, Radius: 1, Neighbourhood: Moore}
+	var birth, survival []string
+	var counts *[]string
+	for _, token := range strings.Split(s, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			return Rule{}, fmt.Errorf("invalid rule %q: empty component", rulestring)
+		}
+		value := token[1:]
+		var err error
+		switch token[0] {
+		case 'R':
+			counts = nil
+			rule.Radius, err = strconv.Atoi(value)
+			if err == nil && (rule.Radius < 1 || rule.Radius > maxRadius) {
+				err = fmt.Errorf("radius must be between 1 and %d", maxRadius)
+			}
+		case 'C':
+			counts = nil
+			rule.States, err = strconv.Atoi(value)
+			if err == nil && (rule.States < 0 || rule.States > 256) {
+				err = fmt.Errorf("number of states must be between 0 and 256")
+			}
+			if rule.States < 2 {
+				rule.States = 2
+			}
+		case 'M':
+			counts = nil
+			if value != "0" && value != "1" {
+				err = fmt.Errorf("middle must be M0 or M1")
+			}
+			rule.Middle = value == "1"
+		case 'N':
+			counts = nil
+			switch value {
+			case "M":
+				rule.Neighbourhood = Moore
+			case "N":
+				rule.Neighbourhood = VonNeumann
+			default:
+				err = fmt.Errorf("neighbourhood must be NM (Moore) or NN (von Neumann)")
+			}
+		case 'S':
+			counts = &survival
+		case 'B':
+			counts = &birth
+		default:
+			if counts == nil {
+				err = fmt.Errorf("unexpected component %q", token)
+			}
+			value = token
+		}
+		if err != nil {
+			return Rule{}, fmt.Errorf("invalid rule %q: %v", rulestring, err)
+		}
+		if counts != nil && value != "" {
+			*counts = append(*counts, value)
+		}
+	}
+
+	rule.Birth = make([]bool, rule.neighbourhoodSize()+1)
+	rule.Survival = make([]bool, rule.neighbourhoodSize()+1)
+	if err := parseRanges(birth, rule.Birth); err != nil {
+		return Rule{}, fmt.Errorf("invalid rule %q: birth %v", rulestring, err)
+	}
+	if err := parseRanges(survival, rule.Survival); err != nil {
+		return Rule{}, fmt.Errorf("invalid rule %q: survival %v", rulestring, err)
+	}
+	return rule, nil
+}
+
+// parseRanges marks every neighbour count in a list of single counts and min..max ranges.
+func parseRanges(ranges []string, counts []bool) error {
+	for _, r := range ranges {
+		bounds := strings.SplitN(r, "..", 2)
+		min, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return fmt.Errorf("range %q is not a number", r)
+		}
+		max := min
+		if len(bounds) == 2 {
+			if max, err = strconv.Atoi(bounds[1]); err != nil {
+				return fmt.Errorf("range %q is not a number", r)
+			}
+		}
+		if min < 0 || max < min || max >= len(counts) {
+			return fmt.Errorf("range %q is not within 0..%d", r, len(counts)-1)
+		}
+		for n := min; n <= max; n++ {
+			counts[n] = true
+		}
+	}
+	return nil
+}
+
+// neighbourhoodSize returns how many cells are counted around each cell.
+func (rule Rule) neighbourhoodSize() int {
+	size := (2*rule.Radius + 1) * (2*rule.Radius + 1)
+	if rule.Neighbourhood == VonNeumann {
+		size = 2*rule.Radius*(rule.Radius+1) + 1
+	}
+	if !rule.Middle {
+		size--
+	}
+	return size
+}
+
+// isLifeLike reports whether the rule counts the 8 cells around each cell, so can be written in B/S notation.
+func (rule Rule) isLifeLike() bool {
+	return rule.Radius == 1 && rule.Neighbourhood == Moore && !rule.Middle
+}
+
+// String returns the rule in canonical B/S notation, or Golly's notation for Larger than Life rules.
+func (rule Rule) String() string {
+	var b strings.Builder
+	if !rule.isLifeLike() {
+		states := rule.States
+		if states == 2 {
+			states = 0
+		}
+		middle := 0
+		if rule.Middle {
+			middle = 1
+		}
+		neighbourhood := "M"
+		if rule.Neighbourhood == VonNeumann {
+			neighbourhood = "N"
+		}
+		fmt.Fprintf(&b, "R%d,C%d,M%d,S%v,B%v,N%v", rule.Radius, states, middle,
+			formatRanges(rule.Survival), formatRanges(rule.Birth), neighbourhood)
+		return b.String()
+	}
+
+	b.WriteString("B")
+	for n, born := range rule.Birth {
+		if born {
+			b.WriteByte(byte('0' + n))
+		}
+	}
+	b.WriteString("/S")
+	for n, survives := range rule.Survival {
+		if survives {
+			b.WriteByte(byte('0' + n))
+		}
+	}
+	if rule.States > 2 {
+		fmt.Fprintf(&b, "/C%d", rule.States)
+	}
+	return b.String()
+}
+
+// formatRanges lists the marked counts as comma separated single counts and min..max ranges.
+func formatRanges(counts []bool) string {
+	var ranges []string
+	for n := 0; n < len(counts); n++ {
+		if !counts[n] {
+			continue
+		}
+		min := n
+		for n+1 < len(counts) && counts[n+1] {
+			n++
+		}
+		if min == n {
+			ranges = append(ranges, strconv.Itoa(n))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d..%d", min, n))
+		}
+	}
+	return strings.Join(ranges, ",")
+}
+
+// stateValue returns the pixel value stored in the world for a cell state.
+// State 0 is dead (0), state 1 is alive (255) and decaying states fade through evenly spaced grey levels.
+func (rule Rule) stateValue(state int) uint8 {
+	if state == 0 {
+		return 0
+	}
+	return uint8(255 - (state-1)*255/(rule.States-1))
+}
+
+// quantise maps an arbitrary pixel value onto the value of the nearest state of the rule.
+func (rule Rule) quantise(value uint8) uint8 {
+	nearest := uint8(0)
+	for state := 1; state < rule.States; state++ {
+		v := rule.stateValue(state)
+		if absDiff(v, value) < absDiff(nearest, value) {
+			nearest = v
+		}
+	}
+	return nearest
+}
+
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// stateOf returns the state stored as the given pixel value. Values that are not produced by
+// stateValue belong to the nearest decaying state below them.
+func (rule Rule) stateOf(value uint8) int {
+	if value == 0 {
+		return 0
+	}
+	fade := 255 - int(value)
+	return 1 + (fade*(rule.States-1)+254)/255
+}
+
+// next returns the value of a cell on the next turn given its current value and number of alive neighbours.
+func (rule Rule) next(value uint8, aliveNeighbours int) uint8 {
+	switch value {
+	case 0:
+		if rule.Birth[aliveNeighbours] {
+			return 255
+		}
+		return 0
+	case 255:
+		if rule.Survival[aliveNeighbours] {
+			return 255
+		}
+	}
+	//Alive cells that do not survive, and decaying cells, move on to the next state until they are dead
+	state := rule.stateOf(value) + 1
+	if state >= rule.States {
+		return 0
+	}
+	return rule.stateValue(state)
+}
@@ -0,0 +1,547 @@
+package gol
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"uk.ac.bris.cs/gameoflife/census"
+	"uk.ac.bris.cs/gameoflife/pattern"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Simulation is a world of the Game of Life that is moved on by its caller, a number of turns at a time, instead of
+// being run to Params.Turns. It starts from the same image, pattern or soup as Run, runs on the same engine, and
+// reports the same events to its subscribers. Its methods must not be called at the same time as each other.
+type Simulation struct {
+	p        Params
+	rule     Rule
+	c        distributorChannels
+	filename string // the name of the files written for the world, from its width and height
+	turn     int
+
+	//The engine holding the world: a bit-packed world, a HashLife quadtree, or workers that each own a part of it
+	packed   *packedEngine
+	hashLife *hashLifeEngine
+	tiles    *tileGrid
+	pool     scheduler
+
+	keys       *zobrist
+	cycles     *cycleDetector // nil once a cycle has been found, and always with HashLife
+	population int            // the alive cells, counted from the births and deaths the engines report
+
+	subscribe   chan subscription // taken by the broadcaster, when there is one, between the events of the simulation
+	broadcasted chan bool         // closed once the channel of every subscriber has been closed, when there is a broadcaster
+	closed      bool
+}
+
+// eventBuffer is how many events the simulation can run ahead of the goroutine forwarding them to subscribers.
+const eventBuffer = 1024
+
+// subscription is a channel to forward the events of a simulation to, along with the world on the turn it subscribed,
+// which is sent as cell events before any other event.
+type subscription struct {
+	events chan<- Event
+	turn   int
+	world  [][]uint8
+}
+
+// NewSimulation checks the parameters and loads the world at turn 0, starting the workers and io goroutine.
+// Params.Turns is only used to name the population CSV file. Files that cannot be read are returned as IOErrors.
+// The simulation must be closed once it is no longer needed.
+func NewSimulation(p Params) (*Simulation, error) {
+	return newSimulation(p, nil)
+}
+
+// newSimulation makes a simulation that sends its events straight to the given channel, rather than through the
+// broadcaster to its subscribers, and closes it along with the simulation, or once the simulation cannot be made.
+func newSimulation(p Params, events chan<- Event) (*Simulation, error) {
+	rule, err := validate(&p)
+	if err != nil {
+		if events != nil {
+			close(events)
+		}
+		return nil, err
+	}
+	s := &Simulation{
+		p:        p,
+		rule:     rule,
+		filename: strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight),
+	}
+	if events == nil {
+		broadcast := make(chan Event, eventBuffer)
+		s.subscribe = make(chan subscription)
+		s.broadcasted = make(chan bool)
+		go s.broadcast(broadcast, s.subscribe)
+		events = broadcast
+	}
+
+	ioCommand := make(chan ioCommand)
+	filename := make(chan string)
+	turn := make(chan int)
+	output := make(chan uint8)
+	input := make(chan uint8)
+	ioIdle := make(chan error)
+	ioLoaded := make(chan error)
+	macrocell := make(chan hashLifeWorld)
+	objects := make(chan []census.Tally)
+	statistics := make(chan TurnStatistics)
+	patterns := make(chan pattern.Pattern)
+	checkpoints := make(chan checkpoint)
+
+	ioChannels := ioChannels{
+		command:    ioCommand,
+		idle:       ioIdle,
+		events:     events,
+		loaded:     ioLoaded,
+		filename:   filename,
+		turn:       turn,
+		output:     output,
+		input:      input,
+		macrocell:  macrocell,
+		census:     objects,
+		statistic:  statistics,
+		patterns:   patterns,
+		checkpoint: checkpoints,
+	}
+	go startIo(p, ioChannels)
+
+	distributorChannels := distributorChannels{
+		events:       events,
+		ioCommand:    ioCommand,
+		ioIdle:       ioIdle,
+		ioLoaded:     ioLoaded,
+		ioFilename:   filename,
+		ioTurn:       turn,
+		ioOutput:     output,
+		ioInput:      input,
+		ioMacrocell:  macrocell,
+		ioCensus:     objects,
+		ioStatistic:  statistics,
+		ioPattern:    patterns,
+		ioCheckpoint: checkpoints,
+	}
+	s.c = distributorChannels
+
+	if err := s.load(); err != nil {
+		close(ioCommand)
+		close(events)
+		if s.broadcasted != nil {
+			<-s.broadcasted
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// load fills the engine with the starting world: a random soup, or one read by the io goroutine from a PGM image,
+// a pattern or a Macrocell file, or the world and turn of the checkpoint being resumed.
+// It then starts the workers, and remembers the hash of the world to look for cycles.
+func (s *Simulation) load() error {
+	p, rule, c := s.p, s.rule, s.c
+
+	//Create a 2D slice to store the world, or a bit-packed world or HashLife quadtree when selected.
+	var golWorld [][]uint8
+	if p.Packed {
+		s.packed = newPackedEngine(p, rule)
+	} else if p.HashLife {
+		s.hashLife = newHashLifeEngine(p, rule)
+	}
+
+	if p.Macrocell != "" && p.Resume == "" {
+		//Send command to IO, asking to read the HashLife world from a Macrocell file
+		c.ioCommand <- ioInputMacrocell
+		c.ioFilename <- p.Macrocell
+		c.ioMacrocell <- hashLifeWorld{universe: s.hashLife.universe, world: s.hashLife.world}
+		if err := <-c.ioLoaded; err != nil {
+			return err
+		}
+		loaded := <-c.ioMacrocell
+		//Let the event component know which cells start alive
+		s.hashLife.moveTo(c, 0, loaded.world)
+	} else {
+		//Make a random soup, or receive the starting world from IO, one pixel at a time from a PGM image, or as the cells of a pattern
+		var pixel func(y, x int) uint8
+		if p.Resume != "" {
+			//Send command to IO, asking to read the checkpoint, and carry on from its turn
+			c.ioCommand <- ioInputCheckpoint
+			c.ioFilename <- p.Resume
+			if err := <-c.ioLoaded; err != nil {
+				return err
+			}
+			saved := <-c.ioCheckpoint
+			s.turn = saved.Turn
+			pixel = makeImmutableMatrix(saved.world)
+		} else if p.Soup.Density != 0 {
+			//Draw a random soup onto the board, without reading anything
+			pixel = makeImmutableMatrix(soupBoard(p))
+		} else if _, err := pattern.FormatOf(p.Input); err == nil {
+			//Send command to IO, asking to read the pattern, and draw it onto the board
+			c.ioCommand <- ioInputPattern
+			c.ioFilename <- p.Input
+			if err := <-c.ioLoaded; err != nil {
+				return err
+			}
+			pixel = makeImmutableMatrix(patternBoard(p, <-c.ioPattern))
+		} else {
+			//Send command to IO, asking to run readPgmImage function
+			c.ioCommand <- 1
+
+			//Send the path of the image to IO, allowing readPgmImage function to process input of image
+			c.ioFilename <- imagePath(p)
+			if err := <-c.ioLoaded; err != nil {
+				return err
+			}
+			pixel = func(y, x int) uint8 {
+				return <-c.ioInput
+			}
+		}
+
+		if s.packed == nil {
+			golWorld = make([][]uint8, p.ImageHeight)
+			for y := range golWorld {
+				golWorld[y] = make([]uint8, p.ImageWidth)
+			}
+		}
+
+		//Loop through 2d slice initializing each cell
+		var flipped, changed []util.Cell
+		var states []uint8
+		for y := 0; y < p.ImageHeight; y++ {
+			for x := 0; x < p.ImageWidth; x++ {
+				//Receive data from channel and assign to 2d slice, snapping grey levels to the states of the rule
+				b := rule.quantise(pixel(y, x))
+				if s.packed != nil {
+					if b == 255 {
+						s.packed.current.set(y, x)
+					}
+				} else {
+					golWorld[y][x] = b
+				}
+				if b != 0 && !p.NoFlips {
+					//Let the event component know which cells start alive (or decaying), in one batch for two-state rules
+					if rule.States > 2 {
+						changed = append(changed, util.Cell{X: x, Y: y})
+						states = append(states, b)
+					} else {
+						flipped = append(flipped, util.Cell{X: x, Y: y})
+					}
+				}
+			}
+		}
+		reportCellsFlipped(c, s.turn, flipped)
+		reportCellStatesChanged(c, s.turn, changed, states)
+
+		if s.hashLife != nil {
+			//Build the quadtree from the loaded image, which is no longer needed
+			s.hashLife.world = s.hashLife.universe.build(s.hashLife.world.level, 0, 0, makeImmutableMatrix(golWorld))
+			golWorld = nil
+		}
+	}
+
+	//Dividing the world into tiles, so that tiles where nothing is changing can be skipped,
+	//and handing it to long-lived workers that each own a part of it, or that share out rows of it each turn
+	s.keys = newZobrist(p)
+	if s.packed == nil && s.hashLife == nil {
+		s.tiles = newTileGrid(p, rule)
+		if p.WorkStealing {
+			s.pool = newStealingPool(p, rule, golWorld, s.tiles, s.keys, c)
+		} else {
+			s.pool = newWorkerPool(p, rule, golWorld, s.tiles, s.keys, c)
+		}
+	}
+
+	//Remembering the hash of every turn, to notice when the world starts repeating.
+	//HashLife never visits most turns, so cannot look for cycles.
+	if s.hashLife == nil {
+		s.cycles = newCycleDetector()
+		s.cycles.add(worldHash(s.keys, s.pool, s.packed), s.turn)
+	}
+
+	s.population = len(calculateAliveCells(p, s.immutable()))
+	return nil
+}
+
+// immutable wraps the current turn of the world held by whichever engine is running in a getter closure.
+func (s *Simulation) immutable() func(y, x int) uint8 {
+	if s.packed != nil {
+		return s.packed.immutable()
+	}
+	if s.hashLife != nil {
+		return s.hashLife.immutable()
+	}
+	return s.pool.immutable()
+}
+
+// Step moves the world on n turns, reporting the same events for them as Run.
+// With Params.FastForward, whole cycles of the world are skipped once it starts repeating.
+func (s *Simulation) Step(n int) {
+	for target := s.turn + n; s.turn < target; {
+		s.advance(target - s.turn)
+	}
+}
+
+// advance computes the next turn, or with HashLife as many turns as can be jumped at once without passing the
+// given number of remaining turns, and reports them.
+func (s *Simulation) advance(remaining int) {
+	p, c := s.p, s.c
+	target := s.turn + remaining
+
+	//Number of turns computed this time round, and the tiles left as they were
+	completed, skippedTiles := 1, 0
+
+	if s.hashLife != nil {
+		//HASHLIFE IMPLEMENTATION, JUMPING AS MANY TURNS AS POSSIBLE AT ONCE
+		completed = s.hashLife.jump(c, s.turn, remaining)
+	} else if s.packed != nil {
+		//BIT-PACKED IMPLEMENTATION, 64 CELLS PER WORD
+		s.packed.step(c, s.turn)
+	} else {
+		//PARALLELED IMPLEMENTATION ON THE WORKERS, WAITING FOR EVERY WORKER TO FINISH THE TURN
+		skippedTiles = s.pool.step(s.turn)
+	}
+
+	s.turn += completed
+	if s.cycles != nil {
+		if period, firstTurn, ok := s.cycles.confirm(worldHash(s.keys, s.pool, s.packed), s.turn, p, s.immutable()); ok {
+			c.events <- CycleDetected{CompletedTurns: s.turn, Period: period, FirstTurn: firstTurn}
+			//Only the first cycle is reported: the world stays in it from now on
+			s.cycles = nil
+			if p.FastForward {
+				//The world is the same every period turns, so whole periods can be skipped without computing them
+				s.turn += (target - s.turn) / period * period
+			}
+		}
+	}
+	if s.tiles != nil {
+		//Report how many tiles were left as they were
+		c.events <- TilesSkipped{CompletedTurns: s.turn, Skipped: skippedTiles, Tiles: len(s.tiles.active)}
+	}
+	births, deaths := lastCounts(s.pool, s.packed, s.hashLife)
+	s.population += births - deaths
+	statistics := TurnStatistics{
+		CompletedTurns: s.turn,
+		Births:         births,
+		Deaths:         deaths,
+		Population:     s.population,
+		Density:        float64(s.population) / float64(p.ImageWidth*p.ImageHeight),
+	}
+	c.events <- statistics
+	if p.PopulationCSV {
+		c.ioCommand <- ioOutputStatistics
+		c.ioFilename <- s.filename + "x" + strconv.Itoa(p.Turns)
+		c.ioStatistic <- statistics
+	}
+	//Report the completion of each turn
+	c.events <- TurnComplete{CompletedTurns: s.turn}
+}
+
+// Turn returns the number of turns completed.
+func (s *Simulation) Turn() int {
+	return s.turn
+}
+
+// World returns a copy of the current turn of the world, indexed by y then x, with alive cells 255 and dead cells 0.
+// Decaying cells of Generations rules are grey levels in between.
+func (s *Simulation) World() [][]uint8 {
+	data := s.immutable()
+	world := make([][]uint8, s.p.ImageHeight)
+	for y := range world {
+		world[y] = make([]uint8, s.p.ImageWidth)
+		for x := range world[y] {
+			world[y][x] = data(y, x)
+		}
+	}
+	return world
+}
+
+// AliveCells returns the alive cells of the current turn of the world.
+func (s *Simulation) AliveCells() []util.Cell {
+	return calculateAliveCells(s.p, s.immutable())
+}
+
+// SetCell makes a cell alive or dead between turns, reporting the change to subscribers on the current turn
+// in a CellFlipped, or for Generations rules a CellStateChanged.
+// Cells outside the world are ignored. The world may no longer repeat, so cycles are looked for afresh.
+func (s *Simulation) SetCell(cell util.Cell, alive bool) {
+	if cell.X < 0 || cell.Y < 0 || cell.X >= s.p.ImageWidth || cell.Y >= s.p.ImageHeight {
+		return
+	}
+	value := uint8(0)
+	if alive {
+		value = 255
+	}
+	previous := s.immutable()(cell.Y, cell.X)
+	if previous == value {
+		return
+	}
+
+	if s.hashLife != nil {
+		s.hashLife.world = s.hashLife.universe.set(s.hashLife.world, cell.Y, cell.X, alive)
+	} else if s.packed != nil {
+		if alive {
+			s.packed.current.set(cell.Y, cell.X)
+		} else {
+			s.packed.current.clear(cell.Y, cell.X)
+		}
+	} else {
+		s.pool.set(cell.Y, cell.X, value)
+	}
+
+	if value == 255 {
+		s.population++
+	} else if previous == 255 {
+		s.population--
+	}
+	if s.hashLife == nil {
+		s.cycles = newCycleDetector()
+		s.cycles.add(worldHash(s.keys, s.pool, s.packed), s.turn)
+	}
+	if !s.p.NoFlips {
+		reportCellChange(s.c, s.rule, s.turn, cell, value)
+	}
+}
+
+// checkpoint hands a checkpoint of the current turn to the io goroutine, to replace the last checkpoint of the run.
+func (s *Simulation) checkpoint() {
+	s.c.ioCommand <- ioOutputCheckpoint
+	s.c.ioFilename <- s.filename + "x" + strconv.Itoa(s.p.Turns)
+	s.c.ioCheckpoint <- s.snapshot()
+}
+
+// snapshot returns a checkpoint of the current turn, to be resumed with the same parameters.
+func (s *Simulation) snapshot() checkpoint {
+	p := s.p
+	p.Resume = ""
+	return checkpoint{Turn: s.turn, Params: p, world: s.World()}
+}
+
+// Save writes the current turn of the world to path as a PGM image, an RLE, plaintext or Life 1.06 pattern, a
+// checkpoint to resume from, or, when running HashLife, a Macrocell file, going by the extension of path.
+// Files that cannot be written are returned as IOErrors.
+func (s *Simulation) Save(path string) error {
+	var write func(file *os.File) error
+	save := writeFile
+	if extension := filepath.Ext(path); extension == ".checkpoint" {
+		saved := s.snapshot()
+		write = func(file *os.File) error {
+			return writeCheckpoint(file, saved, s.rule)
+		}
+		save = replaceFile
+	} else if extension == ".pgm" {
+		world := s.World()
+		write = func(file *os.File) error {
+			return writePgm(file, s.rule, s.turn, world)
+		}
+	} else if extension == ".mc" && s.hashLife != nil {
+		world := hashLifeWorld{universe: s.hashLife.universe, world: s.hashLife.world, turn: s.turn}
+		write = func(file *os.File) error {
+			return writeMacrocell(file, s.rule, world)
+		}
+	} else if format, err := pattern.FormatOf(path); err == nil {
+		snapshot := boardPattern(s.p, s.turn, s.immutable())
+		snapshot.Rule = s.rule.String()
+		write = func(file *os.File) error {
+			return pattern.Write(file, format, snapshot)
+		}
+	} else {
+		return fmt.Errorf("cannot save %v: the world is saved as a PGM image, a pattern, a checkpoint, or from HashLife a Macrocell file", path)
+	}
+
+	if err := save(path, write); err != nil {
+		return IOError{CompletedTurns: s.turn, Operation: "save", Filename: path, Err: err}
+	}
+	return nil
+}
+
+// Subscribe returns a channel that receives every event from now on, starting with a CellsFlipped holding the alive
+// cells of the world, or for Generations rules a CellStatesChanged holding every cell that is not dead, unless
+// Params.NoFlips is set. The channel is closed by Close. It must be read until then, as the simulation waits for
+// every subscriber to take each event. Events sent while there are no subscribers are dropped, so a simulation that
+// is stepped before anything subscribes reports nothing of those turns.
+func (s *Simulation) Subscribe() <-chan Event {
+	events := make(chan Event)
+	if s.closed {
+		close(events)
+		return events
+	}
+	sub := subscription{events: events, turn: s.turn}
+	if !s.p.NoFlips {
+		sub.world = s.World()
+	}
+	s.subscribe <- sub
+	return events
+}
+
+// broadcast forwards each event of the simulation to every subscriber in turn, in the order the events were sent,
+// and adds the subscriptions it is sent. Events sent while there are no subscribers are dropped. Once events is
+// closed, so is the channel of every subscriber.
+func (s *Simulation) broadcast(events <-chan Event, subscribe <-chan subscription) {
+	var subscribers []chan<- Event
+	forward := func(event Event) {
+		for _, subscriber := range subscribers {
+			subscriber <- event
+		}
+	}
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				for _, subscriber := range subscribers {
+					close(subscriber)
+				}
+				close(s.broadcasted)
+				return
+			}
+			forward(event)
+		case sub := <-subscribe:
+			//The simulation waits for Subscribe to return, so every event sent before it is already buffered,
+			//and goes only to the subscribers there were before
+			for len(events) > 0 {
+				forward(<-events)
+			}
+			//Bring the subscriber up to date with the world before it receives anything else
+			var flipped, changed []util.Cell
+			var states []uint8
+			for y := range sub.world {
+				for x, value := range sub.world[y] {
+					if value == 0 {
+						continue
+					}
+					if s.rule.States > 2 {
+						changed = append(changed, util.Cell{X: x, Y: y})
+						states = append(states, value)
+					} else {
+						flipped = append(flipped, util.Cell{X: x, Y: y})
+					}
+				}
+			}
+			if len(flipped) > 0 {
+				sub.events <- CellsFlipped{CompletedTurns: sub.turn, Cells: flipped}
+			}
+			if len(changed) > 0 {
+				sub.events <- CellStatesChanged{CompletedTurns: sub.turn, Cells: changed, States: states}
+			}
+			subscribers = append(subscribers, sub.events)
+		}
+	}
+}
+
+// Close stops the workers, and the io goroutine once any output has been written, then closes the channel of every
+// subscriber after a Quitting StateChange. It returns the first file that could not be written, as an IOError.
+// The simulation cannot be used once closed.
+func (s *Simulation) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.pool != nil {
+		s.pool.stop()
+	}
+	err := finish(s.turn, s.c)
+	if s.broadcasted != nil {
+		<-s.broadcasted
+	}
+	return err
+}
@@ -0,0 +1,199 @@
+package gol
+
+import "time"
+
+// stealingWorker is a worker of the stealing pool. It owns no part of the world: each turn it takes chunks of rows
+// off the shared queue until there are none left, so workers given quick chunks go on to take more of them.
+type stealingWorker struct {
+	counter *neighbourCounter
+	start   chan int
+	busy    time.Duration
+	changes turnChanges // what this worker changed on the last turn
+}
+
+// stealingPool runs the world on p.Threads workers sharing a work queue. Each turn is split into chunks of one row
+// of tiles, and the chunks holding an active tile are put on the queue for whichever worker is idle to take.
+// Unlike the workerPool, the world is held in one pair of buffers, with a halo of radius cells that the
+// distributor fills in before each turn.
+type stealingPool struct {
+	p             Params
+	rule          Rule
+	tiles         *tileGrid
+	current, next [][]uint8
+	halo          []haloCell // where every halo cell of the buffers comes from, through the topology of the world
+	workers       []*stealingWorker
+	queue         chan int
+	done          chan bool
+	keys          *zobrist
+	world         uint64 // the hash of the current turn of the world
+	last          turnChanges
+}
+
+// newStealingPool copies the world into the buffers of the pool and starts its workers.
+func newStealingPool(p Params, rule Rule, world [][]uint8, tiles *tileGrid, keys *zobrist, c distributorChannels) *stealingPool {
+	r := rule.Radius
+	pool := &stealingPool{
+		p:       p,
+		rule:    rule,
+		tiles:   tiles,
+		current: make([][]uint8, p.ImageHeight+2*r),
+		next:    make([][]uint8, p.ImageHeight+2*r),
+		queue:   make(chan int, tiles.rows),
+		done:    make(chan bool),
+		keys:    keys,
+		world:   keys.hash(p, func(y, x int) uint8 { return world[y][x] }),
+	}
+	for i := range pool.current {
+		pool.current[i] = make([]uint8, p.ImageWidth+2*r)
+		pool.next[i] = make([]uint8, p.ImageWidth+2*r)
+	}
+	for y := range world {
+		copy(pool.current[y+r][r:], world[y])
+		copy(pool.next[y+r][r:], world[y])
+	}
+	for i := range pool.current {
+		for j := range pool.current[i] {
+			if i >= r && i < p.ImageHeight+r && j >= r && j < p.ImageWidth+r {
+				continue
+			}
+			y, x, ok := p.Topology.locate(i-r, j-r, p.ImageHeight, p.ImageWidth)
+			if !ok {
+				//Beyond a dead edge: the halo cell is never written, so stays dead in both buffers
+				continue
+			}
+			pool.halo = append(pool.halo, haloCell{fromY: y + r, fromX: x + r, toY: i, toX: j})
+		}
+	}
+
+	for i := 0; i < p.Threads; i++ {
+		w := &stealingWorker{
+			counter: newNeighbourCounter(rule, tiles.size, tiles.size),
+			start:   make(chan int),
+		}
+		pool.workers = append(pool.workers, w)
+		go w.run(pool, c)
+	}
+	return pool
+}
+
+// run computes chunks of a turn every time the distributor starts one, until the start channel is closed.
+// The queue is filled before the turn starts, so once it is empty the turn has no work left.
+func (w *stealingWorker) run(pool *stealingPool, c distributorChannels) {
+	for turn := range w.start {
+		started := time.Now()
+		w.changes = turnChanges{report: !pool.p.NoFlips}
+		for empty := false; !empty; {
+			select {
+			case row := <-pool.queue:
+				pool.calculateNextState(w.counter, &w.changes, row)
+			default:
+				empty = true
+			}
+		}
+		w.busy += time.Since(started)
+		w.changes.send(c, turn)
+		pool.done <- true
+	}
+	//Letting stop know this worker has returned
+	pool.done <- true
+}
+
+// calculateNextState writes the next turn of the active tiles in a row of tiles into the next buffer.
+// Every tile is in exactly one row, so workers never write the same changed flag.
+func (pool *stealingPool) calculateNextState(counter *neighbourCounter, changes *turnChanges, row int) {
+	r := pool.rule.Radius
+	for t := row * pool.tiles.columns; t < (row+1)*pool.tiles.columns; t++ {
+		pool.tiles.changed[t] = false
+		if !pool.tiles.active[t] {
+			continue
+		}
+		startY, endY, startX, endX := pool.tiles.bounds(t, pool.p)
+		pool.tiles.changed[t] = nextRegion(pool.rule, pool.keys, counter, pool.current, pool.next, -r, -r, startY, endY, startX, endX, changes)
+	}
+}
+
+// step fills in the halo, queues every row of tiles with an active tile, and runs the turn on every worker.
+// It returns how many tiles were skipped.
+func (pool *stealingPool) step(turn int) int {
+	for _, cell := range pool.halo {
+		pool.current[cell.toY][cell.toX] = pool.current[cell.fromY][cell.fromX]
+	}
+	for row := 0; row < pool.tiles.rows; row++ {
+		queued := false
+		for t := row * pool.tiles.columns; t < (row+1)*pool.tiles.columns; t++ {
+			if pool.tiles.active[t] {
+				queued = true
+				break
+			}
+		}
+		if queued {
+			pool.queue <- row
+		} else {
+			//A row that is not queued is left unchanged
+			for t := row * pool.tiles.columns; t < (row+1)*pool.tiles.columns; t++ {
+				pool.tiles.changed[t] = false
+			}
+		}
+	}
+
+	for _, w := range pool.workers {
+		w.start <- turn
+	}
+	for range pool.workers {
+		<-pool.done
+	}
+	pool.last = turnChanges{}
+	for _, w := range pool.workers {
+		pool.last.merge(w.changes)
+	}
+	pool.world ^= pool.last.hash
+	pool.current, pool.next = pool.next, pool.current
+	return pool.tiles.update(pool.tiles.changed)
+}
+
+// immutable wraps the current turn of the world in a getter closure.
+// It must only be read between turns, while the workers are idle.
+func (pool *stealingPool) immutable() func(y, x int) uint8 {
+	r := pool.rule.Radius
+	return func(y, x int) uint8 {
+		return pool.current[y+r][x+r]
+	}
+}
+
+// busy returns the time each worker has spent computing turns.
+func (pool *stealingPool) busy() []time.Duration {
+	var busy []time.Duration
+	for _, w := range pool.workers {
+		busy = append(busy, w.busy)
+	}
+	return busy
+}
+
+// hash returns the Zobrist hash of the current turn of the world.
+func (pool *stealingPool) hash() uint64 {
+	return pool.world
+}
+
+// counts returns how many cells were born and how many died on the last turn.
+func (pool *stealingPool) counts() (births, deaths int) {
+	return pool.last.births, pool.last.deaths
+}
+
+// set changes cell (y, x) in both buffers, so that tiles skipped later are still correct,
+// and wakes every tile to take the change into account.
+func (pool *stealingPool) set(y, x int, value uint8) {
+	r := pool.rule.Radius
+	pool.world ^= pool.keys.term(y, x, pool.current[y+r][x+r]) ^ pool.keys.term(y, x, value)
+	pool.current[y+r][x+r], pool.next[y+r][x+r] = value, value
+	pool.tiles.wake()
+}
+
+// stop ends the worker goroutines, waiting for every one of them to return.
+func (pool *stealingPool) stop() {
+	for _, w := range pool.workers {
+		close(w.start)
+	}
+	for range pool.workers {
+		<-pool.done
+	}
+}
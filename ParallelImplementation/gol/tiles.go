@@ -0,0 +1,108 @@
+package gol
+
+// activeTileSize is the side of the square tiles the world is divided into to track which parts of it are changing.
+// Tiles are made at least as wide as the neighbourhood radius, so only the tiles around a tile can reach into it.
+const activeTileSize = 8
+
+// tileGrid divides the world into square tiles and tracks which of them need to be recomputed each turn.
+// A cell can only change if a cell in its neighbourhood changed on the last turn, so a tile is active
+// when it, or any tile within reach of its cells, changed on the last turn. Every tile starts active.
+type tileGrid struct {
+	size, rows, columns int
+	neighbours          [][]int // the tiles holding a cell in the neighbourhood of any cell of each tile, including itself
+	active              []bool
+	changed             []bool // reused every turn to collect the tiles that changed
+}
+
+func newTileGrid(p Params, rule Rule) *tileGrid {
+	size := activeTileSize
+	if rule.Radius > size {
+		size = rule.Radius
+	}
+	g := &tileGrid{
+		size:    size,
+		rows:    (p.ImageHeight + size - 1) / size,
+		columns: (p.ImageWidth + size - 1) / size,
+	}
+	g.active = make([]bool, g.rows*g.columns)
+	g.changed = make([]bool, len(g.active))
+	g.neighbours = make([][]int, len(g.active))
+
+	//Find every tile that a cell within the radius of the tile lies in, through the topology of the world
+	seen := make([]int, len(g.active))
+	for t := range g.active {
+		g.active[t] = true
+		startY, endY, startX, endX := g.bounds(t, p)
+		for y := startY - rule.Radius; y < endY+rule.Radius; y++ {
+			for x := startX - rule.Radius; x < endX+rule.Radius; x++ {
+				cellY, cellX, ok := p.Topology.locate(y, x, p.ImageHeight, p.ImageWidth)
+				if !ok {
+					continue
+				}
+				n := g.tile(cellY, cellX)
+				if seen[n] != t+1 {
+					seen[n] = t + 1
+					g.neighbours[t] = append(g.neighbours[t], n)
+				}
+			}
+		}
+	}
+	return g
+}
+
+// tile returns the index of the tile holding cell (y, x).
+func (g *tileGrid) tile(y, x int) int {
+	return (y/g.size)*g.columns + x/g.size
+}
+
+// bounds returns the cells covered by tile t, which may be cut short by the bottom and right edges of the world.
+func (g *tileGrid) bounds(t int, p Params) (startY, endY, startX, endX int) {
+	startY, startX = (t/g.columns)*g.size, (t%g.columns)*g.size
+	endY, endX = startY+g.size, startX+g.size
+	if endY > p.ImageHeight {
+		endY = p.ImageHeight
+	}
+	if endX > p.ImageWidth {
+		endX = p.ImageWidth
+	}
+	return startY, endY, startX, endX
+}
+
+// update marks the tiles that must be recomputed on the next turn from the tiles that changed on the last one,
+// and returns how many tiles were skipped on the last one.
+func (g *tileGrid) update(changed []bool) int {
+	skipped := 0
+	for t := range g.active {
+		if !g.active[t] {
+			skipped++
+		}
+	}
+	for t, neighbours := range g.neighbours {
+		g.active[t] = false
+		for _, n := range neighbours {
+			if changed[n] {
+				g.active[t] = true
+				break
+			}
+		}
+	}
+	return skipped
+}
+
+// wake marks every tile to be recomputed on the next turn, for when cells have been changed between turns.
+func (g *tileGrid) wake() {
+	for t := range g.active {
+		g.active[t] = true
+	}
+}
+
+// clamp returns v moved into the range min to max.
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"io/ioutil"
 	"strconv"
-	"strings"
 	"testing"
 
 	"uk.ac.bris.cs/gameoflife/gol"
@@ -89,7 +88,7 @@ func readAliveCells(path string, width, height int) []util.Cell {
 	data, ioError := ioutil.ReadFile(path)
 	util.Check(ioError)
 
-	fields := strings.Fields(string(data))
+	fields, image := pgmFields(data)
 
 	if fields[0] != "P5" {
 		panic("Not a pgm file")
@@ -110,8 +109,6 @@ func readAliveCells(path string, width, height int) []util.Cell {
 		panic("Incorrect maxval/bit depth")
 	}
 
-	image := []byte(fields[4])
-
 	var cells []util.Cell
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
@@ -128,6 +125,28 @@ func readAliveCells(path string, width, height int) []util.Cell {
 	return cells
 }
 
-
-
-
+// pgmFields splits a binary PGM image into the four fields of its header, skipping any comments, and its pixels.
+func pgmFields(data []byte) ([]string, []byte) {
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+	}
+	var fields []string
+	i := 0
+	for len(fields) < 4 {
+		for isSpace(data[i]) {
+			i++
+		}
+		if data[i] == '#' {
+			for data[i] != '\n' {
+				i++
+			}
+			continue
+		}
+		start := i
+		for !isSpace(data[i]) {
+			i++
+		}
+		fields = append(fields, string(data[start:i]))
+	}
+	return fields, data[i+1:]
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestHashLife checks HashLife against the golden images, and that the CellsFlipped events sent
+// between its jumps rebuild the same board as the one reported by FinalTurnComplete.
+func TestHashLife(t *testing.T) {
+	for _, size := range []int{16, 64, 512} {
+		for _, turns := range []int{0, 1, 100} {
+			p := gol.Params{ImageWidth: size, ImageHeight: size, Turns: turns, Threads: 1, HashLife: true}
+			expectedAlive := readAliveCells(fmt.Sprintf("check/images/%vx%vx%v.pgm", size, size, turns), size, size)
+			t.Run(fmt.Sprintf("%dx%dx%d", p.ImageWidth, p.ImageHeight, p.Turns), func(t *testing.T) {
+				board := make([][]bool, p.ImageHeight)
+				for y := range board {
+					board[y] = make([]bool, p.ImageWidth)
+				}
+				events := make(chan gol.Event)
+				go gol.Run(p, events, nil)
+				var cells []util.Cell
+				for event := range events {
+					switch e := event.(type) {
+					case gol.CellsFlipped:
+						for _, cell := range e.Cells {
+							board[cell.Y][cell.X] = !board[cell.Y][cell.X]
+						}
+					case gol.FinalTurnComplete:
+						cells = e.Alive
+					}
+				}
+				assertEqualBoard(t, cells, expectedAlive, p)
+				var flipped []util.Cell
+				for y := range board {
+					for x := range board[y] {
+						if board[y][x] {
+							flipped = append(flipped, util.Cell{X: x, Y: y})
+						}
+					}
+				}
+				assertEqualBoard(t, flipped, expectedAlive, p)
+			})
+		}
+	}
+
+	//Turns that are not a power of two take several jumps, which must agree with the packed engine
+	for _, rulestring := range []string{"B3/S23", "B36/S23"} {
+		p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 1000, Threads: 4, Rule: rulestring, Packed: true}
+		expectedAlive := runFinal(p)
+		p.Packed, p.HashLife = false, true
+		t.Run(fmt.Sprintf("%v-%dx%dx%d", rulestring, p.ImageWidth, p.ImageHeight, p.Turns), func(t *testing.T) {
+			assertEqualBoard(t, runFinal(p), expectedAlive, p)
+		})
+	}
+}
+
+// TestHashLifeLongRun runs the 512x512 image for the default 10 billion turns of main.go. Once it has settled
+// the image alternates between 5565 alive cells on even turns and 5567 on odd turns (see TestAlive).
+func TestHashLifeLongRun(t *testing.T) {
+	p := gol.Params{ImageWidth: 512, ImageHeight: 512, Turns: 10000000000, Threads: 1, HashLife: true}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	for event := range events {
+		switch e := event.(type) {
+		case gol.FinalTurnComplete:
+			if e.CompletedTurns != p.Turns {
+				t.Errorf("FinalTurnComplete reported %d turns, expected %d", e.CompletedTurns, p.Turns)
+			}
+			if len(e.Alive) != 5565 {
+				t.Errorf("expected 5565 alive cells after %d turns, got %d", p.Turns, len(e.Alive))
+			}
+		}
+	}
+}
+
+// TestHashLifeCollect runs HashLife with room for so few nodes that the universe is collected after every jump,
+// checking that the world still moves on as the packed engine does, and as HashLife does without collecting.
+func TestHashLifeCollect(t *testing.T) {
+	for _, size := range []int{64, 512} {
+		p := gol.Params{ImageWidth: size, ImageHeight: size, Turns: 1000, Threads: 4, Packed: true}
+		expectedAlive := runFinal(p)
+		p.Packed, p.HashLife, p.Threads = false, true, 1
+		t.Run(fmt.Sprintf("%dx%dx%d", p.ImageWidth, p.ImageHeight, p.Turns), func(t *testing.T) {
+			assertEqualBoard(t, runFinal(p), expectedAlive, p)
+			p.HashLifeNodes = 1000
+			assertEqualBoard(t, runFinal(p), expectedAlive, p)
+		})
+	}
+}
+
+// TestMacrocell checks that the Macrocell file written by HashLife loads back into the same world,
+// and that a glider written by hand in Golly's format comes back to where it started after 64 turns on a 16x16 torus.
+func TestMacrocell(t *testing.T) {
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Threads: 1, HashLife: true}
+	runFinal(p)
+	p.Turns, p.Macrocell = 0, "out/64x64x100.mc"
+	assertEqualBoard(t, runFinal(p), readAliveCells("check/images/64x64x100.pgm", 64, 64), p)
+
+	glider := filepath.Join(t.TempDir(), "glider.mc")
+	err := os.WriteFile(glider, []byte("[M2] (golly 4.2)\n#R B3/S23\n.*$..*$***$\n4 1 0 0 0\n"), 0644)
+	util.Check(err)
+	p = gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 64, Threads: 1, HashLife: true, Macrocell: glider}
+	expected := []util.Cell{{X: 1, Y: 0}, {X: 2, Y: 1}, {X: 0, Y: 2}, {X: 1, Y: 2}, {X: 2, Y: 2}}
+	assertEqualBoard(t, runFinal(p), expected, p)
+}
+
+// TestHashLifeRejected checks that worlds HashLife cannot run are refused before the first turn.
+func TestHashLifeRejected(t *testing.T) {
+	tests := []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16, HashLife: true, Rule: "B2/S/C3"},
+		{ImageWidth: 16, ImageHeight: 16, HashLife: true, Rule: "R2,C0,M0,S3..5,B4..5,NN"},
+		{ImageWidth: 16, ImageHeight: 16, HashLife: true, Topology: gol.Plane},
+		{ImageWidth: 16, ImageHeight: 16, HashLife: true, Packed: true},
+		{ImageWidth: 16, ImageHeight: 16, Macrocell: "out/16x16x0.mc"},
+		{ImageWidth: 16, ImageHeight: 16, HashLife: true, FastForward: true},
+		{ImageWidth: 16, ImageHeight: 16, HashLife: true, HashLifeNodes: -1},
+	}
+	for _, p := range tests {
+		p.Turns, p.Threads = 1, 1
+		events := make(chan gol.Event)
+		if err := gol.Run(p, events, nil); err == nil {
+			t.Errorf("gol.Run accepted %+v", p)
+		}
+	}
+}
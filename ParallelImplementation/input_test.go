@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// writeSoup writes a binary PGM image of the given size with roughly a third of its cells alive,
+// chosen by a fixed linear congruential generator so that every run sees the same world.
+func writeSoup(path string, width, height int) {
+	file, err := os.Create(path)
+	util.Check(err)
+	defer file.Close()
+	_, err = fmt.Fprintf(file, "P5\n%d %d\n255\n", width, height)
+	util.Check(err)
+	state := uint32(width*height + 1)
+	pixels := make([]byte, width*height)
+	for i := range pixels {
+		state = state*1664525 + 1013904223
+		if state>>30 == 0 {
+			pixels[i] = 255
+		}
+	}
+	_, err = file.Write(pixels)
+	util.Check(err)
+}
+
+// TestInputImage runs each engine on non-square worlds whose sides are not powers of two, loaded from an explicit path
+// with the size read from the image header, and checks the final board against the reference implementation.
+func TestInputImage(t *testing.T) {
+	engines := []gol.Params{
+		{Threads: 4},
+		{Threads: 16},
+		{Threads: 6, TileWidth: gol.AutoTiles, TileHeight: gol.AutoTiles},
+		{Threads: 4, WorkStealing: true},
+		{Threads: 4, Packed: true},
+	}
+	rule, err := gol.ParseRule(gol.DefaultRule)
+	util.Check(err)
+	for _, size := range [][2]int{{37, 23}, {100, 7}, {5, 61}, {130, 3}} {
+		path := filepath.Join(t.TempDir(), fmt.Sprintf("soup-%dx%d.pgm", size[0], size[1]))
+		writeSoup(path, size[0], size[1])
+		expectedAlive := referenceRun(path, rule, gol.Params{ImageWidth: size[0], ImageHeight: size[1], Turns: 50})
+		for _, p := range engines {
+			p.Input, p.Turns = path, 50
+			t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", engineName(p), size[0], size[1], p.Turns, p.Threads), func(t *testing.T) {
+				events := make(chan gol.Event)
+				go func() {
+					if err := gol.Run(p, events, nil); err != nil {
+						t.Error(err)
+					}
+				}()
+				for event := range events {
+					if e, ok := event.(gol.FinalTurnComplete); ok {
+						p.ImageWidth, p.ImageHeight = size[0], size[1]
+						assertEqualBoard(t, e.Alive, expectedAlive, p)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestInputImageRejected checks that a size given alongside an input image must agree with its header,
+// and that missing or malformed images are rejected before the first turn.
+func TestInputImageRejected(t *testing.T) {
+	dir := t.TempDir()
+	soup := filepath.Join(dir, "soup.pgm")
+	writeSoup(soup, 20, 10)
+	text := filepath.Join(dir, "text.pgm")
+	util.Check(os.WriteFile(text, []byte("not an image\n"), 0644))
+
+	tests := []gol.Params{
+		{Input: soup, ImageWidth: 10, ImageHeight: 20},
+		{Input: soup, ImageHeight: 20},
+		{Input: filepath.Join(dir, "missing.pgm")},
+		{Input: text},
+		{},
+	}
+	for _, p := range tests {
+		p.Turns, p.Threads = 1, 1
+		events := make(chan gol.Event)
+		if err := gol.Run(p, events, nil); err == nil {
+			t.Errorf("expected %+v to be rejected", p)
+		}
+		if _, ok := <-events; ok {
+			t.Errorf("expected events to be closed")
+		}
+	}
+
+	//A size that agrees with the header is accepted
+	p := gol.Params{Input: soup, ImageWidth: 20, Turns: 1, Threads: 1}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	for event := range events {
+		if e, ok := event.(gol.FinalTurnComplete); ok && e.CompletedTurns != 1 {
+			t.Errorf("expected 1 completed turn, got %d", e.CompletedTurns)
+		}
+	}
+}
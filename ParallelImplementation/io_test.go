@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestIOErrorRead checks that a missing image is reported as an IOError event, rather than a panic,
+// and that gol.Run returns it without running any turns.
+func TestIOErrorRead(t *testing.T) {
+	p := gol.Params{ImageWidth: 30, ImageHeight: 30, Turns: 1, Threads: 2}
+	events := make(chan gol.Event)
+	result := make(chan error)
+	go func() {
+		result <- gol.Run(p, events, nil)
+	}()
+
+	var reported []gol.IOError
+	for event := range events {
+		switch e := event.(type) {
+		case gol.IOError:
+			reported = append(reported, e)
+		default:
+			t.Errorf("unexpected event %T received for a missing image", event)
+		}
+	}
+	if len(reported) != 1 || reported[0].Operation != "read image" || reported[0].Filename != "images/30x30.pgm" {
+		t.Fatalf("expected one IOError reading images/30x30.pgm, got %v", reported)
+	}
+	err := <-result
+	if ioError, ok := err.(gol.IOError); !ok || ioError.Operation != "read image" || ioError.CompletedTurns != 0 {
+		t.Errorf("expected gol.Run to return the IOError, got %v", err)
+	}
+}
+
+// TestIOErrorWrite checks that outputs that cannot be written are each reported once as an IOError event,
+// while the run carries on to the final turn, and that gol.Run returns the first of them.
+func TestIOErrorWrite(t *testing.T) {
+	//Directories in the way of the output files make them impossible to create, even as root
+	_ = os.Mkdir("out", os.ModePerm)
+	blocked := []string{"out/16x16x3.pgm", "out/16x16x3-alive.csv", "out/16x16x3-census.csv"}
+	for _, path := range blocked {
+		util.Check(os.RemoveAll(path))
+		util.Check(os.MkdirAll(path, os.ModePerm))
+		defer os.RemoveAll(path)
+	}
+
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 3, Threads: 2, PopulationCSV: true}
+	events := make(chan gol.Event)
+	result := make(chan error)
+	go func() {
+		result <- gol.Run(p, events, nil)
+	}()
+
+	operations := make(map[string]int)
+	final := -1
+	for event := range events {
+		switch e := event.(type) {
+		case gol.IOError:
+			operations[e.Operation]++
+			//The population CSV fails on its first row, and every other output once the run is over
+			expected := p.Turns
+			if e.Operation == "write statistics" {
+				expected = 1
+			}
+			if e.CompletedTurns != expected {
+				t.Errorf("expected %v to report %d completed turns, got %d", e, expected, e.CompletedTurns)
+			}
+		case gol.FinalTurnComplete:
+			final = e.CompletedTurns
+		}
+	}
+	if final != p.Turns {
+		t.Errorf("expected the run to finish after %d turns, got %d", p.Turns, final)
+	}
+	for _, operation := range []string{"write image", "write statistics", "write census"} {
+		if operations[operation] != 1 {
+			t.Errorf("expected one %q IOError, got %d", operation, operations[operation])
+		}
+	}
+	if _, ok := (<-result).(gol.IOError); !ok {
+		t.Error("expected gol.Run to return an IOError")
+	}
+}
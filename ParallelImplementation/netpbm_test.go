@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// encodeNetpbm encodes a world, given as whether each cell is alive, in one of the PBM or PGM encodings,
+// with comments in the header. Greymaps use the given maxval and values for alive and dead pixels.
+func encodeNetpbm(magic string, width, height int, alive []bool, maxval, on, off int) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s\n# A comment\n%d # width\n%d\n", magic, width, height)
+	if magic == "P2" || magic == "P5" {
+		fmt.Fprintf(&b, "#maxval next\n%d\n", maxval)
+	}
+	for y := 0; y < height; y++ {
+		row := alive[y*width : (y+1)*width]
+		switch magic {
+		case "P1":
+			//Plain bitmaps may leave out the whitespace between pixels
+			for _, a := range row {
+				if a {
+					b.WriteString("1")
+				} else {
+					b.WriteString("0")
+				}
+			}
+			b.WriteString("\n")
+		case "P4":
+			packed := make([]byte, (width+7)/8)
+			for x, a := range row {
+				if a {
+					packed[x/8] |= 0x80 >> uint(x%8)
+				}
+			}
+			b.Write(packed)
+		case "P2":
+			for _, a := range row {
+				if a {
+					fmt.Fprintf(&b, "%d ", on)
+				} else {
+					fmt.Fprintf(&b, "%d ", off)
+				}
+			}
+			b.WriteString("\n")
+		case "P5":
+			for _, a := range row {
+				v := off
+				if a {
+					v = on
+				}
+				if maxval > 255 {
+					b.WriteByte(byte(v >> 8))
+				}
+				b.WriteByte(byte(v))
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+// TestNetpbm loads the same world from plain and raw bitmaps and greymaps, with comments in their headers, 16-bit
+// pixels and a width that is not a whole number of bytes, and checks the runs against the reference implementation.
+func TestNetpbm(t *testing.T) {
+	dir := t.TempDir()
+	width, height := 13, 11
+	soup := filepath.Join(dir, "soup.pgm")
+	writeSoup(soup, width, height)
+	alive := make([]bool, width*height)
+	for _, cell := range readAliveCells(soup, width, height) {
+		alive[cell.Y*width+cell.X] = true
+	}
+	rule, _ := gol.ParseRule(gol.DefaultRule)
+	expected := referenceRun(soup, rule, gol.Params{ImageWidth: width, ImageHeight: height, Turns: 10})
+
+	tests := []struct {
+		magic           string
+		maxval, on, off int
+	}{
+		{"P1", 1, 1, 0},
+		{"P4", 1, 1, 0},
+		{"P2", 7, 7, 0},
+		{"P5", 255, 255, 0},
+		{"P5", 1000, 900, 20},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("%v-%d.pnm", test.magic, test.maxval))
+		util.Check(os.WriteFile(path, encodeNetpbm(test.magic, width, height, alive, test.maxval, test.on, test.off), 0644))
+		p := gol.Params{Input: path, Turns: 10, Threads: 2}
+		t.Run(fmt.Sprintf("%v-%d", test.magic, test.maxval), func(t *testing.T) {
+			assertEqualBoard(t, runFinal(p), expected, gol.Params{ImageWidth: width, ImageHeight: height})
+		})
+	}
+}
+
+// TestAliveThreshold checks that pixels at least the threshold fraction of the maxval start alive, and that without
+// a threshold the same pixels are snapped to the nearest state instead.
+func TestAliveThreshold(t *testing.T) {
+	width, height := 8, 8
+	block := make([]bool, width*height)
+	for _, i := range []int{2*8 + 2, 2*8 + 3, 3*8 + 2, 3*8 + 3} {
+		block[i] = true
+	}
+	path := filepath.Join(t.TempDir(), "dim.pgm")
+	util.Check(os.WriteFile(path, encodeNetpbm("P2", width, height, block, 100, 45, 20), 0644))
+
+	cells := runFinal(gol.Params{Input: path, Turns: 0, Threads: 1, AliveThreshold: 0.4})
+	expected := []util.Cell{{X: 2, Y: 2}, {X: 3, Y: 2}, {X: 2, Y: 3}, {X: 3, Y: 3}}
+	assertEqualBoard(t, cells, expected, gol.Params{ImageWidth: width, ImageHeight: height})
+
+	//45% of the maxval is closer to dead than alive
+	cells = runFinal(gol.Params{Input: path, Turns: 0, Threads: 1})
+	assertEqualBoard(t, cells, nil, gol.Params{ImageWidth: width, ImageHeight: height})
+
+	for _, threshold := range []float64{-0.5, 1.5} {
+		p := gol.Params{Input: path, Turns: 0, Threads: 1, AliveThreshold: threshold}
+		if err := gol.Run(p, make(chan gol.Event), nil); err == nil {
+			t.Errorf("expected threshold %v to be rejected", threshold)
+		}
+	}
+}
+
+// TestMultipleImages starts from each image of a file holding three of different sizes and encodings.
+func TestMultipleImages(t *testing.T) {
+	blinker := make([]bool, 5*5)
+	blinker[2*5+1], blinker[2*5+2], blinker[2*5+3] = true, true, true
+	glider := make([]bool, 6*4)
+	glider[0*6+1], glider[1*6+2], glider[2*6+0], glider[2*6+1], glider[2*6+2] = true, true, true, true, true
+
+	var file []byte
+	file = append(file, encodeNetpbm("P1", 5, 5, blinker, 1, 1, 0)...)
+	file = append(file, encodeNetpbm("P5", 6, 4, glider, 255, 255, 0)...)
+	file = append(file, encodeNetpbm("P4", 5, 5, blinker, 1, 1, 0)...)
+	file = append(file, "\n\n"...)
+	path := filepath.Join(t.TempDir(), "three.pnm")
+	util.Check(os.WriteFile(path, file, 0644))
+
+	tests := []struct {
+		width, height int
+		alive         []util.Cell
+	}{
+		{5, 5, []util.Cell{{X: 1, Y: 2}, {X: 2, Y: 2}, {X: 3, Y: 2}}},
+		{6, 4, []util.Cell{{X: 1, Y: 0}, {X: 2, Y: 1}, {X: 0, Y: 2}, {X: 1, Y: 2}, {X: 2, Y: 2}}},
+		{5, 5, []util.Cell{{X: 1, Y: 2}, {X: 2, Y: 2}, {X: 3, Y: 2}}},
+	}
+	for index, test := range tests {
+		width, height, err := gol.ImageSize(path, index)
+		if err != nil || width != test.width || height != test.height {
+			t.Errorf("image %d: expected size %dx%d, got %dx%d (%v)", index, test.width, test.height, width, height, err)
+		}
+		cells := runFinal(gol.Params{Input: path, ImageIndex: index, Turns: 0, Threads: 1})
+		assertEqualBoard(t, cells, test.alive, gol.Params{ImageWidth: test.width, ImageHeight: test.height})
+	}
+
+	p := gol.Params{Input: path, ImageIndex: 3, Turns: 0, Threads: 1}
+	if err := gol.Run(p, make(chan gol.Event), nil); err == nil {
+		t.Errorf("expected image 3 of 3 to be rejected")
+	}
+}
+
+// TestPgmMetadata checks that the turn and rule are recorded in comments in the header of the final image.
+func TestPgmMetadata(t *testing.T) {
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 7, Threads: 2, Rule: "B36/S23"}
+	runFinal(p)
+	data, err := os.ReadFile("out/16x16x7.pgm")
+	util.Check(err)
+	header := string(data[:bytes.Index(data, []byte("255\n"))])
+	for _, comment := range []string{"# Turn 7\n", "# Rule B36/S23\n"} {
+		if !strings.Contains(header, comment) {
+			t.Errorf("expected %q in the header %q", comment, header)
+		}
+	}
+}
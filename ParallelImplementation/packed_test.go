@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestPacked checks that the bit-packed world gives the same boards as the byte-per-cell world:
+// the golden images for 16x16, 64x64 and 512x512 on 0, 1 and 100 turns, the glider in every topology,
+// and HighLife and Seeds against the reference evolution.
+func TestPacked(t *testing.T) {
+	for _, size := range []int{16, 64, 512} {
+		for _, turns := range []int{0, 1, 100} {
+			p := gol.Params{ImageWidth: size, ImageHeight: size, Turns: turns, Packed: true}
+			expectedAlive := readAliveCells(fmt.Sprintf("check/images/%vx%vx%v.pgm", size, size, turns), size, size)
+			for _, threads := range []int{1, 2, 3, 8, 16} {
+				p.Threads = threads
+				t.Run(fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+					assertEqualBoard(t, runFinal(p), expectedAlive, p)
+				})
+			}
+		}
+	}
+
+	for topology := gol.Torus; topology <= gol.CrossSurface; topology++ {
+		for _, turns := range []int{40, 100} {
+			p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: turns, Topology: topology, Packed: true}
+			expectedAlive := readAliveCells(fmt.Sprintf("check/topology/%v/16x16x%d.pgm", topology, turns), 16, 16)
+			for _, threads := range []int{1, 5} {
+				p.Threads = threads
+				t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", p.Topology, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+					assertEqualBoard(t, runFinal(p), expectedAlive, p)
+				})
+			}
+		}
+	}
+
+	for _, rulestring := range []string{"B36/S23", "B2/S"} {
+		rule, err := gol.ParseRule(rulestring)
+		util.Check(err)
+		p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 10, Rule: rulestring, Packed: true}
+		expectedAlive := referenceRun("images/64x64.pgm", rule, p)
+		for _, threads := range []int{1, 8} {
+			p.Threads = threads
+			t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", rule, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+				assertEqualBoard(t, runFinal(p), expectedAlive, p)
+			})
+		}
+	}
+}
+
+// TestPackedRejected checks that rules which cannot be packed are refused before the first turn.
+func TestPackedRejected(t *testing.T) {
+	for _, rulestring := range []string{"B2/S/C3", "R2,C0,M0,S3..5,B4..5,NN"} {
+		p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 1, Threads: 1, Rule: rulestring, Packed: true}
+		events := make(chan gol.Event)
+		if err := gol.Run(p, events, nil); err == nil {
+			t.Errorf("gol.Run accepted the rule %v on a packed world", rulestring)
+		}
+	}
+}
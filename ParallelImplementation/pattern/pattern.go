@@ -0,0 +1,368 @@
+// Package pattern reads and writes the text formats patterns are shared in on LifeWiki and by Golly:
+// run length encoded (RLE) files, plaintext (.cells) files and Life 1.06 files.
+package pattern
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Format is one of the text formats a pattern can be stored in.
+type Format int
+
+const (
+	RLE Format = iota
+	Plaintext
+	Life106
+)
+
+func (format Format) String() string {
+	switch format {
+	case RLE:
+		return "rle"
+	case Plaintext:
+		return "cells"
+	case Life106:
+		return "lif"
+	}
+	return fmt.Sprintf("Format(%d)", int(format))
+}
+
+// Extension returns the file extension of the format, including the dot.
+func (format Format) Extension() string {
+	return "." + format.String()
+}
+
+// ParseFormat parses the name of a format as printed by String: rle, cells or lif.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "rle":
+		return RLE, nil
+	case "cells":
+		return Plaintext, nil
+	case "lif", "life":
+		return Life106, nil
+	}
+	return 0, fmt.Errorf("unknown pattern format %q: expected rle, cells or lif", name)
+}
+
+// FormatOf returns the format of the pattern file at path from its extension.
+func FormatOf(path string) (Format, error) {
+	return ParseFormat(filepath.Ext(path))
+}
+
+// Pattern is a set of alive cells within a rectangle, given as offsets from its top left corner.
+type Pattern struct {
+	Width, Height int
+	Cells         []util.Cell
+	Rule          string   // The rule the pattern was written for, if the file says. Only RLE files can.
+	Comments      []string // Lines of comments, without the characters that mark them as comments.
+}
+
+// Read reads a pattern in the given format.
+// Cells of multi-state RLE patterns are alive whatever their state, and Life 1.06 patterns are moved so that their
+// leftmost and topmost cells are on the edges of the rectangle.
+func Read(r io.Reader, format Format) (Pattern, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<24)
+	var pattern Pattern
+	var err error
+	switch format {
+	case RLE:
+		err = readRLE(scanner, &pattern)
+	case Plaintext:
+		err = readPlaintext(scanner, &pattern)
+	case Life106:
+		err = readLife106(scanner, &pattern)
+	default:
+		err = fmt.Errorf("unknown pattern format %v", format)
+	}
+	if err == nil {
+		err = scanner.Err()
+	}
+	return pattern, err
+}
+
+// fit grows the rectangle of the pattern to hold all of its cells.
+func (pattern *Pattern) fit() {
+	for _, cell := range pattern.Cells {
+		if cell.X >= pattern.Width {
+			pattern.Width = cell.X + 1
+		}
+		if cell.Y >= pattern.Height {
+			pattern.Height = cell.Y + 1
+		}
+	}
+}
+
+func readRLE(scanner *bufio.Scanner, pattern *Pattern) error {
+	header := false
+	x, y, count := 0, 0, 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line[0] == '#' {
+			//#C and #c lines are comments, and #N the name of the pattern. Other lines, such as the #O author,
+			//are kept as they are
+			comment := line
+			if len(line) > 1 && (line[1] == 'C' || line[1] == 'c' || line[1] == 'N') {
+				comment = strings.TrimSpace(line[2:])
+			}
+			pattern.Comments = append(pattern.Comments, comment)
+			continue
+		}
+		if !header {
+			header = true
+			if err := parseRLEHeader(line, pattern); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, char := range line {
+			switch {
+			case char >= '0' && char <= '9':
+				count = count*10 + int(char-'0')
+				continue
+			case char == ' ' || char == '\t':
+				continue
+			case char >= 'p' && char <= 'y':
+				//The first letter of the higher states of multi-state rules, such as pA for state 25
+				continue
+			case char == '!':
+				pattern.fit()
+				return nil
+			}
+			run := count
+			if run == 0 {
+				run = 1
+			}
+			count = 0
+			switch {
+			case char == '$':
+				y += run
+				x = 0
+			case char == 'b' || char == '.':
+				x += run
+			case char == 'o' || (char >= 'A' && char <= 'X'):
+				for i := 0; i < run; i++ {
+					pattern.Cells = append(pattern.Cells, util.Cell{X: x + i, Y: y})
+				}
+				x += run
+			default:
+				return fmt.Errorf("unexpected %q in RLE pattern", char)
+			}
+		}
+	}
+	if !header {
+		return fmt.Errorf("RLE pattern has no header line")
+	}
+	pattern.fit()
+	return nil
+}
+
+// parseRLEHeader reads the size and rule from a header line such as "x = 3, y = 3, rule = B3/S23".
+// Golly adds the topology of the world to the rule after a colon, e.g. "B3/S23:T16,16", which is left off.
+func parseRLEHeader(line string, pattern *Pattern) error {
+	rule := false
+	for _, field := range strings.Split(line, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			if rule {
+				//The rest of the topology following the rule
+				continue
+			}
+			return fmt.Errorf("invalid RLE header %q", line)
+		}
+		rule = false
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch key {
+		case "x":
+			if _, err := fmt.Sscan(value, &pattern.Width); err != nil || pattern.Width < 0 {
+				return fmt.Errorf("invalid RLE width %q", value)
+			}
+		case "y":
+			if _, err := fmt.Sscan(value, &pattern.Height); err != nil || pattern.Height < 0 {
+				return fmt.Errorf("invalid RLE height %q", value)
+			}
+		case "rule":
+			pattern.Rule = strings.SplitN(value, ":", 2)[0]
+			rule = true
+		}
+	}
+	return nil
+}
+
+func readPlaintext(scanner *bufio.Scanner, pattern *Pattern) error {
+	y := 0
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.HasPrefix(line, "!") {
+			pattern.Comments = append(pattern.Comments, strings.TrimSpace(line[1:]))
+			continue
+		}
+		for x, char := range []byte(line) {
+			switch char {
+			case 'O', 'o', '*':
+				pattern.Cells = append(pattern.Cells, util.Cell{X: x, Y: y})
+			case '.':
+			default:
+				return fmt.Errorf("unexpected %q on line %d of plaintext pattern", char, y+1)
+			}
+		}
+		if len(line) > pattern.Width {
+			pattern.Width = len(line)
+		}
+		y++
+	}
+	pattern.Height = y
+	return nil
+}
+
+func readLife106(scanner *bufio.Scanner, pattern *Pattern) error {
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "#Life 1.06" {
+		return fmt.Errorf("Life 1.06 pattern does not start with #Life 1.06")
+	}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line[0] == '#' {
+			pattern.Comments = append(pattern.Comments, strings.TrimSpace(strings.TrimPrefix(line[1:], "D")))
+			continue
+		}
+		var cell util.Cell
+		if _, err := fmt.Sscan(line, &cell.X, &cell.Y); err != nil {
+			return fmt.Errorf("invalid Life 1.06 cell %q", line)
+		}
+		pattern.Cells = append(pattern.Cells, cell)
+	}
+	if len(pattern.Cells) == 0 {
+		return nil
+	}
+
+	//Cells can be anywhere, including at negative coordinates, so move them all into the rectangle
+	left, top := pattern.Cells[0].X, pattern.Cells[0].Y
+	for _, cell := range pattern.Cells {
+		if cell.X < left {
+			left = cell.X
+		}
+		if cell.Y < top {
+			top = cell.Y
+		}
+	}
+	for i := range pattern.Cells {
+		pattern.Cells[i].X -= left
+		pattern.Cells[i].Y -= top
+	}
+	pattern.fit()
+	return nil
+}
+
+// Write writes a pattern in the given format. RLE lines are kept to 70 characters, as other programs expect.
+// Life 1.06 files only hold the cells and comments, so the size of the rectangle and the rule are lost.
+func Write(w io.Writer, format Format, pattern Pattern) error {
+	writer := bufio.NewWriter(w)
+	cells := sortedCells(pattern.Cells)
+	switch format {
+	case RLE:
+		writeRLE(writer, pattern, cells)
+	case Plaintext:
+		writePlaintext(writer, pattern, cells)
+	case Life106:
+		_, _ = writer.WriteString("#Life 1.06\n")
+		for _, comment := range pattern.Comments {
+			_, _ = fmt.Fprintf(writer, "#D %s\n", comment)
+		}
+		for _, cell := range cells {
+			_, _ = fmt.Fprintf(writer, "%d %d\n", cell.X, cell.Y)
+		}
+	default:
+		return fmt.Errorf("unknown pattern format %v", format)
+	}
+	return writer.Flush()
+}
+
+// sortedCells returns a copy of cells in the order they are read, row by row and left to right.
+func sortedCells(cells []util.Cell) []util.Cell {
+	sorted := append([]util.Cell(nil), cells...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Y != sorted[j].Y {
+			return sorted[i].Y < sorted[j].Y
+		}
+		return sorted[i].X < sorted[j].X
+	})
+	return sorted
+}
+
+func writeRLE(writer *bufio.Writer, pattern Pattern, cells []util.Cell) {
+	for _, comment := range pattern.Comments {
+		_, _ = fmt.Fprintf(writer, "#C %s\n", comment)
+	}
+	_, _ = fmt.Fprintf(writer, "x = %d, y = %d", pattern.Width, pattern.Height)
+	if pattern.Rule != "" {
+		_, _ = fmt.Fprintf(writer, ", rule = %s", pattern.Rule)
+	}
+	_, _ = writer.WriteString("\n")
+
+	//Runs of dead cells at the end of a row, and of empty rows at the end of the pattern, are left out
+	line := 0
+	item := func(run int, tag byte) {
+		s := string(tag)
+		if run > 1 {
+			s = fmt.Sprint(run) + s
+		}
+		if line+len(s) > 70 {
+			_, _ = writer.WriteString("\n")
+			line = 0
+		}
+		_, _ = writer.WriteString(s)
+		line += len(s)
+	}
+	x, y := 0, 0
+	for i := 0; i < len(cells); {
+		cell := cells[i]
+		if cell.Y > y {
+			item(cell.Y-y, '$')
+			x, y = 0, cell.Y
+		}
+		if cell.X > x {
+			item(cell.X-x, 'b')
+		}
+		run := 1
+		for i+run < len(cells) && cells[i+run] == (util.Cell{X: cell.X + run, Y: cell.Y}) {
+			run++
+		}
+		item(run, 'o')
+		x = cell.X + run
+		i += run
+	}
+	item(1, '!')
+	_, _ = writer.WriteString("\n")
+}
+
+func writePlaintext(writer *bufio.Writer, pattern Pattern, cells []util.Cell) {
+	for _, comment := range pattern.Comments {
+		_, _ = fmt.Fprintf(writer, "!%s\n", comment)
+	}
+	row := make([]byte, pattern.Width)
+	i := 0
+	for y := 0; y < pattern.Height; y++ {
+		for x := range row {
+			row[x] = '.'
+		}
+		for ; i < len(cells) && cells[i].Y == y; i++ {
+			row[cells[i].X] = 'O'
+		}
+		_, _ = writer.Write(row)
+		_, _ = writer.WriteString("\n")
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/pattern"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// gosperGun is the Gosper glider gun as given on LifeWiki.
+const gosperGun = `#N Gosper glider gun
+#C This was the first gun discovered.
+#C As its name suggests, it was discovered by Bill Gosper.
+x = 36, y = 9, rule = B3/S23
+24bo$22bobo$12b2o6b2o12b2o$11bo3bo4b2o12b2o$2o8bo5bo3b2o$2o8bo3bob2o4b
+obo$10bo5bo7bo$11bo3bo$12b2o!
+`
+
+// TestPatternFormats reads a glider written in each format, with comments, and checks they agree.
+func TestPatternFormats(t *testing.T) {
+	glider := []util.Cell{{X: 1, Y: 0}, {X: 2, Y: 1}, {X: 0, Y: 2}, {X: 1, Y: 2}, {X: 2, Y: 2}}
+	tests := []struct {
+		format   pattern.Format
+		text     string
+		rule     string
+		comments []string
+	}{
+		{pattern.RLE, "#N Glider\n#C A comment\nx = 3, y = 3, rule = B3/S23:T16,16\nbo$2bo$3o!\n", "B3/S23", []string{"Glider", "A comment"}},
+		{pattern.RLE, "x=3,y=3\n  b o $ 2b\no$\n\n3o !\n", "", nil},
+		{pattern.Plaintext, "!Name: Glider\n!\n.O\n..O\nOOO\n", "", []string{"Name: Glider", ""}},
+		{pattern.Life106, "#Life 1.06\n#D A comment\n0 -1\n1 0\n-1 1\n0 1\n1 1\n", "", []string{"A comment"}},
+	}
+	for _, test := range tests {
+		t.Run(test.format.String(), func(t *testing.T) {
+			given, err := pattern.Read(strings.NewReader(test.text), test.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if given.Width != 3 || given.Height != 3 {
+				t.Errorf("expected a 3x3 pattern, got %dx%d", given.Width, given.Height)
+			}
+			if given.Rule != test.rule {
+				t.Errorf("expected rule %q, got %q", test.rule, given.Rule)
+			}
+			if fmt.Sprint(given.Comments) != fmt.Sprint(test.comments) {
+				t.Errorf("expected comments %q, got %q", test.comments, given.Comments)
+			}
+			assertEqualBoard(t, given.Cells, glider, gol.Params{ImageWidth: 3, ImageHeight: 3})
+		})
+	}
+
+	for _, text := range []string{"bo$2bo$3o!\n", "x = 3, y = 3\nbo$2bz$3o!\n"} {
+		if _, err := pattern.Read(strings.NewReader(text), pattern.RLE); err == nil {
+			t.Errorf("expected %q to be rejected", text)
+		}
+	}
+}
+
+// TestPatternRoundTrip writes the 64x64 and 512x512 images in each format and checks that they are read back the same.
+func TestPatternRoundTrip(t *testing.T) {
+	for _, size := range []int{64, 512} {
+		alive := readAliveCells(fmt.Sprintf("images/%dx%d.pgm", size, size), size, size)
+		original := pattern.Pattern{Width: size, Height: size, Cells: alive, Rule: "B3/S23", Comments: []string{"Turn 0"}}
+		for _, format := range []pattern.Format{pattern.RLE, pattern.Plaintext, pattern.Life106} {
+			t.Run(fmt.Sprintf("%v-%dx%d", format, size, size), func(t *testing.T) {
+				var buffer bytes.Buffer
+				util.Check(pattern.Write(&buffer, format, original))
+				if format == pattern.RLE {
+					for _, line := range strings.Split(buffer.String(), "\n") {
+						if len(line) > 70 {
+							t.Fatalf("RLE line longer than 70 characters: %q", line)
+						}
+					}
+				}
+				given, err := pattern.Read(&buffer, format)
+				if err != nil {
+					t.Fatal(err)
+				}
+				expected := alive
+				if format == pattern.Life106 {
+					//Only the cells are kept, so the pattern starts at its leftmost and topmost cells
+					expected = normalise(alive)
+				} else if given.Width != size || given.Height != size {
+					t.Errorf("expected a %dx%d pattern, got %dx%d", size, size, given.Width, given.Height)
+				}
+				if format == pattern.RLE && given.Rule != original.Rule {
+					t.Errorf("expected rule %v, got %v", original.Rule, given.Rule)
+				}
+				if format != pattern.Life106 && len(given.Comments) == 0 {
+					t.Errorf("comments were lost")
+				}
+				assertEqualBoard(t, given.Cells, expected, gol.Params{ImageWidth: size, ImageHeight: size})
+			})
+		}
+	}
+}
+
+// TestPatternInput loads patterns as the starting world, centred or offset on the board, and checks the runs against
+// the reference implementation.
+func TestPatternInput(t *testing.T) {
+	dir := t.TempDir()
+	gun := filepath.Join(dir, "gosper.rle")
+	util.Check(os.WriteFile(gun, []byte(gosperGun), 0644))
+	loaded, err := pattern.Read(strings.NewReader(gosperGun), pattern.RLE)
+	util.Check(err)
+	if len(loaded.Cells) != 36 {
+		t.Fatalf("expected 36 cells in the Gosper glider gun, got %d", len(loaded.Cells))
+	}
+
+	//On a board of its own size the pattern starts in the corner
+	cells := runFinal(gol.Params{Input: gun, Turns: 0, Threads: 4})
+	assertEqualBoard(t, cells, loaded.Cells, gol.Params{ImageWidth: 36, ImageHeight: 9})
+
+	//Centred on a larger board, then moved, the gun fires a glider every 30 turns
+	for _, offset := range []util.Cell{{}, {X: -10, Y: 20}} {
+		p := gol.Params{Input: gun, ImageWidth: 80, ImageHeight: 64, Turns: 120, Threads: 4, Centre: true, OffsetX: offset.X, OffsetY: offset.Y}
+		var board []util.Cell
+		for _, cell := range loaded.Cells {
+			board = append(board, util.Cell{X: cell.X + 22 + offset.X, Y: cell.Y + 27 + offset.Y})
+		}
+		image := filepath.Join(dir, fmt.Sprintf("gosper-%d-%d.pgm", offset.X, offset.Y))
+		writeImage(image, p.ImageWidth, p.ImageHeight, board)
+		rule, _ := gol.ParseRule(gol.DefaultRule)
+		expected := referenceRun(image, rule, p)
+		t.Run(fmt.Sprintf("gosper-%d-%d", offset.X, offset.Y), func(t *testing.T) {
+			assertEqualBoard(t, runFinal(p), expected, p)
+		})
+	}
+
+	//The rule in the header of an RLE pattern is used unless another is given
+	soup := filepath.Join(dir, "soup.pgm")
+	writeSoup(soup, 37, 23)
+	highLife := filepath.Join(dir, "soup.rle")
+	file, err := os.Create(highLife)
+	util.Check(err)
+	util.Check(pattern.Write(file, pattern.RLE, pattern.Pattern{Width: 37, Height: 23, Cells: readAliveCells(soup, 37, 23), Rule: "B36/S23"}))
+	util.Check(file.Close())
+	for _, ruleString := range []string{"", "B3/S23"} {
+		p := gol.Params{Input: highLife, Turns: 50, Threads: 4, Rule: ruleString}
+		if ruleString == "" {
+			ruleString = "B36/S23"
+		}
+		rule, _ := gol.ParseRule(ruleString)
+		expected := referenceRun(soup, rule, gol.Params{ImageWidth: 37, ImageHeight: 23, Turns: p.Turns})
+		t.Run(fmt.Sprintf("soup-%v", rule), func(t *testing.T) {
+			assertEqualBoard(t, runFinal(p), expected, gol.Params{ImageWidth: 37, ImageHeight: 23})
+		})
+	}
+
+	//Patterns that do not fit on the board are rejected
+	for _, p := range []gol.Params{
+		{Input: gun, OffsetX: 1},
+		{Input: gun, ImageWidth: 30, ImageHeight: 30, Centre: true},
+		{Input: gun, ImageWidth: 64, ImageHeight: 64, OffsetY: -1},
+	} {
+		p.Turns, p.Threads = 1, 1
+		if err := gol.Run(p, make(chan gol.Event), nil); err == nil {
+			t.Errorf("expected %+v to be rejected", p)
+		}
+	}
+}
+
+// TestPatternSnapshot presses 's' on the first three turns of the 16x16 image, saving each snapshot as a pattern,
+// and checks them against the reference implementation.
+func TestPatternSnapshot(t *testing.T) {
+	rule, _ := gol.ParseRule(gol.DefaultRule)
+	for _, format := range []pattern.Format{pattern.RLE, pattern.Plaintext, pattern.Life106} {
+		p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 10, Threads: 4, SnapshotFormat: format.String()}
+		t.Run(format.String(), func(t *testing.T) {
+			keyPresses := make(chan rune, 3)
+			keyPresses <- 's'
+			keyPresses <- 's'
+			keyPresses <- 's'
+			events := make(chan gol.Event)
+			go gol.Run(p, events, keyPresses)
+			var snapshots []gol.ImageOutputComplete
+			for event := range events {
+				if e, ok := event.(gol.ImageOutputComplete); ok && e.CompletedTurns < p.Turns {
+					snapshots = append(snapshots, e)
+				}
+			}
+			if len(snapshots) != 3 {
+				t.Fatalf("expected 3 snapshots, got %d", len(snapshots))
+			}
+			for _, snapshot := range snapshots {
+				file, err := os.Open("out/" + snapshot.Filename + format.Extension())
+				if err != nil {
+					t.Fatal(err)
+				}
+				given, err := pattern.Read(file, format)
+				file.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				expected := referenceRun("images/16x16.pgm", rule, gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: snapshot.CompletedTurns})
+				if format == pattern.Life106 {
+					expected = normalise(expected)
+				}
+				assertEqualBoard(t, given.Cells, expected, p)
+			}
+		})
+	}
+}
+
+// writeImage writes a binary PGM image of the given size with the given cells alive.
+func writeImage(path string, width, height int, alive []util.Cell) {
+	pixels := make([]byte, width*height)
+	for _, cell := range alive {
+		pixels[cell.Y*width+cell.X] = 255
+	}
+	file, err := os.Create(path)
+	util.Check(err)
+	defer file.Close()
+	_, err = fmt.Fprintf(file, "P5\n%d %d\n255\n", width, height)
+	util.Check(err)
+	_, err = file.Write(pixels)
+	util.Check(err)
+}
+
+// normalise moves cells so that the leftmost and topmost are on the edges of the board.
+func normalise(cells []util.Cell) []util.Cell {
+	if len(cells) == 0 {
+		return nil
+	}
+	left, top := cells[0].X, cells[0].Y
+	for _, cell := range cells {
+		if cell.X < left {
+			left = cell.X
+		}
+		if cell.Y < top {
+			top = cell.Y
+		}
+	}
+	moved := make([]util.Cell, len(cells))
+	for i, cell := range cells {
+		moved[i] = util.Cell{X: cell.X - left, Y: cell.Y - top}
+	}
+	return moved
+}
+
+// TestPatternRule loads a domino from an RLE file with a Seeds rule header as main does, sizing the world from the
+// pattern and leaving the rule unset, and checks that the pattern's rule is the one run: under Seeds the domino
+// gives birth to the cells above and below it, where under B3/S23 it would die out.
+func TestPatternRule(t *testing.T) {
+	rle := filepath.Join(t.TempDir(), "domino.rle")
+	util.Check(os.WriteFile(rle, []byte("#C A domino\nx = 8, y = 8, rule = B2/S\n3$3b2o!\n"), 0644))
+	p := gol.Params{Input: rle, Turns: 1, Threads: 4}
+	width, height, err := gol.ImageSize(p.Input, p.ImageIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ImageWidth, p.ImageHeight = width, height
+
+	expected := []util.Cell{{X: 3, Y: 2}, {X: 4, Y: 2}, {X: 3, Y: 4}, {X: 4, Y: 4}}
+	events := make(chan gol.Event)
+	go func() {
+		if err := gol.Run(p, events, nil); err != nil {
+			t.Error(err)
+		}
+	}()
+	for event := range events {
+		if e, ok := event.(gol.FinalTurnComplete); ok {
+			assertEqualBoard(t, e.Alive, expected, p)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// drawCells draws a width by height world with each cell a scale by scale square, alive cells in one colour and
+// dead cells in another.
+func drawCells(width, height, scale int, alive []util.Cell, on, off color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width*scale, height*scale))
+	cells := make(map[util.Cell]bool)
+	for _, cell := range alive {
+		cells[cell] = true
+	}
+	for y := 0; y < height*scale; y++ {
+		for x := 0; x < width*scale; x++ {
+			if cells[util.Cell{X: x / scale, Y: y / scale}] {
+				img.Set(x, y, on)
+			} else {
+				img.Set(x, y, off)
+			}
+		}
+	}
+	return img
+}
+
+// writePhoto encodes an image as a PNG, JPEG or GIF file, by the extension of path.
+func writePhoto(path string, img image.Image) {
+	file, err := os.Create(path)
+	util.Check(err)
+	defer file.Close()
+	switch filepath.Ext(path) {
+	case ".png":
+		util.Check(png.Encode(file, img))
+	case ".jpg":
+		util.Check(jpeg.Encode(file, img, &jpeg.Options{Quality: 95}))
+	case ".gif":
+		util.Check(gif.Encode(file, img, nil))
+	}
+}
+
+// TestPhoto loads a glider from photos four times the size of the board, in each format and binarisation,
+// and checks it is scaled back down to the same cells.
+func TestPhoto(t *testing.T) {
+	dir := t.TempDir()
+	glider := []util.Cell{{X: 1, Y: 0}, {X: 2, Y: 1}, {X: 0, Y: 2}, {X: 1, Y: 2}, {X: 2, Y: 2}}
+	var expected []util.Cell
+	for _, cell := range glider {
+		expected = append(expected, util.Cell{X: cell.X + 5, Y: cell.Y + 3})
+	}
+	bright, dark := color.RGBA{R: 200, G: 220, B: 180, A: 255}, color.RGBA{R: 40, G: 30, B: 60, A: 255}
+
+	tests := []struct {
+		name         string
+		binarisation gol.Binarisation
+		invert       bool
+		threshold    float64
+	}{
+		{"bright.png", gol.Threshold, false, 0},
+		{"bright.jpg", gol.Threshold, false, 0.6},
+		{"bright.gif", gol.Otsu, false, 0},
+		{"dark.png", gol.Otsu, true, 0},
+		{"dark.jpg", gol.Threshold, true, 0},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name)
+		if test.invert {
+			writePhoto(path, drawCells(16, 12, 4, expected, dark, bright))
+		} else {
+			writePhoto(path, drawCells(16, 12, 4, expected, bright, dark))
+		}
+		p := gol.Params{Input: path, ImageWidth: 16, ImageHeight: 12, Threads: 2,
+			Binarisation: test.binarisation, Invert: test.invert, AliveThreshold: test.threshold}
+		t.Run(fmt.Sprintf("%v-%v", test.name, test.binarisation), func(t *testing.T) {
+			assertEqualBoard(t, runFinal(p), expected, p)
+		})
+	}
+
+	//Left 0, the size of the board is the size of the photo
+	width, height, err := gol.ImageSize(filepath.Join(dir, "bright.png"), 0)
+	if err != nil || width != 64 || height != 48 {
+		t.Errorf("expected a 64x48 photo, got %dx%d (%v)", width, height, err)
+	}
+}
+
+// TestDither checks that dithering a grey photo makes alive about as many of the cells as the brightness of the grey,
+// and that the glider of a dithered black and white photo is left as it is.
+func TestDither(t *testing.T) {
+	dir := t.TempDir()
+	for _, grey := range []uint8{64, 128, 191} {
+		path := filepath.Join(dir, fmt.Sprintf("grey%d.png", grey))
+		img := image.NewGray(image.Rect(0, 0, 40, 40))
+		for i := range img.Pix {
+			img.Pix[i] = grey
+		}
+		writePhoto(path, img)
+		p := gol.Params{Input: path, Threads: 1, Binarisation: gol.FloydSteinberg}
+		density := float64(len(runFinal(p))) / (40 * 40)
+		expected := float64(grey) / 255
+		if density < expected-0.02 || density > expected+0.02 {
+			t.Errorf("expected about %.2f of the cells alive dithering grey %d, got %.2f", expected, grey, density)
+		}
+	}
+
+	glider := []util.Cell{{X: 1, Y: 0}, {X: 2, Y: 1}, {X: 0, Y: 2}, {X: 1, Y: 2}, {X: 2, Y: 2}}
+	path := filepath.Join(dir, "glider.png")
+	writePhoto(path, drawCells(8, 8, 1, glider, color.White, color.Black))
+	p := gol.Params{Input: path, Threads: 1, Binarisation: gol.FloydSteinberg, ImageWidth: 8, ImageHeight: 8}
+	assertEqualBoard(t, runFinal(p), glider, p)
+
+	p.Binarisation = gol.Binarisation(7)
+	if err := gol.Run(p, make(chan gol.Event), nil); err == nil {
+		t.Errorf("expected binarisation %v to be rejected", p.Binarisation)
+	}
+}
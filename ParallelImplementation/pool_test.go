@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestWorkerPool checks the worker pool with more workers than rows, where some workers own no cells,
+// and in every topology with one-row strips, where halos come from many other workers.
+func TestWorkerPool(t *testing.T) {
+	tests := []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16, Turns: 100, Threads: 17},
+		{ImageWidth: 16, ImageHeight: 16, Turns: 100, Threads: 40},
+		{ImageWidth: 64, ImageHeight: 64, Turns: 100, Threads: 64},
+	}
+	for _, p := range tests {
+		expectedAlive := readAliveCells(fmt.Sprintf("check/images/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns), p.ImageWidth, p.ImageHeight)
+		t.Run(fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+			assertEqualBoard(t, runFinal(p), expectedAlive, p)
+		})
+	}
+
+	for topology := gol.Torus; topology <= gol.CrossSurface; topology++ {
+		p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 100, Threads: 16, Topology: topology}
+		expectedAlive := readAliveCells(fmt.Sprintf("check/topology/%v/16x16x%d.pgm", topology, p.Turns), 16, 16)
+		t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", p.Topology, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+			assertEqualBoard(t, runFinal(p), expectedAlive, p)
+		})
+	}
+}
+
+// TestTileDecomposition checks the worker pool with the world divided into a grid of tiles, chosen automatically
+// or of a fixed size that does not divide the world exactly, in the topologies that turn halos around at the edges.
+func TestTileDecomposition(t *testing.T) {
+	tests := []gol.Params{
+		{ImageWidth: 64, ImageHeight: 64, Threads: 4, TileWidth: gol.AutoTiles, TileHeight: gol.AutoTiles},
+		{ImageWidth: 64, ImageHeight: 64, Threads: 6, TileWidth: gol.AutoTiles, TileHeight: gol.AutoTiles},
+		{ImageWidth: 64, ImageHeight: 64, Threads: 16, TileWidth: gol.AutoTiles, TileHeight: gol.AutoTiles},
+		{ImageWidth: 64, ImageHeight: 64, Threads: 1, TileWidth: 5, TileHeight: 7},
+		{ImageWidth: 64, ImageHeight: 64, Threads: 1, TileWidth: 16, TileHeight: 16},
+		{ImageWidth: 64, ImageHeight: 64, Threads: 1, TileWidth: 64, TileHeight: 8},
+		{ImageWidth: 64, ImageHeight: 64, Threads: 1, TileWidth: 8},
+	}
+	for _, p := range tests {
+		p.Turns = 100
+		expectedAlive := readAliveCells(fmt.Sprintf("check/images/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns), p.ImageWidth, p.ImageHeight)
+		t.Run(fmt.Sprintf("%dx%dx%d-%d-%dx%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads, p.TileWidth, p.TileHeight), func(t *testing.T) {
+			assertEqualBoard(t, runFinal(p), expectedAlive, p)
+		})
+	}
+
+	for _, topology := range []gol.Topology{gol.Reflect, gol.KleinBottle, gol.CrossSurface} {
+		p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 100, Threads: 1, TileWidth: 3, TileHeight: 5, Topology: topology}
+		expectedAlive := readAliveCells(fmt.Sprintf("check/topology/%v/16x16x%d.pgm", topology, p.Turns), 16, 16)
+		t.Run(fmt.Sprintf("%v-%dx%dx%d-%dx%d", p.Topology, p.ImageWidth, p.ImageHeight, p.Turns, p.TileWidth, p.TileHeight), func(t *testing.T) {
+			assertEqualBoard(t, runFinal(p), expectedAlive, p)
+		})
+	}
+}
+
+// TestWorkStealing checks the workers taking chunks of rows from a shared queue against the golden images,
+// with fewer and more workers than chunks and in every topology, and that every worker reports its busy time.
+func TestWorkStealing(t *testing.T) {
+	tests := []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16, Turns: 100, Threads: 1},
+		{ImageWidth: 16, ImageHeight: 16, Turns: 100, Threads: 8},
+		{ImageWidth: 64, ImageHeight: 64, Turns: 100, Threads: 3},
+		{ImageWidth: 512, ImageHeight: 512, Turns: 100, Threads: 16},
+	}
+	for _, p := range tests {
+		p.WorkStealing = true
+		expectedAlive := readAliveCells(fmt.Sprintf("check/images/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns), p.ImageWidth, p.ImageHeight)
+		t.Run(fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			var busy []time.Duration
+			for event := range events {
+				switch e := event.(type) {
+				case gol.WorkerStatistics:
+					busy = e.Busy
+				case gol.FinalTurnComplete:
+					if len(busy) != p.Threads {
+						t.Errorf("expected busy times of %d workers before FinalTurnComplete, got %d", p.Threads, len(busy))
+					}
+					assertEqualBoard(t, e.Alive, expectedAlive, p)
+				}
+			}
+		})
+	}
+
+	for topology := gol.Torus; topology <= gol.CrossSurface; topology++ {
+		p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 100, Threads: 4, Topology: topology, WorkStealing: true}
+		expectedAlive := readAliveCells(fmt.Sprintf("check/topology/%v/16x16x%d.pgm", topology, p.Turns), 16, 16)
+		t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", p.Topology, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+			assertEqualBoard(t, runFinal(p), expectedAlive, p)
+		})
+	}
+
+	//Rules with a larger neighbourhood must agree with the fixed strips
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 50, Threads: 4, Rule: "R2,C0,M0,S3..5,B4..5,NN"}
+	expectedAlive := runFinal(p)
+	p.WorkStealing = true
+	t.Run("R2-64x64x50-4", func(t *testing.T) {
+		assertEqualBoard(t, runFinal(p), expectedAlive, p)
+	})
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/record"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// recordRun runs the Game of Life with the given parameters through a recorder, returning the recording error.
+func recordRun(p gol.Params, options record.Options) error {
+	recorder, err := record.New(p, options)
+	if err != nil {
+		return err
+	}
+	events := make(chan gol.Event)
+	recorded := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	go recorder.Relay(events, recorded)
+	for range recorded {
+	}
+	return recorder.Err()
+}
+
+// assertEqualFrame checks that a frame shows the alive cells of the expected turn of the 16x16 image,
+// each as a scale by scale square of the alive colour, on the dead colour.
+func assertEqualFrame(t *testing.T, frame image.Image, turn, scale int, alive, dead color.Color) {
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: turn}
+	rule, _ := gol.ParseRule(gol.DefaultRule)
+	expected := make(map[util.Cell]bool)
+	for _, cell := range referenceRun("images/16x16.pgm", rule, p) {
+		expected[cell] = true
+	}
+	if size := frame.Bounds().Size(); size.X != 16*scale || size.Y != 16*scale {
+		t.Fatalf("frame of turn %d is %dx%d, expected %dx%d", turn, size.X, size.Y, 16*scale, 16*scale)
+	}
+	for y := 0; y < 16*scale; y++ {
+		for x := 0; x < 16*scale; x++ {
+			want := dead
+			if expected[util.Cell{X: x / scale, Y: y / scale}] {
+				want = alive
+			}
+			if !sameColour(frame.At(x, y), want) {
+				t.Fatalf("frame of turn %d has colour %v at (%d, %d), expected %v", turn, frame.At(x, y), x, y, want)
+			}
+		}
+	}
+}
+
+func sameColour(a, b color.Color) bool {
+	r0, g0, b0, a0 := a.RGBA()
+	r1, g1, b1, a1 := b.RGBA()
+	return r0 == r1 && g0 == g1 && b0 == b1 && a0 == a1
+}
+
+// TestRecordGIF records the glider of the 16x16 image every 4 turns for 10 turns, as an animated GIF with the
+// cells scaled up and coloured, and checks a frame is taken of the final turn too.
+func TestRecordGIF(t *testing.T) {
+	alive, dead := color.RGBA{R: 0xFF, G: 0xCC, A: 0xFF}, color.RGBA{B: 0x40, A: 0xFF}
+	name := filepath.Join(t.TempDir(), "glider")
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 10, Threads: 2}
+	options := record.Options{Format: record.GIF, Name: name, Every: 4, Scale: 3, Alive: alive, Dead: dead, Delay: 50 * time.Millisecond}
+	util.Check(recordRun(p, options))
+
+	file, err := os.Open(name + ".gif")
+	util.Check(err)
+	defer file.Close()
+	animation, err := gif.DecodeAll(file)
+	util.Check(err)
+	turns := []int{4, 8, 10}
+	if len(animation.Image) != len(turns) {
+		t.Fatalf("expected %d frames, got %d", len(turns), len(animation.Image))
+	}
+	for i, turn := range turns {
+		if animation.Delay[i] != 5 {
+			t.Errorf("expected a delay of 5 hundredths of a second, got %d", animation.Delay[i])
+		}
+		assertEqualFrame(t, animation.Image[i], turn, 3, alive, dead)
+	}
+}
+
+// TestRecordGIFMaxFrames records 50 turns of the glider of the 16x16 image as a GIF of at most 8 frames. Each time
+// the GIF fills up, every other frame is dropped and frames are taken half as often, ending on the final turn.
+func TestRecordGIFMaxFrames(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "glider")
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 50, Threads: 2}
+	util.Check(recordRun(p, record.Options{Format: record.GIF, Name: name, MaxFrames: 8}))
+
+	file, err := os.Open(name + ".gif")
+	util.Check(err)
+	defer file.Close()
+	animation, err := gif.DecodeAll(file)
+	util.Check(err)
+	turns := []int{8, 16, 24, 32, 40, 48, 50}
+	if len(animation.Image) != len(turns) {
+		t.Fatalf("expected %d frames, got %d", len(turns), len(animation.Image))
+	}
+	for i, turn := range turns {
+		assertEqualFrame(t, animation.Image[i], turn, 1, color.White, color.Black)
+	}
+}
+
+// TestRecordPNG records every 3rd turn of the glider of the 16x16 image as a numbered sequence of PNG images.
+func TestRecordPNG(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "glider")
+	for _, threads := range []int{1, 4} {
+		p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 9, Threads: threads}
+		util.Check(recordRun(p, record.Options{Format: record.PNG, Name: name, Every: 3}))
+		for i, turn := range []int{3, 6, 9} {
+			file, err := os.Open(fmt.Sprintf("%s-%06d.png", name, i))
+			util.Check(err)
+			frame, err := png.Decode(file)
+			file.Close()
+			util.Check(err)
+			assertEqualFrame(t, frame, turn, 1, color.White, color.Black)
+		}
+		if _, err := os.Stat(fmt.Sprintf("%s-%06d.png", name, 3)); err == nil {
+			t.Errorf("expected 3 frames only")
+		}
+		util.Check(os.RemoveAll(filepath.Dir(name)))
+	}
+}
+
+// TestRecordRejected checks that recordings with negative options, room for a single frame, or without a name,
+// are rejected.
+func TestRecordRejected(t *testing.T) {
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16}
+	tests := []record.Options{
+		{Name: "out/bad", Every: -1},
+		{Name: "out/bad", Scale: -2},
+		{Name: "out/bad", Delay: -time.Second},
+		{Name: "out/bad", Format: record.Format(7)},
+		{Name: "out/bad", MaxFrames: 1},
+		{},
+	}
+	for _, options := range tests {
+		if _, err := record.New(p, options); err == nil {
+			t.Errorf("expected %+v to be rejected", options)
+		}
+	}
+	for _, s := range []string{"12345", "#12345g", "ff00ff00"} {
+		if _, err := record.ParseColour(s); err == nil {
+			t.Errorf("expected colour %q to be rejected", s)
+		}
+	}
+}
+
+// TestRecordFinalFrame checks that when the final turn brings cells the recorder has not been told about for a turn
+// it has already taken a frame of, the frame is replaced rather than the turn being recorded twice.
+func TestRecordFinalFrame(t *testing.T) {
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 4}
+	rule, _ := gol.ParseRule(gol.DefaultRule)
+	alive := referenceRun("images/16x16.pgm", rule, p)
+	for i, format := range []record.Format{record.GIF, record.PNG} {
+		name := filepath.Join(t.TempDir(), fmt.Sprintf("glider%d", i))
+		recorder, err := record.New(p, record.Options{Format: format, Name: name, Every: 4})
+		util.Check(err)
+		recorder.Record(gol.TurnComplete{CompletedTurns: 4})
+		recorder.Record(gol.FinalTurnComplete{CompletedTurns: 4, Alive: alive})
+		util.Check(recorder.Err())
+
+		var frames []image.Image
+		if format == record.GIF {
+			file, err := os.Open(name + ".gif")
+			util.Check(err)
+			animation, err := gif.DecodeAll(file)
+			file.Close()
+			util.Check(err)
+			for _, frame := range animation.Image {
+				frames = append(frames, frame)
+			}
+		} else {
+			for i := 0; ; i++ {
+				file, err := os.Open(fmt.Sprintf("%s-%06d.png", name, i))
+				if err != nil {
+					break
+				}
+				frame, err := png.Decode(file)
+				file.Close()
+				util.Check(err)
+				frames = append(frames, frame)
+			}
+		}
+		if len(frames) != 1 {
+			t.Fatalf("expected 1 frame, got %d", len(frames))
+		}
+		assertEqualFrame(t, frames[0], 4, 1, color.White, color.Black)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestParseRule checks that rulestrings in B/S and S/B notation are parsed, and invalid ones rejected.
+func TestParseRule(t *testing.T) {
+	valid := map[string]string{
+		"":                            "B3/S23",
+		"B3/S23":                      "B3/S23",
+		"b36/s23":                     "B36/S23",
+		"S23/B36":                     "B36/S23",
+		"23/36":                       "B36/S23",
+		"B3678/S34678":                "B3678/S34678",
+		"B2/S":                        "B2/S",
+		"B2/S/C3":                     "B2/S/C3",
+		"/2/3":                        "B2/S/C3",
+		"345/2/4":                     "B2/S345/C4",
+		"B3/S23/2":                    "B3/S23",
+		"R5,C0,M1,S34..58,B34..45,NM": "R5,C0,M1,S34..58,B34..45,NM",
+		"r2,c3,m0,s2..3,5,b3,nn":      "R2,C3,M0,S2..3,5,B3,NN",
+		"R1,C0,M0,S2..3,B3,NM":        "B3/S23",
+	}
+	for rulestring, expected := range valid {
+		rule, err := gol.ParseRule(rulestring)
+		if err != nil {
+			t.Errorf("ParseRule(%q) returned error %v", rulestring, err)
+		} else if rule.String() != expected {
+			t.Errorf("ParseRule(%q) gave %v, expected %v", rulestring, rule, expected)
+		}
+	}
+
+	for _, rulestring := range []string{"B9/S23", "B3", "B3/S2x", "B3/S23/S1", "B2/S/C1", "B2/S/C257", "B2/S/C3/C3",
+		"R0,C0,M0,S1,B1,NM", "R1,C0,M0,S2..9,B3,NM", "R2,C0,M2,S1,B1,NM", "R2,C0,M0,S1,B1,NX", "R2,C0,M0,S3..1,B1,NM", "R2,C0,5"} {
+		if _, err := gol.ParseRule(rulestring); err == nil {
+			t.Errorf("ParseRule(%q) should have returned an error", rulestring)
+		}
+	}
+}
+
+// TestRuleRejected checks that gol.Run returns an error and closes events without running any turns.
+func TestRuleRejected(t *testing.T) {
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 1, Threads: 1, Rule: "B3/S29"}
+	events := make(chan gol.Event)
+	err := make(chan error)
+	go func() {
+		err <- gol.Run(p, events, nil)
+	}()
+	for event := range events {
+		t.Errorf("unexpected event %T received for an invalid rule", event)
+	}
+	if <-err == nil {
+		t.Error("gol.Run accepted an invalid rule")
+	}
+}
+
+// TestRule checks that HighLife, Seeds and Day & Night are honoured by every engine configuration.
+// The expected boards come from a naive reference evolution of the input image.
+func TestRule(t *testing.T) {
+	for _, rulestring := range []string{"B36/S23", "B2/S", "B3678/S34678"} {
+		rule, err := gol.ParseRule(rulestring)
+		util.Check(err)
+		for _, turns := range []int{1, 10} {
+			p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: turns, Rule: rulestring}
+			expectedAlive := referenceRun("images/64x64.pgm", rule, p)
+			for _, threads := range []int{1, 3, 8, 16} {
+				p.Threads = threads
+				t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", rule, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+					assertEqualBoard(t, runFinal(p), expectedAlive, p)
+				})
+			}
+		}
+	}
+}
+
+// TestGenerations checks Brian's Brain and Star Wars, comparing both the decaying states reported
+// through CellStatesChanged events and the grey levels of the output PGM against a reference evolution.
+// Each worker sends the cells it changed on a turn in at most one batch.
+func TestGenerations(t *testing.T) {
+	for _, rulestring := range []string{"B2/S/C3", "B2/S345/C4"} {
+		rule, err := gol.ParseRule(rulestring)
+		util.Check(err)
+		p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 10, Rule: rulestring}
+		expected := referenceWorld("images/64x64.pgm", rule, p)
+		for _, threads := range []int{1, 4, 16} {
+			p.Threads = threads
+			t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", rule, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+				board := make([][]uint8, p.ImageHeight)
+				for y := range board {
+					board[y] = make([]uint8, p.ImageWidth)
+				}
+				events := make(chan gol.Event)
+				go gol.Run(p, events, nil)
+				batches := make(map[int]int)
+				for event := range events {
+					switch e := event.(type) {
+					case gol.CellFlipped, gol.CellsFlipped:
+						t.Fatalf("%T sent for the multi-state rule %v", event, rule)
+					case gol.CellStateChanged:
+						t.Fatalf("CellStateChanged sent for turn %d instead of a batch", e.CompletedTurns)
+					case gol.CellStatesChanged:
+						batches[e.CompletedTurns]++
+						for i, cell := range e.Cells {
+							board[cell.Y][cell.X] = e.States[i]
+						}
+					}
+				}
+				//The cells not dead in the image share turn 0 with the first turn's changes, so it is left out
+				for turn := 1; turn < p.Turns; turn++ {
+					if batches[turn] > p.Threads {
+						t.Errorf("turn %d: %d CellStatesChanged sent by %d workers", turn, batches[turn], p.Threads)
+					}
+				}
+				output := readPgmValues(fmt.Sprintf("out/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns))
+				for y := 0; y < p.ImageHeight; y++ {
+					for x := 0; x < p.ImageWidth; x++ {
+						if board[y][x] != expected[y][x] || output[y][x] != expected[y][x] {
+							t.Fatalf("cell (%d, %d) should be %d, events gave %d and the image %d", x, y, expected[y][x], board[y][x], output[y][x])
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestLargerThanLife checks Moore and von Neumann neighbourhoods of larger radii, including strips thinner
+// than the halo they need and a radius so wide that the neighbourhood wraps around the world more than once.
+func TestLargerThanLife(t *testing.T) {
+	tests := []struct {
+		rulestring string
+		turns      int
+	}{
+		{"R5,C0,M1,S34..58,B34..45,NM", 5},
+		{"R2,C0,M0,S3..5,B4..5,NN", 5},
+		{"R3,C4,M1,S20..40,B28..36,NM", 5},
+		{"R40,C0,M1,S2200..4600,B2300..4500,NM", 2},
+	}
+	for _, test := range tests {
+		rule, err := gol.ParseRule(test.rulestring)
+		util.Check(err)
+		p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: test.turns, Rule: test.rulestring}
+		expectedAlive := referenceRun("images/64x64.pgm", rule, p)
+		for _, threads := range []int{1, 5, 16} {
+			p.Threads = threads
+			t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", rule, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+				assertEqualBoard(t, runFinal(p), expectedAlive, p)
+			})
+		}
+	}
+}
+
+// runFinal runs the Game of Life with the given parameters and returns the alive cells of the final turn.
+func runFinal(p gol.Params) []util.Cell {
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	var cells []util.Cell
+	for event := range events {
+		switch e := event.(type) {
+		case gol.FinalTurnComplete:
+			cells = e.Alive
+		}
+	}
+	return cells
+}
+
+// referenceRun evolves the image at path for p.Turns turns and returns the alive cells.
+func referenceRun(path string, rule gol.Rule, p gol.Params) []util.Cell {
+	world := referenceWorld(path, rule, p)
+	var cells []util.Cell
+	for y := range world {
+		for x := range world[y] {
+			if world[y][x] == 255 {
+				cells = append(cells, util.Cell{X: x, Y: y})
+			}
+		}
+	}
+	return cells
+}
+
+// referenceWorld evolves the image at path for p.Turns turns on a torus, one cell at a time,
+// visiting every cell of the neighbourhood of each cell.
+// The returned world holds the pixel value of every cell: decaying state s of a rule with
+// C states is stored as 255 - (s-1)*255/(C-1).
+func referenceWorld(path string, rule gol.Rule, p gol.Params) [][]uint8 {
+	state := make([][]int, p.ImageHeight)
+	for y := range state {
+		state[y] = make([]int, p.ImageWidth)
+	}
+	for _, cell := range readAliveCells(path, p.ImageWidth, p.ImageHeight) {
+		state[cell.Y][cell.X] = 1
+	}
+
+	for turn := 0; turn < p.Turns; turn++ {
+		next := make([][]int, p.ImageHeight)
+		for y := range next {
+			next[y] = make([]int, p.ImageWidth)
+			for x := range next[y] {
+				neighbours := 0
+				for dy := -rule.Radius; dy <= rule.Radius; dy++ {
+					for dx := -rule.Radius; dx <= rule.Radius; dx++ {
+						if rule.Neighbourhood == gol.VonNeumann && abs(dy)+abs(dx) > rule.Radius {
+							continue
+						}
+						if dy == 0 && dx == 0 && !rule.Middle {
+							continue
+						}
+						ny := ((y+dy)%p.ImageHeight + p.ImageHeight) % p.ImageHeight
+						nx := ((x+dx)%p.ImageWidth + p.ImageWidth) % p.ImageWidth
+						if state[ny][nx] == 1 {
+							neighbours++
+						}
+					}
+				}
+				switch {
+				case state[y][x] == 0 && rule.Birth[neighbours]:
+					next[y][x] = 1
+				case state[y][x] == 1 && rule.Survival[neighbours]:
+					next[y][x] = 1
+				case state[y][x] != 0:
+					next[y][x] = (state[y][x] + 1) % rule.States
+				}
+			}
+		}
+		state = next
+	}
+
+	world := make([][]uint8, p.ImageHeight)
+	for y := range world {
+		world[y] = make([]uint8, p.ImageWidth)
+		for x := range world[y] {
+			if state[y][x] != 0 {
+				world[y][x] = uint8(255 - (state[y][x]-1)*255/(rule.States-1))
+			}
+		}
+	}
+	return world
+}
+
+// readPgmValues reads the pixel values of a binary PGM image with a maxval of 255.
+func readPgmValues(path string) [][]uint8 {
+	data, err := os.ReadFile(path)
+	util.Check(err)
+	fields, pixels := pgmFields(data)
+	width, _ := strconv.Atoi(fields[1])
+	height, _ := strconv.Atoi(fields[2])
+	if fields[0] != "P5" || fields[3] != "255" {
+		panic("Not an 8-bit binary pgm file")
+	}
+
+	world := make([][]uint8, height)
+	for y := range world {
+		world[y] = pixels[y*width : (y+1)*width]
+	}
+	return world
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
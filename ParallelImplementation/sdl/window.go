@@ -87,6 +87,19 @@ func (w *Window) FlipPixel(x, y int) {
 	w.pixels[4*(y*width+x)+3] = ^w.pixels[4*(y*width+x)+3]
 }
 
+// SetPixelValue sets a pixel to a grey level, used to show the decaying states of multi-state rules.
+func (w *Window) SetPixelValue(x, y int, value uint8) {
+	if x < 0 || y < 0 || x >= int(w.Width) || y >= int(w.Height) {
+		panic(fmt.Sprintf("CellStateChanged event at (%d, %d) is outside the bounds of the window.", x, y))
+	}
+
+	width := int(w.Width)
+	w.pixels[4*(y*width+x)+0] = value
+	w.pixels[4*(y*width+x)+1] = value
+	w.pixels[4*(y*width+x)+2] = value
+	w.pixels[4*(y*width+x)+3] = value
+}
+
 func (w *Window) CountPixels() int {
 	count := 0
 	for i := 0; i < int(w.Width) * int(w.Height) * 4; i += 4 {
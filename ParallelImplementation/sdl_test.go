@@ -59,6 +59,13 @@ sdlLoop:
 				if w != nil {
 					w.FlipPixel(e.Cell.X, e.Cell.Y)
 				}
+			case gol.CellsFlipped:
+				for _, cell := range e.Cells {
+					board[cell.Y][cell.X] = ^board[cell.Y][cell.X]
+					if w != nil {
+						w.FlipPixel(cell.X, cell.Y)
+					}
+				}
 			case gol.TurnComplete:
 				if w != nil {
 					w.RenderFrame()
@@ -102,7 +109,7 @@ func TestSdl(t *testing.T) {
 		final := false
 		for event := range events {
 			switch e := event.(type) {
-			case gol.CellFlipped:
+			case gol.CellFlipped, gol.CellsFlipped:
 				sdlEvents <- e
 			case gol.TurnComplete:
 				turnNum++
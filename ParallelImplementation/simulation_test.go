@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestSimulation checks that a simulation stepped a few turns at a time on every engine reaches the golden image,
+// that cells changed with SetCell evolve as the reference does once saved, and that a subscriber can rebuild the
+// world from its events.
+func TestSimulation(t *testing.T) {
+	tests := []gol.Params{
+		{Threads: 4},
+		{Threads: 4, TileWidth: 16, TileHeight: 32},
+		{Threads: 4, WorkStealing: true},
+		{Threads: 4, Packed: true},
+		{Threads: 1, HashLife: true},
+	}
+	rule, err := gol.ParseRule(gol.DefaultRule)
+	util.Check(err)
+	for _, p := range tests {
+		p.ImageWidth, p.ImageHeight = 64, 64
+		t.Run(fmt.Sprintf("%+v", p), func(t *testing.T) {
+			sim, err := gol.NewSimulation(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			//The subscriber keeps its own copy of the world, flipping the cells it is told about
+			board := make(map[util.Cell]bool)
+			last := make(chan int)
+			events := sim.Subscribe()
+			go func() {
+				turn := -1
+				for event := range events {
+					switch e := event.(type) {
+					case gol.CellFlipped:
+						board[e.Cell] = !board[e.Cell]
+					case gol.CellsFlipped:
+						for _, cell := range e.Cells {
+							board[cell] = !board[cell]
+						}
+					case gol.TurnComplete:
+						turn = e.CompletedTurns
+					}
+				}
+				last <- turn
+			}()
+
+			for _, n := range []int{10, 0, 57, 33} {
+				sim.Step(n)
+			}
+			if sim.Turn() != 100 {
+				t.Fatalf("expected 100 completed turns, got %d", sim.Turn())
+			}
+			assertEqualBoard(t, sim.AliveCells(), readAliveCells("check/images/64x64x100.pgm", 64, 64), p)
+
+			//Inverting a block of cells, and checking the next turns against the reference from the saved world
+			for y := 20; y < 28; y++ {
+				for x := 20; x < 28; x++ {
+					sim.SetCell(util.Cell{X: x, Y: y}, sim.World()[y][x] == 0)
+				}
+			}
+			path := filepath.Join(t.TempDir(), "changed.pgm")
+			if err := sim.Save(path); err != nil {
+				t.Fatal(err)
+			}
+			sim.Step(8)
+			reference := p
+			reference.Turns = 8
+			expected := referenceRun(path, rule, reference)
+			assertEqualBoard(t, sim.AliveCells(), expected, p)
+			alive := 0
+			for _, row := range sim.World() {
+				for _, value := range row {
+					if value == 255 {
+						alive++
+					}
+				}
+			}
+			if alive != len(expected) {
+				t.Errorf("expected World to hold %d alive cells, got %d", len(expected), alive)
+			}
+
+			final := sim.AliveCells()
+			if err := sim.Close(); err != nil {
+				t.Error(err)
+			}
+			if turn := <-last; turn != 108 {
+				t.Errorf("expected the last TurnComplete to be for turn 108, got %d", turn)
+			}
+			var subscribed []util.Cell
+			for cell, alive := range board {
+				if alive {
+					subscribed = append(subscribed, cell)
+				}
+			}
+			assertEqualBoard(t, subscribed, final, p)
+		})
+	}
+}
+
+// TestSimulationSubscribeLate checks that a subscriber joining after some turns is first sent the cells alive then
+// in one CellsFlipped, and that subscribing to a closed simulation gives a closed channel.
+func TestSimulationSubscribeLate(t *testing.T) {
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, Threads: 2}
+	sim, err := gol.NewSimulation(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.Step(100)
+	events := sim.Subscribe()
+	e := (<-events).(gol.CellsFlipped)
+	if e.CompletedTurns != 100 {
+		t.Errorf("expected the cells alive after turn 100, got a CellsFlipped for turn %d", e.CompletedTurns)
+	}
+	assertEqualBoard(t, e.Cells, readAliveCells("check/images/16x16x100.pgm", 16, 16), p)
+
+	go sim.Close()
+	var quitting bool
+	for event := range events {
+		if e, ok := event.(gol.StateChange); ok && e.NewState == gol.Quitting {
+			quitting = true
+		}
+	}
+	if !quitting {
+		t.Error("expected a Quitting StateChange before the channel was closed")
+	}
+	if _, ok := <-sim.Subscribe(); ok {
+		t.Error("expected subscribing to a closed simulation to give a closed channel")
+	}
+}
+
+// TestSimulationSave checks that the world can be saved as a pattern and read back, and that saving it in an
+// unknown format, or where it cannot be written, fails.
+func TestSimulationSave(t *testing.T) {
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64, Threads: 2}
+	sim, err := gol.NewSimulation(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	sim.Step(10)
+	dir := t.TempDir()
+
+	saved := filepath.Join(dir, "world.rle")
+	if err := sim.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := gol.NewSimulation(gol.Params{Input: saved, Threads: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Close()
+	assertEqualBoard(t, loaded.AliveCells(), sim.AliveCells(), p)
+
+	if err := sim.Save(filepath.Join(dir, "world.txt")); err == nil {
+		t.Error("expected saving to an unknown format to fail")
+	}
+	if err := sim.Save(filepath.Join(dir, "missing", "world.pgm")); err == nil {
+		t.Error("expected saving into a missing directory to fail")
+	} else if ioError, ok := err.(gol.IOError); !ok || ioError.Operation != "save" || ioError.CompletedTurns != 10 {
+		t.Errorf("expected an IOError saving on turn 10, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// boardHash returns the FNV-1a hash of the pixels of a board with the given cells alive, row by row.
+func boardHash(cells []util.Cell, width, height int) uint64 {
+	board := make([]byte, width*height)
+	for _, cell := range cells {
+		board[cell.Y*width+cell.X] = 255
+	}
+	h := fnv.New64a()
+	h.Write(board)
+	return h.Sum64()
+}
+
+// soupTests are soups on a 64x48 board, with the number of cells they make alive and the hash of the board.
+// The distributed implementation is checked against the same hashes, so any change to how soups are made shows up.
+var soupTests = []struct {
+	soup  gol.Soup
+	alive int
+	hash  uint64
+}{
+	{gol.Soup{Density: 0.35, Seed: 42}, 1056, 0x1cc00402cb1e0eff},
+	{gol.Soup{Density: 0.5, Seed: 7, Symmetry: gol.C2, Width: 30, Height: 20}, 296, 0x944974ad049cfd1},
+	{gol.Soup{Density: 0.25, Seed: 1, Symmetry: gol.C4, Width: 24, Height: 24}, 152, 0xcbeeb599aeb35bd},
+	{gol.Soup{Density: 0.6, Seed: 1 << 63, Symmetry: gol.D8, Width: 17, Height: 17}, 164, 0xe4ce719202c8db45},
+}
+
+// TestSoup checks that soups are made exactly as they always have been, that they lie within their rectangle in the
+// centre of the board, and that they have the symmetry asked for.
+func TestSoup(t *testing.T) {
+	for _, test := range soupTests {
+		p := gol.Params{ImageWidth: 64, ImageHeight: 48, Threads: 2, Soup: test.soup}
+		t.Run(fmt.Sprintf("%v-%v", test.soup.Seed, test.soup.Symmetry), func(t *testing.T) {
+			cells := runFinal(p)
+			if hash := boardHash(cells, 64, 48); len(cells) != test.alive || hash != test.hash {
+				t.Errorf("expected %d cells alive with hash %#x, got %d with hash %#x", test.alive, test.hash, len(cells), hash)
+			}
+
+			width, height := test.soup.Width, test.soup.Height
+			if width == 0 {
+				width, height = 64, 48
+			}
+			left, top := (64-width)/2, (48-height)/2
+			alive := make(map[util.Cell]bool)
+			for _, cell := range cells {
+				alive[util.Cell{X: cell.X - left, Y: cell.Y - top}] = true
+			}
+			for cell := range alive {
+				if cell.X < 0 || cell.X >= width || cell.Y < 0 || cell.Y >= height {
+					t.Fatalf("cell %v is outside the %dx%d soup", cell, width, height)
+				}
+				var images []util.Cell
+				switch test.soup.Symmetry {
+				case gol.C2:
+					images = []util.Cell{{X: width - 1 - cell.X, Y: height - 1 - cell.Y}}
+				case gol.C4:
+					images = []util.Cell{{X: width - 1 - cell.Y, Y: cell.X}}
+				case gol.D8:
+					images = []util.Cell{{X: width - 1 - cell.Y, Y: cell.X}, {X: width - 1 - cell.X, Y: cell.Y}}
+				}
+				for _, image := range images {
+					if !alive[image] {
+						t.Fatalf("cell %v of the %v soup is alive, but not %v", cell, test.soup.Symmetry, image)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestSoupEngines runs a soup on every engine, which should all make the same soup and agree on where it goes.
+func TestSoupEngines(t *testing.T) {
+	soup := gol.Soup{Density: 0.4, Seed: 2023, Width: 40, Height: 40}
+	tests := []gol.Params{
+		{Threads: 4},
+		{Threads: 3, Packed: true},
+		{Threads: 1, HashLife: true},
+		{Threads: 4, WorkStealing: true},
+		{Threads: 4, TileWidth: gol.AutoTiles, TileHeight: gol.AutoTiles},
+	}
+	var expected []util.Cell
+	for i, p := range tests {
+		p.ImageWidth, p.ImageHeight, p.Turns, p.Soup = 64, 64, 150, soup
+		cells := runFinal(p)
+		if i == 0 {
+			expected = cells
+			continue
+		}
+		t.Run(engineName(p), func(t *testing.T) {
+			assertEqualBoard(t, cells, expected, p)
+		})
+	}
+}
+
+// TestSoupRejected checks that soups that do not fit, are not square when they must be, or are given alongside
+// an input image, are rejected.
+func TestSoupRejected(t *testing.T) {
+	tests := []gol.Params{
+		{Soup: gol.Soup{Density: 1.5}},
+		{Soup: gol.Soup{Density: -0.1}},
+		{Soup: gol.Soup{Density: 0.5, Width: 65}},
+		{Soup: gol.Soup{Density: 0.5, Symmetry: gol.C4}},
+		{Soup: gol.Soup{Density: 0.5, Symmetry: gol.D8, Width: 10, Height: 12}},
+		{Soup: gol.Soup{Density: 0.5, Symmetry: gol.Symmetry(9)}},
+		{Soup: gol.Soup{Density: 0.5}, Input: "images/64x64.pgm"},
+	}
+	for _, p := range tests {
+		p.ImageWidth, p.ImageHeight, p.Turns, p.Threads = 64, 48, 1, 1
+		if p.Input != "" {
+			p.ImageHeight = 64
+		}
+		if err := gol.Run(p, make(chan gol.Event), nil); err == nil {
+			t.Errorf("expected %+v to be rejected", p)
+		}
+	}
+}
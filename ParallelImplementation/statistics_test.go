@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestTurnStatistics checks the births, deaths and population reported by each engine after every turn against the
+// CellsFlipped events sent for the turn and the counts in check/alive.
+func TestTurnStatistics(t *testing.T) {
+	engines := []gol.Params{
+		{Threads: 4},
+		{Threads: 4, WorkStealing: true},
+		{Threads: 4, Packed: true},
+		{Threads: 1, HashLife: true},
+	}
+	alive := readAliveCounts(64, 64)
+	for _, p := range engines {
+		p.ImageWidth, p.ImageHeight, p.Turns = 64, 64, 100
+		t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", engineName(p), p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+			board := make([][]bool, p.ImageHeight)
+			for y := range board {
+				board[y] = make([]bool, p.ImageWidth)
+			}
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			births, deaths, turns := 0, 0, 0
+			for event := range events {
+				switch e := event.(type) {
+				case gol.CellsFlipped:
+					for _, cell := range e.Cells {
+						board[cell.Y][cell.X] = !board[cell.Y][cell.X]
+						if board[cell.Y][cell.X] {
+							births++
+						} else {
+							deaths++
+						}
+					}
+				case gol.TurnStatistics:
+					turns++
+					//The cells alive in the image are flipped with the same turn as the first turn's changes,
+					//so the flips are only compared from the second turn on
+					if turns > 1 && (e.Births != births || e.Deaths != deaths) {
+						t.Errorf("turn %d: reported %d births and %d deaths, flipped %d and %d", e.CompletedTurns, e.Births, e.Deaths, births, deaths)
+					}
+					if e.Population != alive[e.CompletedTurns] {
+						t.Errorf("turn %d: reported a population of %d, expected %d", e.CompletedTurns, e.Population, alive[e.CompletedTurns])
+					}
+					if density := float64(e.Population) / float64(p.ImageWidth*p.ImageHeight); e.Density != density {
+						t.Errorf("turn %d: reported a density of %v, expected %v", e.CompletedTurns, e.Density, density)
+					}
+					births, deaths = 0, 0
+				}
+			}
+			if turns == 0 {
+				t.Errorf("no TurnStatistics events were sent")
+			}
+		})
+	}
+}
+
+// TestPopulationCSV checks that the population CSV written for the 16x16 and 64x64 images is the same as the ones in check/alive.
+func TestPopulationCSV(t *testing.T) {
+	tests := []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16, Turns: 10000, Threads: 4},
+		{ImageWidth: 64, ImageHeight: 64, Turns: 10000, Threads: 4, Packed: true},
+	}
+	for _, p := range tests {
+		p.PopulationCSV = true
+		t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", engineName(p), p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+			runFinal(p)
+			expected, err := os.ReadFile(fmt.Sprintf("check/alive/%vx%v.csv", p.ImageWidth, p.ImageHeight))
+			if err != nil {
+				t.Fatal(err)
+			}
+			given, err := os.ReadFile(fmt.Sprintf("out/%vx%vx%v-alive.csv", p.ImageWidth, p.ImageHeight, p.Turns))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(given) != string(expected) {
+				t.Errorf("out/%vx%vx%v-alive.csv differs from check/alive", p.ImageWidth, p.ImageHeight, p.Turns)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestTilesSkipped follows the glider of the 16x16 image into the corner of a plane, where it settles into a block.
+// Once it has settled every tile should be skipped, and a TilesSkipped event should be sent before every TurnComplete.
+func TestTilesSkipped(t *testing.T) {
+	for _, threads := range []int{1, 3} {
+		p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 120, Threads: threads, Topology: gol.Plane}
+		t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", p.Topology, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			var last gol.TilesSkipped
+			for event := range events {
+				switch e := event.(type) {
+				case gol.TilesSkipped:
+					last = e
+				case gol.TurnComplete:
+					if last.CompletedTurns != e.CompletedTurns {
+						t.Fatalf("no TilesSkipped event sent for turn %d", e.CompletedTurns)
+					}
+				}
+			}
+			if last.Tiles == 0 || last.Skipped != last.Tiles {
+				t.Errorf("expected every tile to be skipped once the block has settled, %d of %d were", last.Skipped, last.Tiles)
+			}
+		})
+	}
+}
+
+// TestTilesSkippedBoard checks that skipping quiet tiles leaves the 512x512 image just as the packed engine,
+// which recomputes every cell, finds it once most of the image has settled.
+func TestTilesSkippedBoard(t *testing.T) {
+	p := gol.Params{ImageWidth: 512, ImageHeight: 512, Turns: 500, Threads: 8, Packed: true}
+	expectedAlive := runFinal(p)
+	p.Packed = false
+	var skipped int
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	var cells []util.Cell
+	for event := range events {
+		switch e := event.(type) {
+		case gol.TilesSkipped:
+			skipped = e.Skipped
+		case gol.FinalTurnComplete:
+			cells = e.Alive
+		}
+	}
+	assertEqualBoard(t, cells, expectedAlive, p)
+	if skipped == 0 {
+		t.Errorf("no tiles were skipped on turn %d", p.Turns)
+	}
+}
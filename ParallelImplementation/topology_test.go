@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestTopology follows the glider of the 16x16 image off the bottom right of the board in every topology.
+// Each result is checked against the golden images in check/topology, and the turns where the
+// expected board follows from the topology alone are checked directly:
+// on a torus the glider is back where it started after 64 turns, on a plane it hits the corner and
+// settles into a block, and on a Klein bottle it comes back mirrored, travelling down and to the left.
+func TestTopology(t *testing.T) {
+	initial := readAliveCells("images/16x16.pgm", 16, 16)
+	mirrored := make([]util.Cell, len(initial))
+	for i, cell := range initial {
+		mirrored[i] = util.Cell{X: 15 - cell.X, Y: cell.Y}
+	}
+	block := []util.Cell{{X: 12, Y: 14}, {X: 13, Y: 14}, {X: 12, Y: 15}, {X: 13, Y: 15}}
+
+	type topologyTest struct {
+		topology gol.Topology
+		turns    int
+		expected []util.Cell
+	}
+	tests := []topologyTest{
+		{gol.Torus, 64, initial},
+		{gol.Plane, 100, block},
+		{gol.KleinBottle, 64, mirrored},
+	}
+	for topology := gol.Torus; topology <= gol.CrossSurface; topology++ {
+		for _, turns := range []int{40, 100} {
+			golden := readAliveCells(fmt.Sprintf("check/topology/%v/16x16x%d.pgm", topology, turns), 16, 16)
+			tests = append(tests, topologyTest{topology, turns, golden})
+		}
+	}
+
+	for _, test := range tests {
+		for _, threads := range []int{1, 2, 5, 16} {
+			p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: test.turns, Threads: threads, Topology: test.topology}
+			expected := test.expected
+			t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", p.Topology, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+				events := make(chan gol.Event)
+				go gol.Run(p, events, nil)
+				var cells []util.Cell
+				for event := range events {
+					switch e := event.(type) {
+					case gol.FinalTurnComplete:
+						cells = e.Alive
+					}
+				}
+				assertEqualBoard(t, cells, expected, p)
+			})
+		}
+	}
+}
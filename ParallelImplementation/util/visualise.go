@@ -83,6 +83,8 @@ func squaresToStrings(given, expected [][]uint8, width, height int) []string {
 				output = append(output, "██")
 			} else if given [i][j] == 0x00 {
 				output = append(output, "  ")
+			} else {
+				output = append(output, "░░")
 			}
 		}
 
@@ -93,6 +95,8 @@ func squaresToStrings(given, expected [][]uint8, width, height int) []string {
 					output = append(output, "██")
 				} else if expected[i][j] == 0x00 {
 					output = append(output, "  ")
+				} else {
+					output = append(output, "░░")
 				}
 			}
 		}